@@ -2,17 +2,17 @@ package eventpkg
 
 import "time"
 
-// CreateEvent creates an event and returns it
-func CreateEvent() map[string]interface{} {
+// CreateEvent creates an event from the given account and region and returns it
+func CreateEvent(account, region string) map[string]interface{} {
 	currentTime := time.Now()
 
 	event := map[string]interface{}{
 		"version":     "0",
 		"detail-type": "ECR Image Scan",
 		"source":      "aws.ecr",
-		"account":     "851725240994",
+		"account":     account,
 		"time":        currentTime.Format(time.RFC3339),
-		"region":      "us-east-1",
+		"region":      region,
 		"resources":   []interface{}{},
 		"detail": map[string]interface{}{
 			"scan-status":     "COMPLETE",
@@ -0,0 +1,260 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+
+	"setup/helpers/progress"
+)
+
+// DefaultAlias is the alias EventBridge invokes; deploys move it to each new version.
+const DefaultAlias = "live"
+
+// Release is where an alias points after a deploy or rollback.
+type Release struct {
+	AliasArn string
+	Version  string
+	// PreviousVersion is the version the alias pointed at before, empty for a new alias.
+	PreviousVersion string
+}
+
+// ParseWeights parses a canary schedule such as "10,50,100" into percentages. The
+// schedule must increase and always ends at 100.
+func ParseWeights(schedule string) ([]int, error) {
+	if strings.TrimSpace(schedule) == "" {
+		return []int{100}, nil
+	}
+
+	var weights []int
+	for _, part := range strings.Split(schedule, ",") {
+		weight, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || weight < 1 || weight > 100 {
+			return nil, fmt.Errorf("canary weight %q must be a percentage between 1 and 100", part)
+		}
+		if len(weights) > 0 && weight <= weights[len(weights)-1] {
+			return nil, fmt.Errorf("canary weights must increase, got %s", schedule)
+		}
+		weights = append(weights, weight)
+	}
+	if weights[len(weights)-1] != 100 {
+		weights = append(weights, 100)
+	}
+	return weights, nil
+}
+
+// PublishVersion waits for pending updates to settle and publishes $LATEST as a new
+// immutable version.
+func PublishVersion(client lambdaClient, functionName, description string) (string, error) {
+	if err := WaitUntilUpdated(client, functionName); err != nil {
+		return "", err
+	}
+
+	result, err := client.PublishVersion(context.Background(), &lambda.PublishVersionInput{
+		FunctionName: aws.String(functionName),
+		Description:  aws.String(description),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to publish version: %v", err)
+	}
+
+	progress.Printf("Published version %s\n", aws.ToString(result.Version))
+	return aws.ToString(result.Version), nil
+}
+
+// CanaryError is a failed check of a canary step. The alias was rolled back to
+// PreviousVersion, unless RollbackErr says why it could not be.
+type CanaryError struct {
+	Weight          int
+	Version         string
+	PreviousVersion string
+	Err             error
+	RollbackErr     error
+}
+
+func (e *CanaryError) Error() string {
+	message := fmt.Sprintf("canary of version %s failed at %d%%: %v", e.Version, e.Weight, e.Err)
+	if e.RollbackErr != nil {
+		return fmt.Sprintf("%s\nfailed to roll back: %v", message, e.RollbackErr)
+	}
+	return fmt.Sprintf("%s\nrolled back to version %s", message, e.PreviousVersion)
+}
+
+// ShiftTraffic moves the alias to version. Each weight below 100 routes that share of
+// invocations to the new version through the alias routing config, holds for interval
+// and then runs check, if any, before traffic grows; the final step points the alias at
+// the version outright. A failed check points the alias back at the previous version
+// and is returned as a *CanaryError.
+func ShiftTraffic(client lambdaClient, functionName, alias, version string, weights []int, interval time.Duration, check func() error) (*Release, error) {
+	current, err := client.GetAlias(context.Background(), &lambda.GetAliasInput{
+		FunctionName: aws.String(functionName),
+		Name:         aws.String(alias),
+	})
+	if err != nil {
+		if !strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return nil, fmt.Errorf("failed to get alias %s: %v", alias, err)
+		}
+
+		// First deploy with aliases: there is nothing to shift traffic away from
+		created, err := client.CreateAlias(context.Background(), &lambda.CreateAliasInput{
+			FunctionName:    aws.String(functionName),
+			Name:            aws.String(alias),
+			FunctionVersion: aws.String(version),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create alias %s: %v", alias, err)
+		}
+		progress.Printf("Alias %s created at version %s\n", alias, version)
+		return &Release{AliasArn: aws.ToString(created.AliasArn), Version: version}, nil
+	}
+
+	previous := aws.ToString(current.FunctionVersion)
+	release := &Release{AliasArn: aws.ToString(current.AliasArn), Version: version, PreviousVersion: previous}
+	if previous == version {
+		progress.Printf("Alias %s already points at version %s\n", alias, version)
+		return release, nil
+	}
+
+	for _, weight := range weights {
+		if weight == 100 {
+			break
+		}
+		_, err := client.UpdateAlias(context.Background(), &lambda.UpdateAliasInput{
+			FunctionName:    aws.String(functionName),
+			Name:            aws.String(alias),
+			FunctionVersion: aws.String(previous),
+			RoutingConfig: &types.AliasRoutingConfiguration{
+				AdditionalVersionWeights: map[string]float64{version: float64(weight) / 100},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to route %d%% of %s to version %s: %v", weight, alias, version, err)
+		}
+		progress.Printf("Alias %s: %d%% to version %s, %d%% to version %s; holding for %s\n", alias, weight, version, 100-weight, previous, interval)
+		time.Sleep(interval)
+
+		if check != nil {
+			if err := check(); err != nil {
+				canaryErr := &CanaryError{Weight: weight, Version: version, PreviousVersion: previous, Err: err}
+				if _, canaryErr.RollbackErr = Rollback(client, functionName, alias, previous); canaryErr.RollbackErr == nil {
+					progress.Printf("Alias %s: canary failed, 100%% back to version %s\n", alias, previous)
+				}
+				return nil, canaryErr
+			}
+		}
+	}
+
+	if err := pointAlias(client, functionName, alias, version); err != nil {
+		return nil, err
+	}
+	progress.Printf("Alias %s: 100%% to version %s\n", alias, version)
+	return release, nil
+}
+
+// Rollback points the alias back at toVersion, clearing any canary routing. With an
+// empty toVersion it picks the newest published version older than the current one.
+func Rollback(client lambdaClient, functionName, alias, toVersion string) (*Release, error) {
+	current, err := client.GetAlias(context.Background(), &lambda.GetAliasInput{
+		FunctionName: aws.String(functionName),
+		Name:         aws.String(alias),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alias %s: %v", alias, err)
+	}
+	from := aws.ToString(current.FunctionVersion)
+
+	if toVersion == "" {
+		toVersion, err = versionBefore(client, functionName, from)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pointAlias(client, functionName, alias, toVersion); err != nil {
+		return nil, err
+	}
+	progress.Printf("Rolled back alias %s from version %s to version %s\n", alias, from, toVersion)
+	return &Release{AliasArn: aws.ToString(current.AliasArn), Version: toVersion, PreviousVersion: from}, nil
+}
+
+// AliasServes reports whether alias sends all its traffic to a version with the code hash
+// and the configuration cfg asks for, so there is nothing to publish. $LATEST can match
+// while the alias does not, e.g. when an earlier deploy failed before its release.
+func AliasServes(client lambdaClient, cfg *FunctionConfig, alias, hash string) (bool, error) {
+	current, err := client.GetAlias(context.Background(), &lambda.GetAliasInput{
+		FunctionName: aws.String(cfg.FunctionName),
+		Name:         aws.String(alias),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get alias %s: %v", alias, err)
+	}
+	// A canary still in progress splits the traffic
+	if current.RoutingConfig != nil && len(current.RoutingConfig.AdditionalVersionWeights) > 0 {
+		return false, nil
+	}
+
+	version, err := client.GetFunction(context.Background(), &lambda.GetFunctionInput{
+		FunctionName: aws.String(cfg.FunctionName),
+		Qualifier:    current.FunctionVersion,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get version %s: %v", aws.ToString(current.FunctionVersion), err)
+	}
+	return aws.ToString(version.Configuration.CodeSha256) == hash && len(Diff(version.Configuration, cfg)) == 0, nil
+}
+
+func pointAlias(client lambdaClient, functionName, alias, version string) error {
+	_, err := client.UpdateAlias(context.Background(), &lambda.UpdateAliasInput{
+		FunctionName:    aws.String(functionName),
+		Name:            aws.String(alias),
+		FunctionVersion: aws.String(version),
+		// An empty weight map removes the canary routing
+		RoutingConfig: &types.AliasRoutingConfiguration{
+			AdditionalVersionWeights: map[string]float64{},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to point alias %s at version %s: %v", alias, version, err)
+	}
+	return nil
+}
+
+// versionBefore returns the newest published version lower than version.
+func versionBefore(client lambdaClient, functionName, version string) (string, error) {
+	current, err := strconv.Atoi(version)
+	if err != nil {
+		return "", fmt.Errorf("alias points at %s, which is not a published version", version)
+	}
+
+	var versions []int
+	paginator := lambda.NewListVersionsByFunctionPaginator(client, &lambda.ListVersionsByFunctionInput{
+		FunctionName: aws.String(functionName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return "", fmt.Errorf("failed to list versions: %v", err)
+		}
+		for _, fn := range page.Versions {
+			// $LATEST does not parse and is skipped
+			if v, err := strconv.Atoi(aws.ToString(fn.Version)); err == nil && v < current {
+				versions = append(versions, v)
+			}
+		}
+	}
+	if len(versions) == 0 {
+		return "", fmt.Errorf("no version older than %s to roll back to", version)
+	}
+	sort.Ints(versions)
+	return strconv.Itoa(versions[len(versions)-1]), nil
+}
@@ -0,0 +1,128 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWeights(t *testing.T) {
+	weights, err := ParseWeights("10,50")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{10, 50, 100}, weights)
+
+	weights, err = ParseWeights("")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{100}, weights)
+
+	_, err = ParseWeights("50,10")
+	assert.Error(t, err)
+
+	_, err = ParseWeights("0")
+	assert.Error(t, err)
+}
+
+func TestShiftTraffic(t *testing.T) {
+	t.Run("alias created on first deploy", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		release, err := ShiftTraffic(client, "fn", DefaultAlias, "1", []int{10, 100}, 0, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", client.aliases[DefaultAlias])
+		assert.Equal(t, "", release.PreviousVersion)
+		assert.Equal(t, "arn:aws:lambda:us-east-1:123456789012:function:fn:live", release.AliasArn)
+	})
+
+	t.Run("canary then full shift", func(t *testing.T) {
+		client := &mockLambdaClient{aliases: map[string]string{DefaultAlias: "3"}}
+		release, err := ShiftTraffic(client, "fn", DefaultAlias, "4", []int{10, 100}, 0, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "3", release.PreviousVersion)
+		assert.Len(t, client.aliasUpdates, 2)
+
+		canary := client.aliasUpdates[0]
+		assert.Equal(t, "3", *canary.FunctionVersion)
+		assert.Equal(t, map[string]float64{"4": 0.1}, canary.RoutingConfig.AdditionalVersionWeights)
+
+		final := client.aliasUpdates[1]
+		assert.Equal(t, "4", *final.FunctionVersion)
+		assert.Empty(t, final.RoutingConfig.AdditionalVersionWeights)
+	})
+
+	t.Run("failed canary check stops the shift", func(t *testing.T) {
+		client := &mockLambdaClient{aliases: map[string]string{DefaultAlias: "3"}}
+		checks := 0
+		_, err := ShiftTraffic(client, "fn", DefaultAlias, "4", []int{10, 50, 100}, 0, func() error {
+			checks++
+			if checks == 2 {
+				return fmt.Errorf("smoke test failed")
+			}
+			return nil
+		})
+		var canaryErr *CanaryError
+		assert.True(t, errors.As(err, &canaryErr))
+		assert.Equal(t, 50, canaryErr.Weight)
+		assert.Equal(t, "3", canaryErr.PreviousVersion)
+		assert.NoError(t, canaryErr.RollbackErr)
+
+		// Routed 10%, then 50%, then rolled back with the routing cleared
+		assert.Len(t, client.aliasUpdates, 3)
+		assert.Equal(t, "3", client.aliases[DefaultAlias])
+		assert.Empty(t, client.aliasUpdates[2].RoutingConfig.AdditionalVersionWeights)
+	})
+
+	t.Run("alias already at version", func(t *testing.T) {
+		client := &mockLambdaClient{aliases: map[string]string{DefaultAlias: "4"}}
+		_, err := ShiftTraffic(client, "fn", DefaultAlias, "4", []int{100}, 0, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, client.aliasUpdates)
+	})
+}
+
+func TestAliasServes(t *testing.T) {
+	cfg := &FunctionConfig{FunctionName: "myfunction"}
+
+	t.Run("no alias yet", func(t *testing.T) {
+		served, err := AliasServes(&mockLambdaClient{}, cfg, DefaultAlias, "hash")
+		assert.NoError(t, err)
+		assert.False(t, served)
+	})
+
+	t.Run("alias serves the package", func(t *testing.T) {
+		client := &mockLambdaClient{aliases: map[string]string{DefaultAlias: "3"}, codeHashes: map[string]string{"3": "hash"}}
+		served, err := AliasServes(client, cfg, DefaultAlias, "hash")
+		assert.NoError(t, err)
+		assert.True(t, served)
+	})
+
+	t.Run("only $LATEST has the package", func(t *testing.T) {
+		client := &mockLambdaClient{aliases: map[string]string{DefaultAlias: "3"}, codeHashes: map[string]string{"$LATEST": "hash", "3": "old"}}
+		served, err := AliasServes(client, cfg, DefaultAlias, "hash")
+		assert.NoError(t, err)
+		assert.False(t, served)
+	})
+}
+
+func TestRollback(t *testing.T) {
+	t.Run("to the previous published version", func(t *testing.T) {
+		client := &mockLambdaClient{aliases: map[string]string{DefaultAlias: "3"}, versions: []string{"1", "2", "3"}}
+		release, err := Rollback(client, "fn", DefaultAlias, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "2", release.Version)
+		assert.Equal(t, "2", client.aliases[DefaultAlias])
+	})
+
+	t.Run("to an explicit version", func(t *testing.T) {
+		client := &mockLambdaClient{aliases: map[string]string{DefaultAlias: "3"}, versions: []string{"1", "2", "3"}}
+		_, err := Rollback(client, "fn", DefaultAlias, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", client.aliases[DefaultAlias])
+	})
+
+	t.Run("nothing to roll back to", func(t *testing.T) {
+		client := &mockLambdaClient{aliases: map[string]string{DefaultAlias: "1"}, versions: []string{"1"}}
+		_, err := Rollback(client, "fn", DefaultAlias, "")
+		assert.Error(t, err)
+	})
+}
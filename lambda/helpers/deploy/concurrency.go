@@ -0,0 +1,143 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+
+	"setup/helpers/progress"
+)
+
+// provisionedTimeout bounds how long the deployer waits for provisioned concurrency to
+// be allocated; large allocations take several minutes.
+const provisionedTimeout = 15 * time.Minute
+
+// provisionedPollInterval is how often the allocation status is checked.
+var provisionedPollInterval = 10 * time.Second
+
+// ApplyReservedConcurrency sets or removes the function's reserved concurrency to match
+// cfg. It does nothing when cfg.Concurrency is not set.
+func ApplyReservedConcurrency(client lambdaClient, cfg *FunctionConfig) error {
+	if cfg.Concurrency == nil {
+		return nil
+	}
+	desired := cfg.Concurrency.Reserved
+
+	current, err := client.GetFunctionConcurrency(context.Background(), &lambda.GetFunctionConcurrencyInput{
+		FunctionName: aws.String(cfg.FunctionName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get reserved concurrency: %v", err)
+	}
+	if equalInt32(current.ReservedConcurrentExecutions, desired) {
+		return nil
+	}
+
+	if desired == nil {
+		_, err = client.DeleteFunctionConcurrency(context.Background(), &lambda.DeleteFunctionConcurrencyInput{
+			FunctionName: aws.String(cfg.FunctionName),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove reserved concurrency: %v", err)
+		}
+		progress.Println("Reserved concurrency removed")
+		return nil
+	}
+
+	_, err = client.PutFunctionConcurrency(context.Background(), &lambda.PutFunctionConcurrencyInput{
+		FunctionName:                 aws.String(cfg.FunctionName),
+		ReservedConcurrentExecutions: desired,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reserve %d concurrent executions: %v", *desired, err)
+	}
+	progress.Printf("Reserved concurrency set to %d\n", *desired)
+	return nil
+}
+
+// ApplyProvisionedConcurrency sets or removes provisioned concurrency on the alias to
+// match cfg, and waits until it is READY. It does nothing when cfg.Concurrency is not
+// set. Moving the alias to a new version reallocates provisioned concurrency, so it is
+// applied, and waited for, after every shift.
+func ApplyProvisionedConcurrency(client lambdaClient, cfg *FunctionConfig, alias string) error {
+	if cfg.Concurrency == nil {
+		return nil
+	}
+	desired := cfg.Concurrency.Provisioned
+
+	current, err := client.GetProvisionedConcurrencyConfig(context.Background(), &lambda.GetProvisionedConcurrencyConfigInput{
+		FunctionName: aws.String(cfg.FunctionName),
+		Qualifier:    aws.String(alias),
+	})
+	if err != nil && !strings.Contains(err.Error(), "ProvisionedConcurrencyConfigNotFoundException") {
+		return fmt.Errorf("failed to get provisioned concurrency of alias %s: %v", alias, err)
+	}
+
+	if desired == 0 {
+		if current == nil {
+			return nil
+		}
+		_, err = client.DeleteProvisionedConcurrencyConfig(context.Background(), &lambda.DeleteProvisionedConcurrencyConfigInput{
+			FunctionName: aws.String(cfg.FunctionName),
+			Qualifier:    aws.String(alias),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove provisioned concurrency from alias %s: %v", alias, err)
+		}
+		progress.Printf("Provisioned concurrency removed from alias %s\n", alias)
+		return nil
+	}
+
+	if current == nil || aws.ToInt32(current.RequestedProvisionedConcurrentExecutions) != desired {
+		_, err = client.PutProvisionedConcurrencyConfig(context.Background(), &lambda.PutProvisionedConcurrencyConfigInput{
+			FunctionName:                    aws.String(cfg.FunctionName),
+			Qualifier:                       aws.String(alias),
+			ProvisionedConcurrentExecutions: aws.Int32(desired),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to provision %d concurrent executions on alias %s: %v", desired, alias, err)
+		}
+		progress.Printf("Provisioning %d concurrent executions on alias %s\n", desired, alias)
+	}
+	return WaitUntilProvisioned(client, cfg.FunctionName, alias)
+}
+
+// WaitUntilProvisioned waits until the provisioned concurrency of the alias is READY.
+func WaitUntilProvisioned(client lambdaClient, functionName, alias string) error {
+	deadline := time.Now().Add(provisionedTimeout)
+	for {
+		current, err := client.GetProvisionedConcurrencyConfig(context.Background(), &lambda.GetProvisionedConcurrencyConfigInput{
+			FunctionName: aws.String(functionName),
+			Qualifier:    aws.String(alias),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get provisioned concurrency of alias %s: %v", alias, err)
+		}
+
+		switch current.Status {
+		case types.ProvisionedConcurrencyStatusEnumReady:
+			progress.Printf("Provisioned concurrency on alias %s is READY (%d available)\n", alias, aws.ToInt32(current.AvailableProvisionedConcurrentExecutions))
+			return nil
+		case types.ProvisionedConcurrencyStatusEnumFailed:
+			return fmt.Errorf("provisioned concurrency on alias %s failed: %s", alias, aws.ToString(current.StatusReason))
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("provisioned concurrency on alias %s not READY after %s (%d of %d allocated)", alias, provisionedTimeout,
+				aws.ToInt32(current.AllocatedProvisionedConcurrentExecutions), aws.ToInt32(current.RequestedProvisionedConcurrentExecutions))
+		}
+		time.Sleep(provisionedPollInterval)
+	}
+}
+
+func equalInt32(a, b *int32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
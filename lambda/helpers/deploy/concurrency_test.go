@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyReservedConcurrency(t *testing.T) {
+	t.Run("unmanaged", func(t *testing.T) {
+		client := &mockLambdaClient{reserved: aws.Int32(10)}
+		assert.NoError(t, ApplyReservedConcurrency(client, testConfig()))
+		assert.Empty(t, client.calls)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		cfg := testConfig()
+		cfg.Concurrency = &ConcurrencyConfig{Reserved: aws.Int32(20)}
+		assert.NoError(t, ApplyReservedConcurrency(client, cfg))
+		assert.Equal(t, int32(20), aws.ToInt32(client.reserved))
+
+		// Already at the desired value
+		client.calls = nil
+		assert.NoError(t, ApplyReservedConcurrency(client, cfg))
+		assert.Empty(t, client.calls)
+	})
+
+	t.Run("zero is a reservation", func(t *testing.T) {
+		client := &mockLambdaClient{reserved: aws.Int32(20)}
+		cfg := testConfig()
+		cfg.Concurrency = &ConcurrencyConfig{Reserved: aws.Int32(0)}
+		assert.NoError(t, ApplyReservedConcurrency(client, cfg))
+		assert.Equal(t, []string{"PutFunctionConcurrency"}, client.calls)
+		assert.Equal(t, int32(0), aws.ToInt32(client.reserved))
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		client := &mockLambdaClient{reserved: aws.Int32(20)}
+		cfg := testConfig()
+		cfg.Concurrency = &ConcurrencyConfig{}
+		assert.NoError(t, ApplyReservedConcurrency(client, cfg))
+		assert.Equal(t, []string{"DeleteFunctionConcurrency"}, client.calls)
+		assert.Nil(t, client.reserved)
+	})
+}
+
+func TestApplyProvisionedConcurrency(t *testing.T) {
+	provisionedPollInterval = 0
+
+	t.Run("provisioned and ready", func(t *testing.T) {
+		client := &mockLambdaClient{provisionedStatuses: []types.ProvisionedConcurrencyStatusEnum{
+			types.ProvisionedConcurrencyStatusEnumInProgress,
+			types.ProvisionedConcurrencyStatusEnumInProgress,
+		}}
+		cfg := testConfig()
+		cfg.Concurrency = &ConcurrencyConfig{Provisioned: 5}
+		assert.NoError(t, ApplyProvisionedConcurrency(client, cfg, "live"))
+		assert.Equal(t, []string{"PutProvisionedConcurrencyConfig:live"}, client.calls)
+		assert.Empty(t, client.provisionedStatuses)
+	})
+
+	t.Run("unchanged still waits for READY", func(t *testing.T) {
+		// A shifted alias reallocates its provisioned concurrency
+		client := &mockLambdaClient{provisioned: 5, provisionedStatuses: []types.ProvisionedConcurrencyStatusEnum{
+			types.ProvisionedConcurrencyStatusEnumInProgress,
+			types.ProvisionedConcurrencyStatusEnumInProgress,
+		}}
+		cfg := testConfig()
+		cfg.Concurrency = &ConcurrencyConfig{Provisioned: 5}
+		assert.NoError(t, ApplyProvisionedConcurrency(client, cfg, "live"))
+		assert.Empty(t, client.calls)
+		assert.Empty(t, client.provisionedStatuses)
+	})
+
+	t.Run("allocation failed", func(t *testing.T) {
+		client := &mockLambdaClient{provisionedStatuses: []types.ProvisionedConcurrencyStatusEnum{
+			types.ProvisionedConcurrencyStatusEnumFailed,
+		}}
+		cfg := testConfig()
+		cfg.Concurrency = &ConcurrencyConfig{Provisioned: 5}
+		assert.ErrorContains(t, ApplyProvisionedConcurrency(client, cfg, "live"), "FUNCTION_ERROR_INIT_FAILURE")
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		client := &mockLambdaClient{provisioned: 5}
+		cfg := testConfig()
+		cfg.Concurrency = &ConcurrencyConfig{Reserved: aws.Int32(10)}
+		assert.NoError(t, ApplyProvisionedConcurrency(client, cfg, "live"))
+		assert.Equal(t, []string{"DeleteProvisionedConcurrencyConfig:live"}, client.calls)
+
+		// Nothing left to remove
+		client.calls = nil
+		assert.NoError(t, ApplyProvisionedConcurrency(client, cfg, "live"))
+		assert.Empty(t, client.calls)
+	})
+}
+
+func TestValidateConcurrency(t *testing.T) {
+	cfg := testConfig()
+	cfg.Concurrency = &ConcurrencyConfig{Reserved: aws.Int32(-1)}
+	assert.ErrorContains(t, cfg.Validate(), "must not be negative")
+
+	cfg.Concurrency = &ConcurrencyConfig{Reserved: aws.Int32(5), Provisioned: 10}
+	assert.ErrorContains(t, cfg.Validate(), "cannot exceed")
+
+	cfg.Concurrency = &ConcurrencyConfig{Reserved: aws.Int32(10), Provisioned: 10}
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,283 @@
+// Package deploy creates and updates the Lambda function from a JSON configuration.
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+
+	"lambdax/helpers/packaging"
+)
+
+// FunctionConfig is the desired configuration of the function, read from function.json.
+// Zero values are left unmanaged: the deployer neither sends nor diffs them.
+type FunctionConfig struct {
+	FunctionName string `json:"functionName"`
+	Description  string `json:"description,omitempty"`
+	Role         string `json:"role,omitempty"`
+	// ExecutionRole has the deployer create or update the role instead of using Role.
+	ExecutionRole *ExecutionRoleConfig `json:"executionRole,omitempty"`
+	Handler       string               `json:"handler,omitempty"`
+	Runtime       string               `json:"runtime,omitempty"`
+	// Architecture is a GOARCH: amd64 or arm64.
+	Architecture string `json:"architecture,omitempty"`
+	// PackageType is Zip (the default) or Image. Images are pushed to ImageRepository in
+	// ECR; handler, runtime and layers do not apply to them.
+	PackageType     string `json:"packageType,omitempty"`
+	ImageRepository string `json:"imageRepository,omitempty"`
+
+	MemorySize       int32 `json:"memorySize,omitempty"`
+	Timeout          int32 `json:"timeout,omitempty"`
+	EphemeralStorage int32 `json:"ephemeralStorage,omitempty"`
+
+	// Environment replaces all variables when set; an empty object clears them.
+	Environment map[string]string `json:"environment,omitempty"`
+	Vpc         *VpcConfig        `json:"vpc,omitempty"`
+	Logging     *LoggingConfig    `json:"logging,omitempty"`
+
+	// Layers are referenced by name and resolved to version ARNs at deploy time. An
+	// empty list removes all layers.
+	Layers []LayerConfig `json:"layers,omitempty"`
+	// LayerArns are the resolved Layers, in order; set by ResolveLayers.
+	LayerArns []string `json:"-"`
+	// SwitchArchitecture allows an update to move an existing function to Architecture;
+	// set from -switch-arch.
+	SwitchArchitecture bool `json:"-"`
+
+	// Concurrency, when set, is managed as a whole: reserved and provisioned
+	// concurrency left out are removed.
+	Concurrency *ConcurrencyConfig `json:"concurrency,omitempty"`
+}
+
+// VpcConfig attaches the function to subnets; empty lists detach it from the VPC.
+type VpcConfig struct {
+	SubnetIds        []string `json:"subnetIds"`
+	SecurityGroupIds []string `json:"securityGroupIds"`
+}
+
+// ExecutionRoleConfig names the execution role and scopes its inline policy to the
+// resources the handler touches.
+type ExecutionRoleConfig struct {
+	RoleName string `json:"roleName"`
+	// ParameterPath is the SSM parameter, or a pattern ending in *, the handler writes:
+	// the repository name, or PARAMETER_PREFIX and the repository name when the
+	// environment sets a prefix.
+	ParameterPath string `json:"parameterPath"`
+	// SecretID is the secret holding the MongoDB credentials.
+	SecretID string `json:"secretId,omitempty"`
+}
+
+// LayerConfig references a layer by name, or by version ARN for layers owned by
+// other accounts.
+type LayerConfig struct {
+	Name string `json:"name"`
+	// Version pins a layer version; 0 means the latest.
+	Version int64 `json:"version,omitempty"`
+	// Dir, when set, is published as a new layer version whenever its contents change.
+	Dir string `json:"dir,omitempty"`
+}
+
+// ConcurrencyConfig caps and pre-warms the function. Reserved concurrency also caps
+// how many MongoDB connections the handler's instances open at once.
+type ConcurrencyConfig struct {
+	// Reserved is the function's reserved concurrency; 0 throttles every invocation.
+	Reserved *int32 `json:"reserved,omitempty"`
+	// Provisioned is the provisioned concurrency on the alias traffic goes to.
+	Provisioned int32 `json:"provisioned,omitempty"`
+}
+
+// LoggingConfig selects the log format and levels of the function's logs.
+type LoggingConfig struct {
+	LogFormat           string `json:"logFormat,omitempty"`
+	ApplicationLogLevel string `json:"applicationLogLevel,omitempty"`
+	SystemLogLevel      string `json:"systemLogLevel,omitempty"`
+	LogGroup            string `json:"logGroup,omitempty"`
+}
+
+// Environment variables the handler reads its secret and parameter prefix from. The
+// secret is set from the execution role; the prefix is opt-in, since without it the
+// handler names the parameter after the repository.
+const (
+	SecretIDVariable        = "MONGO_SECRET_ID"
+	ParameterPrefixVariable = "PARAMETER_PREFIX"
+)
+
+// maxLayers is the number of layers Lambda allows per function.
+const maxLayers = 5
+
+var layerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,140}$`)
+
+// LoadConfig reads and validates the function configuration.
+func LoadConfig(path string) (*FunctionConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read function configuration %s: %v", path, err)
+	}
+
+	var cfg FunctionConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse function configuration %s: %v", path, err)
+	}
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid function configuration %s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+func (c *FunctionConfig) applyDefaults() {
+	if c.Handler == "" {
+		c.Handler = packaging.BootstrapName
+	}
+	if c.Runtime == "" {
+		c.Runtime = string(types.RuntimeProvidedal2)
+	}
+	if c.Architecture == "" {
+		c.Architecture = "amd64"
+	}
+	if c.PackageType == "" {
+		c.PackageType = string(types.PackageTypeZip)
+	}
+	if c.ExecutionRole != nil && c.ExecutionRole.SecretID == "" {
+		c.ExecutionRole.SecretID = "myApp/mongo-db-credentials"
+	}
+
+	// Tell the handler the secret its role allows, unless set by hand
+	if c.ExecutionRole != nil {
+		if c.Environment == nil {
+			c.Environment = map[string]string{}
+		}
+		if _, ok := c.Environment[SecretIDVariable]; !ok {
+			c.Environment[SecretIDVariable] = c.ExecutionRole.SecretID
+		}
+	}
+}
+
+// Validate checks the values Lambda would otherwise reject mid-deploy.
+func (c *FunctionConfig) Validate() error {
+	if c.FunctionName == "" {
+		return fmt.Errorf("functionName is required")
+	}
+	if c.Role == "" && c.ExecutionRole == nil {
+		return fmt.Errorf("role or executionRole is required")
+	}
+	if c.ExecutionRole != nil && (c.ExecutionRole.RoleName == "" || c.ExecutionRole.ParameterPath == "") {
+		return fmt.Errorf("executionRole needs roleName and parameterPath")
+	}
+	if prefix, ok := c.Environment[ParameterPrefixVariable]; ok && c.ExecutionRole != nil {
+		if !strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") {
+			return fmt.Errorf("environment.%s %q must be a path like /myApp/image-tags/", ParameterPrefixVariable, prefix)
+		}
+		if c.ExecutionRole.ParameterPath != prefix+"*" {
+			return fmt.Errorf("executionRole.parameterPath %q does not cover environment.%s; use %q", c.ExecutionRole.ParameterPath, ParameterPrefixVariable, prefix+"*")
+		}
+	}
+	if c.Runtime != string(types.RuntimeProvidedal2) && c.Runtime != string(types.RuntimeProvidedal2023) {
+		return fmt.Errorf("runtime %q is not supported, use provided.al2 or provided.al2023", c.Runtime)
+	}
+	if _, err := packaging.LambdaArchitecture(c.Architecture); err != nil {
+		return err
+	}
+	if c.MemorySize != 0 && (c.MemorySize < 128 || c.MemorySize > 10240) {
+		return fmt.Errorf("memorySize must be between 128 and 10240 MB")
+	}
+	if c.Timeout != 0 && (c.Timeout < 1 || c.Timeout > 900) {
+		return fmt.Errorf("timeout must be between 1 and 900 seconds")
+	}
+	if c.EphemeralStorage != 0 && (c.EphemeralStorage < 512 || c.EphemeralStorage > 10240) {
+		return fmt.Errorf("ephemeralStorage must be between 512 and 10240 MB")
+	}
+	switch types.PackageType(c.PackageType) {
+	case types.PackageTypeZip:
+	case types.PackageTypeImage:
+		if c.ImageRepository == "" {
+			return fmt.Errorf("packageType Image needs imageRepository")
+		}
+		if len(c.Layers) > 0 {
+			return fmt.Errorf("layers cannot be used with packageType Image; add the files to the image instead")
+		}
+	default:
+		return fmt.Errorf("packageType %q must be Zip or Image", c.PackageType)
+	}
+	if len(c.Layers) > maxLayers {
+		return fmt.Errorf("a function can use at most %d layers, got %d", maxLayers, len(c.Layers))
+	}
+	for _, layer := range c.Layers {
+		if strings.HasPrefix(layer.Name, "arn:") {
+			if layer.Version != 0 || layer.Dir != "" {
+				return fmt.Errorf("layer %s: a layer ARN already names its version and cannot be published", layer.Name)
+			}
+			continue
+		}
+		if !layerNamePattern.MatchString(layer.Name) {
+			return fmt.Errorf("layer name %q must be 1-140 characters of letters, digits, '-' or '_'", layer.Name)
+		}
+		if layer.Dir != "" && layer.Version != 0 {
+			return fmt.Errorf("layer %s: a published layer always uses its latest version, drop version or dir", layer.Name)
+		}
+	}
+	if c.Concurrency != nil {
+		reserved, provisioned := c.Concurrency.Reserved, c.Concurrency.Provisioned
+		if reserved != nil && *reserved < 0 {
+			return fmt.Errorf("concurrency.reserved must not be negative")
+		}
+		if provisioned < 0 {
+			return fmt.Errorf("concurrency.provisioned must not be negative")
+		}
+		if reserved != nil && provisioned > *reserved {
+			return fmt.Errorf("concurrency.provisioned (%d) cannot exceed concurrency.reserved (%d)", provisioned, *reserved)
+		}
+	}
+	if c.Logging != nil && c.Logging.LogFormat != "" && c.Logging.LogFormat != string(types.LogFormatJson) && c.Logging.LogFormat != string(types.LogFormatText) {
+		return fmt.Errorf("logging.logFormat must be JSON or Text")
+	}
+	return nil
+}
+
+// LambdaArchitecture returns the Lambda architecture of the configured GOARCH.
+func (c *FunctionConfig) LambdaArchitecture() types.Architecture {
+	arch, _ := packaging.LambdaArchitecture(c.Architecture)
+	return types.Architecture(arch)
+}
+
+// DeployedArchitecture returns the architecture a deployed function runs on; Lambda
+// reports none for functions created before arm64 existed, which run on x86_64.
+func DeployedArchitecture(current *types.FunctionConfiguration) types.Architecture {
+	if len(current.Architectures) == 0 {
+		return types.ArchitectureX8664
+	}
+	return current.Architectures[0]
+}
+
+// CheckArchitecture refuses to move a deployed function to another architecture unless
+// SwitchArchitecture is set, since UpdateFunctionCode switches it along with the code.
+func (c *FunctionConfig) CheckArchitecture(current *types.FunctionConfiguration) error {
+	deployed := DeployedArchitecture(current)
+	if deployed == c.LambdaArchitecture() || c.SwitchArchitecture {
+		return nil
+	}
+	return fmt.Errorf("function %s runs on %s but is configured for %s; deploy with -switch-arch to move it", c.FunctionName, deployed, c.LambdaArchitecture())
+}
+
+// LambdaPackageType returns the configured package type.
+func (c *FunctionConfig) LambdaPackageType() types.PackageType {
+	return types.PackageType(c.PackageType)
+}
+
+// IsImage reports whether the function is deployed as a container image.
+func (c *FunctionConfig) IsImage() bool {
+	return c.LambdaPackageType() == types.PackageTypeImage
+}
+
+// LogGroupName returns the log group the function writes to: the configured one, or
+// Lambda's default /aws/lambda/<FunctionName>.
+func (c *FunctionConfig) LogGroupName() string {
+	if c.Logging != nil && c.Logging.LogGroup != "" {
+		return c.Logging.LogGroup
+	}
+	return "/aws/lambda/" + c.FunctionName
+}
@@ -0,0 +1,480 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/stretchr/testify/assert"
+
+	"lambdax/helpers/packaging"
+)
+
+func testConfig() *FunctionConfig {
+	cfg := &FunctionConfig{
+		FunctionName: "MyGoLambdaFunction",
+		Description:  "Stores ECR image tags",
+		Role:         "arn:aws:iam::123456789012:role/lambda-exec",
+		MemorySize:   256,
+		Timeout:      30,
+		Environment:  map[string]string{"LOG_LEVEL": "debug", "TOKEN": "new"},
+		Logging:      &LoggingConfig{LogFormat: "JSON"},
+	}
+	cfg.applyDefaults()
+	return cfg
+}
+
+func deployedConfig() *types.FunctionConfiguration {
+	return &types.FunctionConfiguration{
+		Description: aws.String("Stores ECR image tags"),
+		Role:        aws.String("arn:aws:iam::123456789012:role/lambda-exec"),
+		Handler:     aws.String("bootstrap"),
+		Runtime:     types.RuntimeProvidedal2,
+		MemorySize:  aws.Int32(128),
+		Timeout:     aws.Int32(30),
+		Environment: &types.EnvironmentResponse{Variables: map[string]string{"TOKEN": "old", "STALE": "1"}},
+		LoggingConfig: &types.LoggingConfig{
+			LogFormat: types.LogFormatText,
+		},
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("defaults applied", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "function.json")
+		os.WriteFile(path, []byte(`{"functionName":"fn","role":"arn:aws:iam::123456789012:role/r"}`), 0o644)
+
+		cfg, err := LoadConfig(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "bootstrap", cfg.Handler)
+		assert.Equal(t, "provided.al2", cfg.Runtime)
+		assert.Equal(t, types.ArchitectureX8664, cfg.LambdaArchitecture())
+	})
+
+	t.Run("invalid values rejected", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "function.json")
+		os.WriteFile(path, []byte(`{"functionName":"fn","role":"r","timeout":901}`), 0o644)
+
+		_, err := LoadConfig(path)
+		assert.ErrorContains(t, err, "timeout")
+	})
+
+	t.Run("execution role instead of role", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "function.json")
+		os.WriteFile(path, []byte(`{"functionName":"fn","executionRole":{"roleName":"fn-exec","parameterPath":"my-app-repo"}}`), 0o644)
+
+		cfg, err := LoadConfig(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "myApp/mongo-db-credentials", cfg.ExecutionRole.SecretID)
+		assert.Equal(t, "myApp/mongo-db-credentials", cfg.Environment[SecretIDVariable])
+		_, prefixed := cfg.Environment[ParameterPrefixVariable]
+		assert.False(t, prefixed, "the parameter prefix is opt-in")
+
+		// A prefix set in the environment must be what the policy covers
+		os.WriteFile(path, []byte(`{"functionName":"fn","environment":{"PARAMETER_PREFIX":"/myApp/image-tags/"},"executionRole":{"roleName":"fn-exec","parameterPath":"/myApp/image-tags/*"}}`), 0o644)
+		_, err = LoadConfig(path)
+		assert.NoError(t, err)
+
+		os.WriteFile(path, []byte(`{"functionName":"fn","environment":{"PARAMETER_PREFIX":"/myApp/image-tags/"},"executionRole":{"roleName":"fn-exec","parameterPath":"my-app-repo"}}`), 0o644)
+		_, err = LoadConfig(path)
+		assert.ErrorContains(t, err, "does not cover environment.PARAMETER_PREFIX")
+
+		os.WriteFile(path, []byte(`{"functionName":"fn","environment":{"PARAMETER_PREFIX":"myApp"},"executionRole":{"roleName":"fn-exec","parameterPath":"myApp*"}}`), 0o644)
+		_, err = LoadConfig(path)
+		assert.ErrorContains(t, err, "must be a path")
+
+		os.WriteFile(path, []byte(`{"functionName":"fn"}`), 0o644)
+		_, err = LoadConfig(path)
+		assert.ErrorContains(t, err, "role or executionRole is required")
+	})
+}
+
+func TestDiff(t *testing.T) {
+	changes := Diff(deployedConfig(), testConfig())
+
+	var fields []string
+	for _, change := range changes {
+		fields = append(fields, change.String())
+	}
+	assert.Equal(t, []string{
+		`memorySize: "128" -> "256"`,
+		`environment.LOG_LEVEL: <unset> -> <set>`,
+		`environment.STALE: <set> -> <unset>`,
+		`environment.TOKEN: <old value> -> <new value>`,
+		`logging.logFormat: "Text" -> "JSON"`,
+	}, fields)
+
+	// Fields left out of the configuration are not managed
+	cfg := testConfig()
+	cfg.MemorySize, cfg.Environment, cfg.Logging = 0, nil, nil
+	cfg.Description, cfg.Role = "", ""
+	assert.Empty(t, Diff(deployedConfig(), cfg))
+}
+
+func TestCreateFunction(t *testing.T) {
+	client := &mockLambdaClient{}
+	result, err := CreateFunction(client, testConfig(), Code{ZipFile: []byte("zip")})
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws:lambda:us-east-1:123456789012:function:MyGoLambdaFunction", result.FunctionArn)
+
+	input := client.created
+	assert.Equal(t, int32(256), aws.ToInt32(input.MemorySize))
+	assert.Equal(t, []types.Architecture{types.ArchitectureX8664}, input.Architectures)
+	assert.Equal(t, types.LogFormatJson, input.LoggingConfig.LogFormat)
+	assert.Nil(t, input.VpcConfig)
+}
+
+func TestUpdateFunction(t *testing.T) {
+	t.Run("configuration drift applied", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		result, err := UpdateFunction(client, testConfig(), deployedConfig(), Code{ZipFile: []byte("zip")})
+		assert.NoError(t, err)
+		assert.Len(t, result.Changes, 5)
+		assert.Equal(t, []string{"UpdateFunctionCode", "UpdateFunctionConfiguration"}, client.calls)
+		assert.Equal(t, map[string]string{"LOG_LEVEL": "debug", "TOKEN": "new"}, client.configured.Environment.Variables)
+	})
+
+	t.Run("configuration unchanged", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		cfg := testConfig()
+		cfg.MemorySize, cfg.Environment, cfg.Logging = 0, nil, nil
+		result, err := UpdateFunction(client, cfg, deployedConfig(), Code{ZipFile: []byte("zip")})
+		assert.NoError(t, err)
+		assert.Empty(t, result.Changes)
+		assert.Equal(t, []string{"UpdateFunctionCode"}, client.calls)
+		assert.False(t, result.Unchanged())
+	})
+
+	t.Run("unset description left alone", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		cfg := testConfig()
+		cfg.Description = ""
+		_, err := UpdateFunction(client, cfg, deployedConfig(), Code{ZipFile: []byte("zip")})
+		assert.NoError(t, err)
+		assert.Nil(t, client.configured.Description)
+	})
+
+	t.Run("code unchanged", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		cfg := testConfig()
+		cfg.MemorySize, cfg.Environment, cfg.Logging = 0, nil, nil
+		current := deployedConfig()
+		current.CodeSha256 = aws.String(packaging.Hash([]byte("zip")))
+		result, err := UpdateFunction(client, cfg, current, Code{ZipFile: []byte("zip")})
+		assert.NoError(t, err)
+		assert.Empty(t, client.calls)
+		assert.True(t, result.Unchanged())
+	})
+}
+
+func TestUpdateFunctionArchitecture(t *testing.T) {
+	client := &mockLambdaClient{}
+	cfg := testConfig()
+	cfg.Architecture = "arm64"
+
+	// The function was created before arm64 and reports no architecture
+	_, err := UpdateFunction(client, cfg, deployedConfig(), Code{ZipFile: []byte("zip")})
+	assert.ErrorContains(t, err, "runs on x86_64 but is configured for arm64")
+	assert.Empty(t, client.calls)
+
+	cfg.SwitchArchitecture = true
+	_, err = UpdateFunction(client, cfg, deployedConfig(), Code{ZipFile: []byte("zip")})
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Architecture{types.ArchitectureArm64}, client.codeUpdated.Architectures)
+}
+
+func TestDeleteFunction(t *testing.T) {
+	client := &mockLambdaClient{}
+
+	deleted, err := DeleteFunction(client, "MyGoLambdaFunction")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	// Deleting again finds nothing to delete
+	deleted, err = DeleteFunction(client, "MyGoLambdaFunction")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestImageFunction(t *testing.T) {
+	cfg := testConfig()
+	cfg.PackageType, cfg.ImageRepository = "Image", "my-go-lambda"
+	code := Code{ImageURI: "123456789012.dkr.ecr.us-east-1.amazonaws.com/my-go-lambda@sha256:abc", ImageDigest: "sha256:abc"}
+
+	t.Run("create", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		_, err := CreateFunction(client, cfg, code)
+		assert.NoError(t, err)
+		assert.Equal(t, types.PackageTypeImage, client.created.PackageType)
+		assert.Equal(t, code.ImageURI, aws.ToString(client.created.Code.ImageUri))
+		assert.Nil(t, client.created.Handler)
+		assert.Empty(t, client.created.Runtime)
+	})
+
+	t.Run("update skipped for the deployed digest", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		current := deployedConfig()
+		current.PackageType = types.PackageTypeImage
+		current.CodeSha256 = aws.String("abc")
+		result, err := UpdateFunction(client, cfg, current, code)
+		assert.NoError(t, err)
+		assert.False(t, result.CodeChanged)
+		assert.Nil(t, client.configured.Handler)
+	})
+
+	t.Run("package type cannot change", func(t *testing.T) {
+		current := deployedConfig()
+		current.PackageType = types.PackageTypeZip
+		_, err := UpdateFunction(&mockLambdaClient{}, cfg, current, code)
+		assert.ErrorContains(t, err, "cannot change it to Image")
+	})
+}
+
+type mockLambdaClient struct {
+	calls       []string
+	created     *lambda.CreateFunctionInput
+	codeUpdated *lambda.UpdateFunctionCodeInput
+	configured  *lambda.UpdateFunctionConfigurationInput
+
+	// aliases maps alias names to the version they point at
+	aliases      map[string]string
+	aliasUpdates []*lambda.UpdateAliasInput
+	versions     []string
+
+	// invoke answers Invoke calls; nil means every invocation succeeds
+	invoke  func(params *lambda.InvokeInput) *lambda.InvokeOutput
+	invoked []*lambda.InvokeInput
+
+	// layers maps layer names to the code hash of each version, version 1 first
+	layers        map[string][]string
+	deletedLayers []int64
+
+	// reserved is the function's reserved concurrency and provisioned the alias's
+	// provisioned concurrency; provisionedStatuses are reported in turn, then READY
+	reserved            *int32
+	provisioned         int32
+	provisionedStatuses []types.ProvisionedConcurrencyStatusEnum
+
+	deleted bool
+
+	// permissions maps statement IDs to the source ARN they allow
+	permissions map[string]string
+
+	// codeHashes maps versions to their CodeSha256
+	codeHashes map[string]string
+}
+
+func (m *mockLambdaClient) GetFunction(ctx context.Context, params *lambda.GetFunctionInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionOutput, error) {
+	return &lambda.GetFunctionOutput{
+		Configuration: &types.FunctionConfiguration{
+			FunctionName:     params.FunctionName,
+			CodeSha256:       aws.String(m.codeHashes[aws.ToString(params.Qualifier)]),
+			LastUpdateStatus: types.LastUpdateStatusSuccessful,
+		},
+	}, nil
+}
+
+func (m *mockLambdaClient) CreateFunction(ctx context.Context, params *lambda.CreateFunctionInput, optFns ...func(*lambda.Options)) (*lambda.CreateFunctionOutput, error) {
+	m.calls = append(m.calls, "CreateFunction")
+	m.created = params
+	return &lambda.CreateFunctionOutput{
+		FunctionArn: aws.String("arn:aws:lambda:us-east-1:123456789012:function:" + aws.ToString(params.FunctionName)),
+		Version:     aws.String("$LATEST"),
+	}, nil
+}
+
+func (m *mockLambdaClient) UpdateFunctionCode(ctx context.Context, params *lambda.UpdateFunctionCodeInput, optFns ...func(*lambda.Options)) (*lambda.UpdateFunctionCodeOutput, error) {
+	m.calls = append(m.calls, "UpdateFunctionCode")
+	m.codeUpdated = params
+	return &lambda.UpdateFunctionCodeOutput{
+		FunctionArn: aws.String("arn:aws:lambda:us-east-1:123456789012:function:" + aws.ToString(params.FunctionName)),
+		Version:     aws.String("$LATEST"),
+	}, nil
+}
+
+func (m *mockLambdaClient) UpdateFunctionConfiguration(ctx context.Context, params *lambda.UpdateFunctionConfigurationInput, optFns ...func(*lambda.Options)) (*lambda.UpdateFunctionConfigurationOutput, error) {
+	m.calls = append(m.calls, "UpdateFunctionConfiguration")
+	m.configured = params
+	return &lambda.UpdateFunctionConfigurationOutput{}, nil
+}
+
+func (m *mockLambdaClient) PublishVersion(ctx context.Context, params *lambda.PublishVersionInput, optFns ...func(*lambda.Options)) (*lambda.PublishVersionOutput, error) {
+	m.calls = append(m.calls, "PublishVersion")
+	version := fmt.Sprint(len(m.versions) + 1)
+	m.versions = append(m.versions, version)
+	return &lambda.PublishVersionOutput{Version: aws.String(version)}, nil
+}
+
+func (m *mockLambdaClient) ListVersionsByFunction(ctx context.Context, params *lambda.ListVersionsByFunctionInput, optFns ...func(*lambda.Options)) (*lambda.ListVersionsByFunctionOutput, error) {
+	output := &lambda.ListVersionsByFunctionOutput{
+		Versions: []types.FunctionConfiguration{{Version: aws.String("$LATEST")}},
+	}
+	for _, version := range m.versions {
+		output.Versions = append(output.Versions, types.FunctionConfiguration{Version: aws.String(version)})
+	}
+	return output, nil
+}
+
+func (m *mockLambdaClient) GetAlias(ctx context.Context, params *lambda.GetAliasInput, optFns ...func(*lambda.Options)) (*lambda.GetAliasOutput, error) {
+	version, ok := m.aliases[aws.ToString(params.Name)]
+	if !ok {
+		return nil, fmt.Errorf("ResourceNotFoundException: Cannot find alias")
+	}
+	return &lambda.GetAliasOutput{
+		AliasArn:        aws.String("arn:aws:lambda:us-east-1:123456789012:function:" + aws.ToString(params.FunctionName) + ":" + aws.ToString(params.Name)),
+		FunctionVersion: aws.String(version),
+	}, nil
+}
+
+func (m *mockLambdaClient) CreateAlias(ctx context.Context, params *lambda.CreateAliasInput, optFns ...func(*lambda.Options)) (*lambda.CreateAliasOutput, error) {
+	m.calls = append(m.calls, "CreateAlias")
+	if m.aliases == nil {
+		m.aliases = map[string]string{}
+	}
+	m.aliases[aws.ToString(params.Name)] = aws.ToString(params.FunctionVersion)
+	return &lambda.CreateAliasOutput{
+		AliasArn: aws.String("arn:aws:lambda:us-east-1:123456789012:function:" + aws.ToString(params.FunctionName) + ":" + aws.ToString(params.Name)),
+	}, nil
+}
+
+func (m *mockLambdaClient) UpdateAlias(ctx context.Context, params *lambda.UpdateAliasInput, optFns ...func(*lambda.Options)) (*lambda.UpdateAliasOutput, error) {
+	m.calls = append(m.calls, "UpdateAlias")
+	m.aliases[aws.ToString(params.Name)] = aws.ToString(params.FunctionVersion)
+	m.aliasUpdates = append(m.aliasUpdates, params)
+	return &lambda.UpdateAliasOutput{}, nil
+}
+
+func (m *mockLambdaClient) Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+	m.calls = append(m.calls, "Invoke")
+	m.invoked = append(m.invoked, params)
+	if m.invoke != nil {
+		return m.invoke(params), nil
+	}
+	return &lambda.InvokeOutput{StatusCode: 200, Payload: []byte("null")}, nil
+}
+
+func layerArn(name string, version int64) string {
+	return fmt.Sprintf("arn:aws:lambda:us-east-1:123456789012:layer:%s:%d", name, version)
+}
+
+func (m *mockLambdaClient) PublishLayerVersion(ctx context.Context, params *lambda.PublishLayerVersionInput, optFns ...func(*lambda.Options)) (*lambda.PublishLayerVersionOutput, error) {
+	m.calls = append(m.calls, "PublishLayerVersion")
+	if m.layers == nil {
+		m.layers = map[string][]string{}
+	}
+	name := aws.ToString(params.LayerName)
+	m.layers[name] = append(m.layers[name], packaging.Hash(params.Content.ZipFile))
+	version := int64(len(m.layers[name]))
+	return &lambda.PublishLayerVersionOutput{Version: version, LayerVersionArn: aws.String(layerArn(name, version))}, nil
+}
+
+func (m *mockLambdaClient) ListLayerVersions(ctx context.Context, params *lambda.ListLayerVersionsInput, optFns ...func(*lambda.Options)) (*lambda.ListLayerVersionsOutput, error) {
+	name := aws.ToString(params.LayerName)
+	output := &lambda.ListLayerVersionsOutput{}
+	for i := range m.layers[name] {
+		version := int64(i + 1)
+		output.LayerVersions = append(output.LayerVersions, types.LayerVersionsListItem{Version: version, LayerVersionArn: aws.String(layerArn(name, version))})
+	}
+	return output, nil
+}
+
+func (m *mockLambdaClient) GetLayerVersion(ctx context.Context, params *lambda.GetLayerVersionInput, optFns ...func(*lambda.Options)) (*lambda.GetLayerVersionOutput, error) {
+	name, version := aws.ToString(params.LayerName), aws.ToInt64(params.VersionNumber)
+	if version < 1 || version > int64(len(m.layers[name])) {
+		return nil, fmt.Errorf("ResourceNotFoundException: layer version not found")
+	}
+	return &lambda.GetLayerVersionOutput{
+		LayerVersionArn: aws.String(layerArn(name, version)),
+		Content:         &types.LayerVersionContentOutput{CodeSha256: aws.String(m.layers[name][version-1])},
+	}, nil
+}
+
+func (m *mockLambdaClient) DeleteLayerVersion(ctx context.Context, params *lambda.DeleteLayerVersionInput, optFns ...func(*lambda.Options)) (*lambda.DeleteLayerVersionOutput, error) {
+	m.deletedLayers = append(m.deletedLayers, aws.ToInt64(params.VersionNumber))
+	return &lambda.DeleteLayerVersionOutput{}, nil
+}
+
+func (m *mockLambdaClient) GetFunctionConcurrency(ctx context.Context, params *lambda.GetFunctionConcurrencyInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionConcurrencyOutput, error) {
+	return &lambda.GetFunctionConcurrencyOutput{ReservedConcurrentExecutions: m.reserved}, nil
+}
+
+func (m *mockLambdaClient) PutFunctionConcurrency(ctx context.Context, params *lambda.PutFunctionConcurrencyInput, optFns ...func(*lambda.Options)) (*lambda.PutFunctionConcurrencyOutput, error) {
+	m.calls = append(m.calls, "PutFunctionConcurrency")
+	m.reserved = params.ReservedConcurrentExecutions
+	return &lambda.PutFunctionConcurrencyOutput{ReservedConcurrentExecutions: m.reserved}, nil
+}
+
+func (m *mockLambdaClient) DeleteFunctionConcurrency(ctx context.Context, params *lambda.DeleteFunctionConcurrencyInput, optFns ...func(*lambda.Options)) (*lambda.DeleteFunctionConcurrencyOutput, error) {
+	m.calls = append(m.calls, "DeleteFunctionConcurrency")
+	m.reserved = nil
+	return &lambda.DeleteFunctionConcurrencyOutput{}, nil
+}
+
+func (m *mockLambdaClient) GetProvisionedConcurrencyConfig(ctx context.Context, params *lambda.GetProvisionedConcurrencyConfigInput, optFns ...func(*lambda.Options)) (*lambda.GetProvisionedConcurrencyConfigOutput, error) {
+	if m.provisioned == 0 {
+		return nil, fmt.Errorf("ProvisionedConcurrencyConfigNotFoundException: No Provisioned Concurrency Config found for this function")
+	}
+	status := types.ProvisionedConcurrencyStatusEnumReady
+	if len(m.provisionedStatuses) > 0 {
+		status, m.provisionedStatuses = m.provisionedStatuses[0], m.provisionedStatuses[1:]
+	}
+	return &lambda.GetProvisionedConcurrencyConfigOutput{
+		RequestedProvisionedConcurrentExecutions: aws.Int32(m.provisioned),
+		AvailableProvisionedConcurrentExecutions: aws.Int32(m.provisioned),
+		Status:                                   status,
+		StatusReason:                             aws.String("FUNCTION_ERROR_INIT_FAILURE"),
+	}, nil
+}
+
+func (m *mockLambdaClient) PutProvisionedConcurrencyConfig(ctx context.Context, params *lambda.PutProvisionedConcurrencyConfigInput, optFns ...func(*lambda.Options)) (*lambda.PutProvisionedConcurrencyConfigOutput, error) {
+	m.calls = append(m.calls, "PutProvisionedConcurrencyConfig:"+aws.ToString(params.Qualifier))
+	m.provisioned = aws.ToInt32(params.ProvisionedConcurrentExecutions)
+	return &lambda.PutProvisionedConcurrencyConfigOutput{Status: types.ProvisionedConcurrencyStatusEnumInProgress}, nil
+}
+
+func (m *mockLambdaClient) DeleteProvisionedConcurrencyConfig(ctx context.Context, params *lambda.DeleteProvisionedConcurrencyConfigInput, optFns ...func(*lambda.Options)) (*lambda.DeleteProvisionedConcurrencyConfigOutput, error) {
+	m.calls = append(m.calls, "DeleteProvisionedConcurrencyConfig:"+aws.ToString(params.Qualifier))
+	m.provisioned = 0
+	return &lambda.DeleteProvisionedConcurrencyConfigOutput{}, nil
+}
+
+func (m *mockLambdaClient) DeleteFunction(ctx context.Context, params *lambda.DeleteFunctionInput, optFns ...func(*lambda.Options)) (*lambda.DeleteFunctionOutput, error) {
+	m.calls = append(m.calls, "DeleteFunction")
+	if m.deleted {
+		return nil, fmt.Errorf("ResourceNotFoundException: Function not found: %s", aws.ToString(params.FunctionName))
+	}
+	m.deleted = true
+	return &lambda.DeleteFunctionOutput{}, nil
+}
+
+func (m *mockLambdaClient) AddPermission(ctx context.Context, params *lambda.AddPermissionInput, optFns ...func(*lambda.Options)) (*lambda.AddPermissionOutput, error) {
+	m.calls = append(m.calls, "AddPermission")
+	if m.permissions == nil {
+		m.permissions = map[string]string{}
+	}
+	if _, ok := m.permissions[aws.ToString(params.StatementId)]; ok {
+		return nil, fmt.Errorf("ResourceConflictException: The statement id (%s) provided already exists", aws.ToString(params.StatementId))
+	}
+	m.permissions[aws.ToString(params.StatementId)] = aws.ToString(params.SourceArn)
+	return &lambda.AddPermissionOutput{}, nil
+}
+
+func (m *mockLambdaClient) RemovePermission(ctx context.Context, params *lambda.RemovePermissionInput, optFns ...func(*lambda.Options)) (*lambda.RemovePermissionOutput, error) {
+	m.calls = append(m.calls, "RemovePermission")
+	delete(m.permissions, aws.ToString(params.StatementId))
+	return &lambda.RemovePermissionOutput{}, nil
+}
+
+func (m *mockLambdaClient) GetPolicy(ctx context.Context, params *lambda.GetPolicyInput, optFns ...func(*lambda.Options)) (*lambda.GetPolicyOutput, error) {
+	var statements []string
+	for sid, source := range m.permissions {
+		statements = append(statements, fmt.Sprintf(`{"Sid":%q,"Effect":"Allow","Condition":{"ArnLike":{"AWS:SourceArn":%q}}}`, sid, source))
+	}
+	return &lambda.GetPolicyOutput{Policy: aws.String(`{"Version":"2012-10-17","Statement":[` + strings.Join(statements, ",") + `]}`)}, nil
+}
@@ -0,0 +1,147 @@
+package deploy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// Change is one configuration field that differs between the deployed function and
+// the configuration file.
+type Change struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.From, c.To)
+}
+
+// Diff compares the deployed configuration with the desired one. Only managed fields
+// (non-zero in desired) are compared.
+func Diff(current *types.FunctionConfiguration, desired *FunctionConfig) []Change {
+	var changes []Change
+	add := func(field, from, to string) {
+		if from != to {
+			changes = append(changes, Change{Field: field, From: quote(from), To: quote(to)})
+		}
+	}
+
+	if desired.Description != "" {
+		add("description", aws.ToString(current.Description), desired.Description)
+	}
+	if desired.Role != "" {
+		add("role", aws.ToString(current.Role), desired.Role)
+	}
+	if !desired.IsImage() {
+		add("handler", aws.ToString(current.Handler), desired.Handler)
+		add("runtime", string(current.Runtime), desired.Runtime)
+	}
+
+	if desired.MemorySize != 0 {
+		add("memorySize", fmt.Sprint(aws.ToInt32(current.MemorySize)), fmt.Sprint(desired.MemorySize))
+	}
+	if desired.Timeout != 0 {
+		add("timeout", fmt.Sprint(aws.ToInt32(current.Timeout)), fmt.Sprint(desired.Timeout))
+	}
+	if desired.EphemeralStorage != 0 {
+		currentStorage := int32(0)
+		if current.EphemeralStorage != nil {
+			currentStorage = aws.ToInt32(current.EphemeralStorage.Size)
+		}
+		add("ephemeralStorage", fmt.Sprint(currentStorage), fmt.Sprint(desired.EphemeralStorage))
+	}
+
+	if desired.Environment != nil {
+		var currentVars map[string]string
+		if current.Environment != nil {
+			currentVars = current.Environment.Variables
+		}
+		// Values may be secrets, so the diff only says whether a variable was set
+		for _, key := range unionKeys(currentVars, desired.Environment) {
+			from, hadKey := currentVars[key]
+			to, hasKey := desired.Environment[key]
+			switch {
+			case !hadKey:
+				changes = append(changes, Change{Field: "environment." + key, From: "<unset>", To: "<set>"})
+			case !hasKey:
+				changes = append(changes, Change{Field: "environment." + key, From: "<set>", To: "<unset>"})
+			case from != to:
+				changes = append(changes, Change{Field: "environment." + key, From: "<old value>", To: "<new value>"})
+			}
+		}
+	}
+
+	if desired.Vpc != nil {
+		var subnets, groups []string
+		if current.VpcConfig != nil {
+			subnets, groups = current.VpcConfig.SubnetIds, current.VpcConfig.SecurityGroupIds
+		}
+		add("vpc.subnetIds", joinSorted(subnets), joinSorted(desired.Vpc.SubnetIds))
+		add("vpc.securityGroupIds", joinSorted(groups), joinSorted(desired.Vpc.SecurityGroupIds))
+	}
+
+	// Layer order is significant: later layers overwrite files of earlier ones
+	if desired.Layers != nil {
+		var currentLayers []string
+		for _, layer := range current.Layers {
+			currentLayers = append(currentLayers, aws.ToString(layer.Arn))
+		}
+		add("layers", strings.Join(currentLayers, ","), strings.Join(desired.LayerArns, ","))
+	}
+
+	if desired.Logging != nil {
+		currentLogging := current.LoggingConfig
+		if currentLogging == nil {
+			currentLogging = &types.LoggingConfig{}
+		}
+		if desired.Logging.LogFormat != "" {
+			add("logging.logFormat", string(currentLogging.LogFormat), desired.Logging.LogFormat)
+		}
+		if desired.Logging.ApplicationLogLevel != "" {
+			add("logging.applicationLogLevel", string(currentLogging.ApplicationLogLevel), desired.Logging.ApplicationLogLevel)
+		}
+		if desired.Logging.SystemLogLevel != "" {
+			add("logging.systemLogLevel", string(currentLogging.SystemLogLevel), desired.Logging.SystemLogLevel)
+		}
+		if desired.Logging.LogGroup != "" {
+			add("logging.logGroup", aws.ToString(currentLogging.LogGroup), desired.Logging.LogGroup)
+		}
+	}
+	return changes
+}
+
+func quote(value string) string {
+	if value == "" {
+		return "<unset>"
+	}
+	if strings.HasPrefix(value, "<") {
+		return value
+	}
+	return fmt.Sprintf("%q", value)
+}
+
+func unionKeys(a, b map[string]string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]string{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinSorted(values []string) string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
@@ -0,0 +1,281 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+
+	"setup/helpers/progress"
+)
+
+// updateTimeout bounds how long the deployer waits for Lambda to finish applying an update.
+const updateTimeout = 5 * time.Minute
+
+type lambdaClient interface {
+	GetFunction(ctx context.Context, params *lambda.GetFunctionInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionOutput, error)
+	CreateFunction(ctx context.Context, params *lambda.CreateFunctionInput, optFns ...func(*lambda.Options)) (*lambda.CreateFunctionOutput, error)
+	UpdateFunctionCode(ctx context.Context, params *lambda.UpdateFunctionCodeInput, optFns ...func(*lambda.Options)) (*lambda.UpdateFunctionCodeOutput, error)
+	UpdateFunctionConfiguration(ctx context.Context, params *lambda.UpdateFunctionConfigurationInput, optFns ...func(*lambda.Options)) (*lambda.UpdateFunctionConfigurationOutput, error)
+	PublishVersion(ctx context.Context, params *lambda.PublishVersionInput, optFns ...func(*lambda.Options)) (*lambda.PublishVersionOutput, error)
+	ListVersionsByFunction(ctx context.Context, params *lambda.ListVersionsByFunctionInput, optFns ...func(*lambda.Options)) (*lambda.ListVersionsByFunctionOutput, error)
+	GetAlias(ctx context.Context, params *lambda.GetAliasInput, optFns ...func(*lambda.Options)) (*lambda.GetAliasOutput, error)
+	CreateAlias(ctx context.Context, params *lambda.CreateAliasInput, optFns ...func(*lambda.Options)) (*lambda.CreateAliasOutput, error)
+	UpdateAlias(ctx context.Context, params *lambda.UpdateAliasInput, optFns ...func(*lambda.Options)) (*lambda.UpdateAliasOutput, error)
+	Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error)
+	PublishLayerVersion(ctx context.Context, params *lambda.PublishLayerVersionInput, optFns ...func(*lambda.Options)) (*lambda.PublishLayerVersionOutput, error)
+	ListLayerVersions(ctx context.Context, params *lambda.ListLayerVersionsInput, optFns ...func(*lambda.Options)) (*lambda.ListLayerVersionsOutput, error)
+	GetLayerVersion(ctx context.Context, params *lambda.GetLayerVersionInput, optFns ...func(*lambda.Options)) (*lambda.GetLayerVersionOutput, error)
+	DeleteLayerVersion(ctx context.Context, params *lambda.DeleteLayerVersionInput, optFns ...func(*lambda.Options)) (*lambda.DeleteLayerVersionOutput, error)
+	GetFunctionConcurrency(ctx context.Context, params *lambda.GetFunctionConcurrencyInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionConcurrencyOutput, error)
+	PutFunctionConcurrency(ctx context.Context, params *lambda.PutFunctionConcurrencyInput, optFns ...func(*lambda.Options)) (*lambda.PutFunctionConcurrencyOutput, error)
+	DeleteFunctionConcurrency(ctx context.Context, params *lambda.DeleteFunctionConcurrencyInput, optFns ...func(*lambda.Options)) (*lambda.DeleteFunctionConcurrencyOutput, error)
+	GetProvisionedConcurrencyConfig(ctx context.Context, params *lambda.GetProvisionedConcurrencyConfigInput, optFns ...func(*lambda.Options)) (*lambda.GetProvisionedConcurrencyConfigOutput, error)
+	PutProvisionedConcurrencyConfig(ctx context.Context, params *lambda.PutProvisionedConcurrencyConfigInput, optFns ...func(*lambda.Options)) (*lambda.PutProvisionedConcurrencyConfigOutput, error)
+	DeleteProvisionedConcurrencyConfig(ctx context.Context, params *lambda.DeleteProvisionedConcurrencyConfigInput, optFns ...func(*lambda.Options)) (*lambda.DeleteProvisionedConcurrencyConfigOutput, error)
+	DeleteFunction(ctx context.Context, params *lambda.DeleteFunctionInput, optFns ...func(*lambda.Options)) (*lambda.DeleteFunctionOutput, error)
+	AddPermission(ctx context.Context, params *lambda.AddPermissionInput, optFns ...func(*lambda.Options)) (*lambda.AddPermissionOutput, error)
+	RemovePermission(ctx context.Context, params *lambda.RemovePermissionInput, optFns ...func(*lambda.Options)) (*lambda.RemovePermissionOutput, error)
+	GetPolicy(ctx context.Context, params *lambda.GetPolicyInput, optFns ...func(*lambda.Options)) (*lambda.GetPolicyOutput, error)
+}
+
+// Result is the deployed function after a create or update.
+type Result struct {
+	FunctionArn string
+	Version     string
+	// CodeChanged is false when the package matched the deployed code and was not uploaded.
+	CodeChanged bool
+	// Changes lists the configuration fields an update changed.
+	Changes []Change
+}
+
+// Unchanged reports whether the deploy changed neither code nor configuration.
+func (r *Result) Unchanged() bool {
+	return !r.CodeChanged && len(r.Changes) == 0
+}
+
+// CreateFunction creates the function with the full configuration and the package.
+func CreateFunction(client lambdaClient, cfg *FunctionConfig, code Code) (*Result, error) {
+	input := &lambda.CreateFunctionInput{
+		Code:             functionCode(code),
+		PackageType:      cfg.LambdaPackageType(),
+		FunctionName:     aws.String(cfg.FunctionName),
+		Description:      optionalString(cfg.Description),
+		Role:             optionalString(cfg.Role),
+		Architectures:    []types.Architecture{cfg.LambdaArchitecture()},
+		MemorySize:       optionalInt32(cfg.MemorySize),
+		Timeout:          optionalInt32(cfg.Timeout),
+		EphemeralStorage: ephemeralStorage(cfg),
+		Environment:      environment(cfg),
+		VpcConfig:        vpcConfig(cfg),
+		LoggingConfig:    loggingConfig(cfg),
+		Layers:           layers(cfg),
+	}
+	// Images bring their own entrypoint and cannot use runtimes or layers
+	if !cfg.IsImage() {
+		input.Handler = aws.String(cfg.Handler)
+		input.Runtime = types.Runtime(cfg.Runtime)
+	}
+
+	result, err := client.CreateFunction(context.Background(), input)
+	if err != nil {
+		return nil, err
+	}
+
+	progress.Printf("Function created: %s\n", aws.ToString(result.FunctionArn))
+	return &Result{FunctionArn: aws.ToString(result.FunctionArn), Version: aws.ToString(result.Version), CodeChanged: true}, nil
+}
+
+// UpdateFunction pushes the zip package, then applies any configuration drift with
+// UpdateFunctionConfiguration. current is the configuration GetFunction returned. The
+// upload is skipped when the package hashes to the deployed CodeSha256, which relies on
+// packages being byte-identical for the same source.
+func UpdateFunction(client lambdaClient, cfg *FunctionConfig, current *types.FunctionConfiguration, code Code) (*Result, error) {
+	result := &Result{FunctionArn: aws.ToString(current.FunctionArn), Version: aws.ToString(current.Version)}
+	if current.PackageType != "" && current.PackageType != cfg.LambdaPackageType() {
+		return nil, fmt.Errorf("function %s has package type %s; Lambda cannot change it to %s, delete the function first", cfg.FunctionName, current.PackageType, cfg.LambdaPackageType())
+	}
+	if err := cfg.CheckArchitecture(current); err != nil {
+		return nil, err
+	}
+
+	if code.Hash() == aws.ToString(current.CodeSha256) {
+		progress.Println("Code unchanged, skipping upload")
+	} else {
+		input := &lambda.UpdateFunctionCodeInput{
+			FunctionName:  aws.String(cfg.FunctionName),
+			Architectures: []types.Architecture{cfg.LambdaArchitecture()},
+		}
+		switch {
+		case code.ImageURI != "":
+			input.ImageUri = aws.String(code.ImageURI)
+		case code.S3 != nil:
+			input.S3Bucket = aws.String(code.S3.Bucket)
+			input.S3Key = aws.String(code.S3.Key)
+			input.S3ObjectVersion = optionalString(code.S3.Version)
+		default:
+			input.ZipFile = code.ZipFile
+		}
+		updated, err := client.UpdateFunctionCode(context.Background(), input)
+		if err != nil {
+			return nil, err
+		}
+		progress.Printf("Function updated: %s\n", aws.ToString(updated.FunctionArn))
+		result = &Result{FunctionArn: aws.ToString(updated.FunctionArn), Version: aws.ToString(updated.Version), CodeChanged: true}
+	}
+
+	result.Changes = Diff(current, cfg)
+	if len(result.Changes) == 0 {
+		progress.Println("Configuration unchanged")
+		return result, nil
+	}
+
+	progress.Println("Configuration changes:")
+	for _, change := range result.Changes {
+		progress.Println("  " + change.String())
+	}
+
+	// Lambda rejects a configuration update while the code update is still in progress
+	if err := WaitUntilUpdated(client, cfg.FunctionName); err != nil {
+		return nil, err
+	}
+
+	input := &lambda.UpdateFunctionConfigurationInput{
+		FunctionName:     aws.String(cfg.FunctionName),
+		Description:      optionalString(cfg.Description),
+		Role:             optionalString(cfg.Role),
+		MemorySize:       optionalInt32(cfg.MemorySize),
+		Timeout:          optionalInt32(cfg.Timeout),
+		EphemeralStorage: ephemeralStorage(cfg),
+		Environment:      environment(cfg),
+		VpcConfig:        vpcConfig(cfg),
+		LoggingConfig:    loggingConfig(cfg),
+		Layers:           layers(cfg),
+	}
+	if !cfg.IsImage() {
+		input.Handler = aws.String(cfg.Handler)
+		input.Runtime = types.Runtime(cfg.Runtime)
+	}
+	_, err := client.UpdateFunctionConfiguration(context.Background(), input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update function configuration: %v", err)
+	}
+
+	if err := WaitUntilUpdated(client, cfg.FunctionName); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// WaitUntilUpdated blocks until the function's LastUpdateStatus is Successful, and fails
+// if the update failed.
+func WaitUntilUpdated(client lambdaClient, functionName string) error {
+	return waitUntilUpdated(client, functionName, "")
+}
+
+// waitUntilUpdated waits for a version or alias of the function; an empty qualifier
+// means $LATEST.
+func waitUntilUpdated(client lambdaClient, functionName, qualifier string) error {
+	waiter := lambda.NewFunctionUpdatedV2Waiter(client, func(o *lambda.FunctionUpdatedV2WaiterOptions) {
+		o.MinDelay = time.Second
+		o.MaxDelay = 5 * time.Second
+	})
+	input := &lambda.GetFunctionInput{FunctionName: aws.String(functionName)}
+	if qualifier != "" {
+		input.Qualifier = aws.String(qualifier)
+	}
+	if err := waiter.Wait(context.Background(), input, updateTimeout); err != nil {
+		return fmt.Errorf("function %s did not finish updating: %v", functionName, err)
+	}
+	return nil
+}
+
+// functionCode references the staged package when there is one, and sends the zip
+// inline otherwise.
+func functionCode(code Code) *types.FunctionCode {
+	if code.ImageURI != "" {
+		return &types.FunctionCode{ImageUri: aws.String(code.ImageURI)}
+	}
+	if code.S3 == nil {
+		return &types.FunctionCode{ZipFile: code.ZipFile}
+	}
+	return &types.FunctionCode{
+		S3Bucket:        aws.String(code.S3.Bucket),
+		S3Key:           aws.String(code.S3.Key),
+		S3ObjectVersion: optionalString(code.S3.Version),
+	}
+}
+
+func optionalInt32(value int32) *int32 {
+	if value == 0 {
+		return nil
+	}
+	return aws.Int32(value)
+}
+
+func ephemeralStorage(cfg *FunctionConfig) *types.EphemeralStorage {
+	if cfg.EphemeralStorage == 0 {
+		return nil
+	}
+	return &types.EphemeralStorage{Size: aws.Int32(cfg.EphemeralStorage)}
+}
+
+func environment(cfg *FunctionConfig) *types.Environment {
+	if cfg.Environment == nil {
+		return nil
+	}
+	return &types.Environment{Variables: cfg.Environment}
+}
+
+func vpcConfig(cfg *FunctionConfig) *types.VpcConfig {
+	if cfg.Vpc == nil {
+		return nil
+	}
+	return &types.VpcConfig{
+		SubnetIds:        cfg.Vpc.SubnetIds,
+		SecurityGroupIds: cfg.Vpc.SecurityGroupIds,
+	}
+}
+
+// DeleteFunction deletes the function with all its versions and aliases, and with them
+// the permissions granted to the rules. It reports false when there was no function.
+func DeleteFunction(client lambdaClient, functionName string) (bool, error) {
+	_, err := client.DeleteFunction(context.Background(), &lambda.DeleteFunctionInput{
+		FunctionName: aws.String(functionName),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to delete function %s: %v", functionName, err)
+	}
+	return true, nil
+}
+
+// layers returns nil when layers are unmanaged, and an empty, non-nil list to remove
+// them all.
+func layers(cfg *FunctionConfig) []string {
+	if cfg.Layers == nil {
+		return nil
+	}
+	return append([]string{}, cfg.LayerArns...)
+}
+
+func loggingConfig(cfg *FunctionConfig) *types.LoggingConfig {
+	if cfg.Logging == nil {
+		return nil
+	}
+	config := &types.LoggingConfig{
+		LogFormat:           types.LogFormat(cfg.Logging.LogFormat),
+		ApplicationLogLevel: types.ApplicationLogLevel(cfg.Logging.ApplicationLogLevel),
+		SystemLogLevel:      types.SystemLogLevel(cfg.Logging.SystemLogLevel),
+	}
+	if cfg.Logging.LogGroup != "" {
+		config.LogGroup = aws.String(cfg.Logging.LogGroup)
+	}
+	return config
+}
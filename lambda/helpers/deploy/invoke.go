@@ -0,0 +1,93 @@
+package deploy
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// LogTailBytes is how much of the function's log LogType Tail returns.
+const LogTailBytes = 4 * 1024
+
+// InvokeOptions select how the function is invoked.
+type InvokeOptions struct {
+	FunctionName string
+	// Qualifier is a version or alias; empty invokes $LATEST.
+	Qualifier string
+	// InvocationType is RequestResponse, Event or DryRun; empty means RequestResponse.
+	InvocationType types.InvocationType
+	// LogTail returns the last 4 KB of the invocation's log. Only synchronous
+	// invocations have a log to return.
+	LogTail bool
+	Payload []byte
+}
+
+// Invocation is the outcome of an invoke.
+type Invocation struct {
+	StatusCode      int32
+	Payload         []byte
+	FunctionError   string
+	ExecutedVersion string
+	// Logs is the decoded log tail, empty unless LogTail was requested.
+	Logs string
+}
+
+// ParseInvocationType checks an invocation type given on the command line.
+func ParseInvocationType(value string) (types.InvocationType, error) {
+	for _, known := range types.InvocationTypeRequestResponse.Values() {
+		if string(known) == value {
+			return known, nil
+		}
+	}
+	return "", fmt.Errorf("invocation type %q must be one of RequestResponse, Event or DryRun", value)
+}
+
+// Invoke calls the function and decodes the log tail.
+func Invoke(client lambdaClient, opts InvokeOptions) (*Invocation, error) {
+	invocationType := opts.InvocationType
+	if invocationType == "" {
+		invocationType = types.InvocationTypeRequestResponse
+	}
+	if opts.LogTail && invocationType != types.InvocationTypeRequestResponse {
+		return nil, fmt.Errorf("log tail is only available for RequestResponse invocations, not %s", invocationType)
+	}
+
+	input := &lambda.InvokeInput{
+		FunctionName:   aws.String(opts.FunctionName),
+		InvocationType: invocationType,
+		Payload:        opts.Payload,
+	}
+	if opts.Qualifier != "" {
+		input.Qualifier = aws.String(opts.Qualifier)
+	}
+	if opts.LogTail {
+		input.LogType = types.LogTypeTail
+	}
+
+	result, err := client.Invoke(context.Background(), input)
+	if err != nil {
+		return nil, err
+	}
+
+	invocation := &Invocation{
+		StatusCode:      result.StatusCode,
+		Payload:         result.Payload,
+		FunctionError:   aws.ToString(result.FunctionError),
+		ExecutedVersion: aws.ToString(result.ExecutedVersion),
+	}
+	if result.LogResult != nil {
+		logs, err := base64.StdEncoding.DecodeString(aws.ToString(result.LogResult))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode log result: %v", err)
+		}
+		if len(logs) > LogTailBytes {
+			logs = logs[len(logs)-LogTailBytes:]
+		}
+		invocation.Logs = string(logs)
+	}
+	return invocation, nil
+}
@@ -0,0 +1,59 @@
+package deploy
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvoke(t *testing.T) {
+	t.Run("log tail decoded", func(t *testing.T) {
+		logs := strings.Repeat("x", LogTailBytes) + "END RequestId: 1\n"
+		client := &mockLambdaClient{invoke: func(params *lambda.InvokeInput) *lambda.InvokeOutput {
+			return &lambda.InvokeOutput{
+				StatusCode:      200,
+				Payload:         []byte("null"),
+				ExecutedVersion: aws.String("4"),
+				LogResult:       aws.String(base64.StdEncoding.EncodeToString([]byte(logs))),
+			}
+		}}
+
+		invocation, err := Invoke(client, InvokeOptions{FunctionName: "fn", Qualifier: DefaultAlias, LogTail: true})
+		assert.NoError(t, err)
+		assert.Equal(t, "4", invocation.ExecutedVersion)
+		assert.Len(t, invocation.Logs, LogTailBytes)
+		assert.True(t, strings.HasSuffix(invocation.Logs, "END RequestId: 1\n"))
+
+		input := client.invoked[0]
+		assert.Equal(t, types.LogTypeTail, input.LogType)
+		assert.Equal(t, types.InvocationTypeRequestResponse, input.InvocationType)
+		assert.Equal(t, DefaultAlias, aws.ToString(input.Qualifier))
+	})
+
+	t.Run("async invoke", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		_, err := Invoke(client, InvokeOptions{FunctionName: "fn", InvocationType: types.InvocationTypeEvent})
+		assert.NoError(t, err)
+		assert.Equal(t, types.InvocationTypeEvent, client.invoked[0].InvocationType)
+		assert.Nil(t, client.invoked[0].Qualifier)
+	})
+
+	t.Run("log tail needs a synchronous invoke", func(t *testing.T) {
+		_, err := Invoke(&mockLambdaClient{}, InvokeOptions{FunctionName: "fn", InvocationType: types.InvocationTypeDryRun, LogTail: true})
+		assert.ErrorContains(t, err, "only available for RequestResponse")
+	})
+}
+
+func TestParseInvocationType(t *testing.T) {
+	invocationType, err := ParseInvocationType("Event")
+	assert.NoError(t, err)
+	assert.Equal(t, types.InvocationTypeEvent, invocationType)
+
+	_, err = ParseInvocationType("async")
+	assert.Error(t, err)
+}
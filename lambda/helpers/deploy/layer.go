@@ -0,0 +1,161 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+
+	"lambdax/helpers/packaging"
+
+	"setup/helpers/progress"
+)
+
+// ResolveLayers publishes the layers built from a directory, resolves every layer to a
+// version ARN and stores the ARNs in cfg.LayerArns.
+func ResolveLayers(client lambdaClient, cfg *FunctionConfig) error {
+	cfg.LayerArns = nil
+	for _, layer := range cfg.Layers {
+		var arn string
+		var err error
+		switch {
+		case strings.HasPrefix(layer.Name, "arn:"):
+			arn = layer.Name
+		case layer.Dir != "":
+			arn, err = PublishLayer(client, layer.Name, layer.Dir, cfg)
+		case layer.Version != 0:
+			arn, err = layerVersionArn(client, layer.Name, layer.Version)
+		default:
+			arn, err = latestLayerVersionArn(client, layer.Name)
+		}
+		if err != nil {
+			return err
+		}
+		progress.Printf("Layer %s: %s\n", layer.Name, arn)
+		cfg.LayerArns = append(cfg.LayerArns, arn)
+	}
+	return nil
+}
+
+// PublishLayer zips dir and publishes it as a new version of the layer, unless the
+// latest version already has the same content. It returns the version ARN.
+func PublishLayer(client lambdaClient, name, dir string, cfg *FunctionConfig) (string, error) {
+	archive, err := packaging.ZipDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	latest, err := latestLayerVersion(client, name)
+	if err != nil {
+		return "", err
+	}
+	if latest != nil {
+		current, err := client.GetLayerVersion(context.Background(), &lambda.GetLayerVersionInput{
+			LayerName:     aws.String(name),
+			VersionNumber: aws.Int64(latest.Version),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get layer %s version %d: %v", name, latest.Version, err)
+		}
+		if current.Content != nil && aws.ToString(current.Content.CodeSha256) == packaging.Hash(archive) {
+			progress.Printf("Layer %s unchanged at version %d\n", name, latest.Version)
+			return aws.ToString(latest.LayerVersionArn), nil
+		}
+	}
+
+	published, err := client.PublishLayerVersion(context.Background(), &lambda.PublishLayerVersionInput{
+		LayerName:               aws.String(name),
+		Content:                 &types.LayerVersionContentInput{ZipFile: archive},
+		Description:             aws.String("Published from " + dir + ", SHA-256 " + packaging.Hash(archive)),
+		CompatibleRuntimes:      []types.Runtime{types.Runtime(cfg.Runtime)},
+		CompatibleArchitectures: []types.Architecture{cfg.LambdaArchitecture()},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to publish layer %s: %v", name, err)
+	}
+	progress.Printf("Published layer %s version %d\n", name, published.Version)
+	return aws.ToString(published.LayerVersionArn), nil
+}
+
+// PruneLayerVersions deletes all but the newest keep versions of a layer. Versions in
+// inUse, given as version ARNs, are never deleted. It returns the deleted versions.
+func PruneLayerVersions(client lambdaClient, name string, keep int, inUse []string) ([]int64, error) {
+	versions, err := listLayerVersions(client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	for _, arn := range inUse {
+		used[arn] = true
+	}
+
+	var deleted []int64
+	for i, version := range versions {
+		if i < keep || used[aws.ToString(version.LayerVersionArn)] {
+			continue
+		}
+		_, err := client.DeleteLayerVersion(context.Background(), &lambda.DeleteLayerVersionInput{
+			LayerName:     aws.String(name),
+			VersionNumber: aws.Int64(version.Version),
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete layer %s version %d: %v", name, version.Version, err)
+		}
+		progress.Printf("Deleted layer %s version %d\n", name, version.Version)
+		deleted = append(deleted, version.Version)
+	}
+	return deleted, nil
+}
+
+func layerVersionArn(client lambdaClient, name string, version int64) (string, error) {
+	result, err := client.GetLayerVersion(context.Background(), &lambda.GetLayerVersionInput{
+		LayerName:     aws.String(name),
+		VersionNumber: aws.Int64(version),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get layer %s version %d: %v", name, version, err)
+	}
+	return aws.ToString(result.LayerVersionArn), nil
+}
+
+func latestLayerVersionArn(client lambdaClient, name string) (string, error) {
+	latest, err := latestLayerVersion(client, name)
+	if err != nil {
+		return "", err
+	}
+	if latest == nil {
+		return "", fmt.Errorf("layer %s has no versions; publish one or set its dir", name)
+	}
+	return aws.ToString(latest.LayerVersionArn), nil
+}
+
+// latestLayerVersion returns nil when the layer has no versions yet.
+func latestLayerVersion(client lambdaClient, name string) (*types.LayerVersionsListItem, error) {
+	versions, err := listLayerVersions(client, name)
+	if err != nil || len(versions) == 0 {
+		return nil, err
+	}
+	return &versions[0], nil
+}
+
+// listLayerVersions returns every version of the layer, newest first.
+func listLayerVersions(client lambdaClient, name string) ([]types.LayerVersionsListItem, error) {
+	var versions []types.LayerVersionsListItem
+	paginator := lambda.NewListLayerVersionsPaginator(client, &lambda.ListLayerVersionsInput{
+		LayerName: aws.String(name),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of layer %s: %v", name, err)
+		}
+		versions = append(versions, page.LayerVersions...)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
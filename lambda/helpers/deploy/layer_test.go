@@ -0,0 +1,88 @@
+package deploy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveLayers(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca-bundle.pem"), []byte("cert"), 0o644))
+
+	client := &mockLambdaClient{layers: map[string][]string{"telemetry": {"a", "b", "c"}}}
+	cfg := testConfig()
+	cfg.Layers = []LayerConfig{
+		{Name: "ca-bundle", Dir: dir},
+		{Name: "telemetry"},
+		{Name: "telemetry", Version: 2},
+		{Name: "arn:aws:lambda:us-east-1:999999999999:layer:vendor:7"},
+	}
+
+	assert.NoError(t, ResolveLayers(client, cfg))
+	assert.Equal(t, []string{
+		layerArn("ca-bundle", 1),
+		layerArn("telemetry", 3),
+		layerArn("telemetry", 2),
+		"arn:aws:lambda:us-east-1:999999999999:layer:vendor:7",
+	}, cfg.LayerArns)
+
+	// Unchanged contents are not published again
+	assert.NoError(t, ResolveLayers(client, cfg))
+	assert.Len(t, client.layers["ca-bundle"], 1)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca-bundle.pem"), []byte("rotated cert"), 0o644))
+	assert.NoError(t, ResolveLayers(client, cfg))
+	assert.Equal(t, layerArn("ca-bundle", 2), cfg.LayerArns[0])
+}
+
+func TestResolveLayersWithoutVersions(t *testing.T) {
+	cfg := testConfig()
+	cfg.Layers = []LayerConfig{{Name: "telemetry"}}
+	assert.ErrorContains(t, ResolveLayers(&mockLambdaClient{}, cfg), "has no versions")
+}
+
+func TestLayersDiffAndUpdate(t *testing.T) {
+	cfg := testConfig()
+	cfg.MemorySize, cfg.Environment, cfg.Logging = 0, nil, nil
+	cfg.Layers = []LayerConfig{{Name: "telemetry"}}
+	cfg.LayerArns = []string{layerArn("telemetry", 3)}
+
+	client := &mockLambdaClient{}
+	result, err := UpdateFunction(client, cfg, deployedConfig(), Code{ZipFile: []byte("zip")})
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{{Field: "layers", From: "<unset>", To: `"` + layerArn("telemetry", 3) + `"`}}, result.Changes)
+	assert.Equal(t, []string{layerArn("telemetry", 3)}, client.configured.Layers)
+
+	// An empty list removes every layer
+	cfg.Layers, cfg.LayerArns = []LayerConfig{}, nil
+	deployed := deployedConfig()
+	deployed.Layers = []types.Layer{{Arn: aws.String(layerArn("telemetry", 3))}}
+	client = &mockLambdaClient{}
+	_, err = UpdateFunction(client, cfg, deployed, Code{ZipFile: []byte("zip")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, client.configured.Layers)
+}
+
+func TestPruneLayerVersions(t *testing.T) {
+	client := &mockLambdaClient{layers: map[string][]string{"telemetry": {"a", "b", "c", "d", "e"}}}
+	deleted, err := PruneLayerVersions(client, "telemetry", 2, []string{layerArn("telemetry", 1)})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 2}, deleted)
+}
+
+func TestValidateLayers(t *testing.T) {
+	cfg := testConfig()
+	cfg.Layers = []LayerConfig{{Name: "ca bundle"}}
+	assert.ErrorContains(t, cfg.Validate(), "layer name")
+
+	cfg.Layers = []LayerConfig{{Name: "telemetry", Version: 2, Dir: "layers/telemetry"}}
+	assert.ErrorContains(t, cfg.Validate(), "drop version or dir")
+
+	cfg.Layers = make([]LayerConfig, 6)
+	assert.ErrorContains(t, cfg.Validate(), "at most 5 layers")
+}
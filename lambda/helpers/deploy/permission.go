@@ -0,0 +1,81 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+
+	"setup/helpers/progress"
+)
+
+// policyDocument is the part of a function's resource policy GrantInvoke reads.
+type policyDocument struct {
+	Statement []struct {
+		Sid       string
+		Condition map[string]map[string]string
+	}
+}
+
+// GrantInvoke lets EventBridge invoke the qualified function from sourceArn under
+// statementID. A statement with that ID left over with another source, e.g. after the
+// rule or its bus was recreated, is replaced.
+func GrantInvoke(client lambdaClient, functionName, qualifier, statementID, sourceArn string) error {
+	input := &lambda.AddPermissionInput{
+		FunctionName: aws.String(functionName),
+		Qualifier:    aws.String(qualifier),
+		StatementId:  aws.String(statementID),
+		Action:       aws.String("lambda:InvokeFunction"),
+		Principal:    aws.String("events.amazonaws.com"),
+		SourceArn:    aws.String(sourceArn),
+	}
+	_, err := client.AddPermission(context.Background(), input)
+	if err == nil || !strings.Contains(err.Error(), "ResourceConflictException") {
+		return err
+	}
+
+	// The statement ID is taken: keep it if it already grants this source
+	current, policyErr := statementSource(client, functionName, qualifier, statementID)
+	if policyErr != nil {
+		return fmt.Errorf("%v (%v)", err, policyErr)
+	}
+	if current == sourceArn {
+		return nil
+	}
+	progress.Printf("Replacing permission %s, which allowed %s\n", statementID, current)
+	_, err = client.RemovePermission(context.Background(), &lambda.RemovePermissionInput{
+		FunctionName: aws.String(functionName),
+		Qualifier:    aws.String(qualifier),
+		StatementId:  aws.String(statementID),
+	})
+	if err != nil && !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		return fmt.Errorf("failed to remove permission %s: %v", statementID, err)
+	}
+	_, err = client.AddPermission(context.Background(), input)
+	return err
+}
+
+// statementSource returns the source ARN the statement of the function's resource
+// policy is conditioned on.
+func statementSource(client lambdaClient, functionName, qualifier, statementID string) (string, error) {
+	out, err := client.GetPolicy(context.Background(), &lambda.GetPolicyInput{
+		FunctionName: aws.String(functionName),
+		Qualifier:    aws.String(qualifier),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read the resource policy: %v", err)
+	}
+	var policy policyDocument
+	if err := json.Unmarshal([]byte(aws.ToString(out.Policy)), &policy); err != nil {
+		return "", fmt.Errorf("failed to parse the resource policy: %v", err)
+	}
+	for _, statement := range policy.Statement {
+		if statement.Sid == statementID {
+			return statement.Condition["ArnLike"]["AWS:SourceArn"], nil
+		}
+	}
+	return "", fmt.Errorf("no statement %s in the resource policy", statementID)
+}
@@ -0,0 +1,32 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrantInvoke(t *testing.T) {
+	const ruleArn = "arn:aws:events:us-east-1:123456789012:rule/eventbus/Rule-ECRPush"
+
+	t.Run("granted", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		assert.NoError(t, GrantInvoke(client, "MyGoLambdaFunction", "live", "EventBridge-Rule-ECRPush", ruleArn))
+		assert.Equal(t, ruleArn, client.permissions["EventBridge-Rule-ECRPush"])
+	})
+
+	t.Run("already granted", func(t *testing.T) {
+		client := &mockLambdaClient{permissions: map[string]string{"EventBridge-Rule-ECRPush": ruleArn}}
+		assert.NoError(t, GrantInvoke(client, "MyGoLambdaFunction", "live", "EventBridge-Rule-ECRPush", ruleArn))
+		assert.Equal(t, []string{"AddPermission"}, client.calls)
+	})
+
+	t.Run("stale source replaced", func(t *testing.T) {
+		client := &mockLambdaClient{permissions: map[string]string{
+			"EventBridge-Rule-ECRPush": "arn:aws:events:us-east-1:123456789012:rule/oldbus/Rule-ECRPush",
+		}}
+		assert.NoError(t, GrantInvoke(client, "MyGoLambdaFunction", "live", "EventBridge-Rule-ECRPush", ruleArn))
+		assert.Equal(t, []string{"AddPermission", "RemovePermission", "AddPermission"}, client.calls)
+		assert.Equal(t, ruleArn, client.permissions["EventBridge-Rule-ECRPush"])
+	})
+}
@@ -0,0 +1,101 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"lambdax/helpers/packaging"
+
+	"setup/helpers/progress"
+)
+
+// DirectUploadLimit is the largest zip Lambda accepts inline through ZipFile. Larger
+// packages have to be staged in S3.
+const DirectUploadLimit = 50 * 1024 * 1024
+
+type s3Client interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// Code is a deployment package. For zip packages ZipFile is always set so the package
+// can be hashed; when S3 is set, Lambda fetches the package from there instead. Image
+// packages set ImageURI and the manifest digest.
+type Code struct {
+	ZipFile []byte
+	S3      *S3Location
+
+	ImageURI    string
+	ImageDigest string
+}
+
+// Hash is the package in the form Lambda reports as CodeSha256: the base64 SHA-256 of a
+// zip, or the hex manifest digest of an image.
+func (c Code) Hash() string {
+	if c.ImageURI != "" {
+		return strings.TrimPrefix(c.ImageDigest, "sha256:")
+	}
+	return packaging.Hash(c.ZipFile)
+}
+
+// S3Location is a staged package. Version is empty when the bucket is not versioned.
+type S3Location struct {
+	Bucket  string
+	Key     string
+	Version string
+}
+
+// StagingKey returns the content-addressed key a package is staged under, so the same
+// package always lands on the same key and is uploaded once.
+func StagingKey(prefix, functionName string, zipFile []byte) string {
+	sum := sha256.Sum256(zipFile)
+	return path.Join(strings.Trim(prefix, "/"), functionName, hex.EncodeToString(sum[:])+".zip")
+}
+
+// StagePackage uploads the package to bucket under its content-addressed key, unless an
+// object is already there.
+func StagePackage(client s3Client, bucket, prefix, functionName string, zipFile []byte) (*S3Location, error) {
+	location := &S3Location{Bucket: bucket, Key: StagingKey(prefix, functionName, zipFile)}
+
+	existing, err := client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(location.Key),
+	})
+	if err == nil {
+		location.Version = aws.ToString(existing.VersionId)
+		progress.Printf("Package already staged at s3://%s/%s\n", bucket, location.Key)
+		return location, nil
+	}
+	if !strings.Contains(err.Error(), "NotFound") {
+		return nil, fmt.Errorf("failed to check s3://%s/%s: %v", bucket, location.Key, err)
+	}
+
+	uploaded, err := client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(location.Key),
+		Body:          bytes.NewReader(zipFile),
+		ContentLength: aws.Int64(int64(len(zipFile))),
+		ContentType:   aws.String("application/zip"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload package to s3://%s/%s: %v", bucket, location.Key, err)
+	}
+	location.Version = aws.ToString(uploaded.VersionId)
+	progress.Printf("Package staged at s3://%s/%s\n", bucket, location.Key)
+	return location, nil
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
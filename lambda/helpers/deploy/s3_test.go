@@ -0,0 +1,87 @@
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// s3StandIn is a local S3-compatible stand-in serving path-style PUT and HEAD requests
+// from memory, with a versioned bucket.
+type s3StandIn struct {
+	objects map[string][]byte
+	puts    int
+}
+
+func newS3StandIn(t *testing.T) (*s3StandIn, *s3.Client) {
+	standIn := &s3StandIn{objects: map[string][]byte{}}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  aws.AnonymousCredentials{},
+		UsePathStyle: true,
+	})
+	return standIn, client
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodHead:
+		if _, ok := s.objects[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("x-amz-version-id", "v1")
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		s.objects[r.URL.Path] = body
+		s.puts++
+		w.Header().Set("x-amz-version-id", fmt.Sprintf("v%d", s.puts))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestStagingKey(t *testing.T) {
+	key := StagingKey("/lambda-packages/", "fn", []byte("zip"))
+	assert.Equal(t, "lambda-packages/fn/4a70fe9aa6436e02c2dea340fbd1e352e4ef2d8ce6ca52ad25d4b95471fc8bf2.zip", key)
+	assert.NotEqual(t, key, StagingKey("lambda-packages", "fn", []byte("other")))
+}
+
+func TestStagePackage(t *testing.T) {
+	standIn, client := newS3StandIn(t)
+
+	location, err := StagePackage(client, "deploy-bucket", "lambda-packages", "fn", []byte("zip"))
+	assert.NoError(t, err)
+	assert.Equal(t, "deploy-bucket", location.Bucket)
+	assert.Equal(t, "v1", location.Version)
+	assert.Equal(t, []byte("zip"), standIn.objects["/deploy-bucket/"+location.Key])
+
+	// The same package is not uploaded twice
+	again, err := StagePackage(client, "deploy-bucket", "lambda-packages", "fn", []byte("zip"))
+	assert.NoError(t, err)
+	assert.Equal(t, location, again)
+	assert.Equal(t, 1, standIn.puts)
+}
+
+func TestUpdateFunctionFromS3(t *testing.T) {
+	client := &mockLambdaClient{}
+	location := &S3Location{Bucket: "deploy-bucket", Key: "lambda-packages/fn/abc.zip", Version: "v1"}
+	_, err := UpdateFunction(client, testConfig(), deployedConfig(), Code{ZipFile: []byte("zip"), S3: location})
+	assert.NoError(t, err)
+
+	input := client.codeUpdated
+	assert.Nil(t, input.ZipFile)
+	assert.Equal(t, "deploy-bucket", aws.ToString(input.S3Bucket))
+	assert.Equal(t, "lambda-packages/fn/abc.zip", aws.ToString(input.S3Key))
+	assert.Equal(t, "v1", aws.ToString(input.S3ObjectVersion))
+}
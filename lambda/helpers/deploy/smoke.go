@@ -0,0 +1,97 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+
+	"setup/helpers/progress"
+)
+
+// SmokeTest is one invocation made against a freshly published version.
+type SmokeTest struct {
+	Name    string
+	Payload []byte
+	// WantError is a message the function must fail with. Empty means the invocation
+	// must succeed.
+	WantError string
+	// WantResponse, when set, must appear in the response payload.
+	WantResponse string
+}
+
+// functionError is the payload Lambda returns when a Go handler returns an error.
+type functionError struct {
+	ErrorMessage string `json:"errorMessage"`
+	ErrorType    string `json:"errorType"`
+}
+
+// Verify waits for the qualified version to finish updating, then runs each smoke test
+// against it. It returns an error describing every test that failed.
+func Verify(client lambdaClient, functionName, qualifier string, tests []SmokeTest) error {
+	if err := waitUntilUpdated(client, functionName, qualifier); err != nil {
+		return err
+	}
+
+	var failures []string
+	for _, test := range tests {
+		if err := runSmokeTest(client, functionName, qualifier, test); err != nil {
+			progress.Printf("Smoke test %s: FAIL: %v\n", test.Name, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", test.Name, err))
+			continue
+		}
+		progress.Printf("Smoke test %s: ok\n", test.Name)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d smoke tests failed against version %s:\n  %s", len(failures), len(tests), qualifier, strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+func runSmokeTest(client lambdaClient, functionName, qualifier string, test SmokeTest) error {
+	result, err := client.Invoke(context.Background(), &lambda.InvokeInput{
+		FunctionName: aws.String(functionName),
+		Qualifier:    aws.String(qualifier),
+		Payload:      test.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("invoke failed: %v", err)
+	}
+	if result.StatusCode != 200 {
+		return fmt.Errorf("invoke returned status %d", result.StatusCode)
+	}
+
+	// FunctionError is set when the handler returned an error or the runtime crashed;
+	// the invoke call itself still succeeds
+	if result.FunctionError != nil {
+		message := errorMessage(result.Payload)
+		if test.WantError == "" {
+			return fmt.Errorf("function error (%s): %s", aws.ToString(result.FunctionError), message)
+		}
+		if !strings.Contains(message, test.WantError) {
+			return fmt.Errorf("function failed with %q, want %q", message, test.WantError)
+		}
+		return nil
+	}
+	if test.WantError != "" {
+		return fmt.Errorf("function succeeded, want error %q", test.WantError)
+	}
+
+	if test.WantResponse != "" && !strings.Contains(string(result.Payload), test.WantResponse) {
+		return fmt.Errorf("response %s does not contain %q", result.Payload, test.WantResponse)
+	}
+	return nil
+}
+
+// errorMessage is the errorMessage of a function error payload, or the raw payload when
+// it is not one, e.g. the text of a runtime crash.
+func errorMessage(payload []byte) string {
+	var fnErr functionError
+	if err := json.Unmarshal(payload, &fnErr); err != nil || fnErr.ErrorMessage == "" {
+		return strings.TrimSpace(string(payload))
+	}
+	return fnErr.ErrorMessage
+}
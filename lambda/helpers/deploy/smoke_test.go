@@ -0,0 +1,57 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	failing := func(params *lambda.InvokeInput) *lambda.InvokeOutput {
+		return &lambda.InvokeOutput{
+			StatusCode:    200,
+			FunctionError: aws.String("Unhandled"),
+			Payload:       []byte(`{"errorMessage":"no image tags found in event detail","errorType":"errorString"}`),
+		}
+	}
+
+	t.Run("passing tests invoke the version", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		err := Verify(client, "fn", "4", []SmokeTest{{Name: "event.json", Payload: []byte(`{}`)}})
+		assert.NoError(t, err)
+		assert.Equal(t, "4", aws.ToString(client.invoked[0].Qualifier))
+	})
+
+	t.Run("function error fails the test", func(t *testing.T) {
+		client := &mockLambdaClient{invoke: failing}
+		err := Verify(client, "fn", "4", []SmokeTest{{Name: "event.json", Payload: []byte(`{}`)}})
+		assert.ErrorContains(t, err, "no image tags found")
+		assert.ErrorContains(t, err, "failed against version 4")
+	})
+
+	t.Run("non-JSON function error reported raw", func(t *testing.T) {
+		client := &mockLambdaClient{invoke: func(params *lambda.InvokeInput) *lambda.InvokeOutput {
+			return &lambda.InvokeOutput{
+				StatusCode:    200,
+				FunctionError: aws.String("Unhandled"),
+				Payload:       []byte("Runtime exited with error: signal: killed\n"),
+			}
+		}}
+		err := Verify(client, "fn", "4", []SmokeTest{{Name: "event.json", Payload: []byte(`{}`)}})
+		assert.ErrorContains(t, err, "function error (Unhandled): Runtime exited with error: signal: killed")
+	})
+
+	t.Run("expected function error passes", func(t *testing.T) {
+		client := &mockLambdaClient{invoke: failing}
+		err := Verify(client, "fn", "4", []SmokeTest{{Name: "missing-tags", WantError: "no image tags"}})
+		assert.NoError(t, err)
+	})
+
+	t.Run("unexpected response", func(t *testing.T) {
+		client := &mockLambdaClient{}
+		err := Verify(client, "fn", "4", []SmokeTest{{Name: "event.json", WantResponse: "stored"}})
+		assert.ErrorContains(t, err, "1 of 1 smoke tests failed")
+	})
+}
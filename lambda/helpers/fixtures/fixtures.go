@@ -0,0 +1,197 @@
+// Package fixtures renders the named test events in the fixtures directory. Fixtures are
+// Go templates of EventBridge events, so dates, repository, tags and account are filled
+// in at invoke time.
+package fixtures
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultDir is the fixtures directory, relative to the lambda module.
+const DefaultDir = "fixtures"
+
+// Extension is the file extension of fixture templates.
+const Extension = ".json.tmpl"
+
+// expectErrorTemplate is the template a fixture defines to name the error the handler
+// must fail with, e.g. {{define "expect-error"}}no image tags found{{end}}.
+const expectErrorTemplate = "expect-error"
+
+// DefaultRepository and DefaultTags are the repository and comma-separated image tags
+// filled into fixtures unless the CLI is given others.
+const (
+	DefaultRepository = "my-app-repo"
+	DefaultTags       = "latest"
+)
+
+// Data fills in a fixture template.
+type Data struct {
+	Account string
+	// Partition is the account's partition, aws when empty.
+	Partition  string
+	Region     string
+	Repository string
+	Tags       []string
+	Now        time.Time
+	// ID is the event ID; a random one is generated when empty.
+	ID string
+}
+
+// NewData fills in fixtures with the given repository and comma-separated tags at now.
+// An empty account is left for the caller to resolve.
+func NewData(account, repository, tags string, now time.Time) Data {
+	return Data{
+		Account:    account,
+		Repository: repository,
+		Tags:       strings.Split(tags, ","),
+		Now:        now,
+	}
+}
+
+// Date is Now as the handler stores it.
+func (d Data) Date() string {
+	return d.Now.Format("2006-01-02")
+}
+
+// Time is Now in the format of the event's time field.
+func (d Data) Time() string {
+	return d.Now.UTC().Format(time.RFC3339)
+}
+
+// Fixture is a rendered event.
+type Fixture struct {
+	Name    string
+	Payload []byte
+	// ExpectError is the error the handler must return for this event, empty when it
+	// must succeed.
+	ExpectError string
+}
+
+var funcs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"first": func(tags []string) []string {
+		if len(tags) == 0 {
+			return tags
+		}
+		return tags[:1]
+	},
+	// multiple pads tags with the fallbacks it does not already hold until it has two,
+	// so a multi-tag event carries several tags whatever tags the CLI is given.
+	"multiple": func(tags []string, fallbacks ...string) ([]string, error) {
+		padded := append([]string(nil), tags...)
+		for _, fallback := range fallbacks {
+			if len(padded) >= 2 {
+				break
+			}
+			if !contains(padded, fallback) {
+				padded = append(padded, fallback)
+			}
+		}
+		if len(padded) < 2 {
+			return nil, fmt.Errorf("need at least two image tags, got %q", tags)
+		}
+		return padded, nil
+	},
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Names lists the fixtures in dir.
+func Names(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+Extension))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, path := range paths {
+		names = append(names, strings.TrimSuffix(filepath.Base(path), Extension))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Load renders the named fixture and checks that the result is valid JSON.
+func Load(dir, name string, data Data) (*Fixture, error) {
+	path := filepath.Join(dir, name+Extension)
+	source, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		names, _ := Names(dir)
+		return nil, fmt.Errorf("fixture %q not found in %s; available: %s", name, dir, strings.Join(names, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture %s: %v", name, err)
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s is malformed: %v", name, err)
+	}
+
+	if data.ID == "" {
+		data.ID = randomID()
+	}
+	if data.Partition == "" {
+		data.Partition = "aws"
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, fmt.Errorf("fixture %s failed to render: %v", name, err)
+	}
+	if err := checkJSON(rendered.Bytes()); err != nil {
+		return nil, fmt.Errorf("fixture %s does not render to valid JSON: %v", name, err)
+	}
+
+	fixture := &Fixture{Name: name, Payload: rendered.Bytes()}
+	if expect := tmpl.Lookup(expectErrorTemplate); expect != nil {
+		var message bytes.Buffer
+		if err := expect.Execute(&message, data); err != nil {
+			return nil, fmt.Errorf("fixture %s failed to render %s: %v", name, expectErrorTemplate, err)
+		}
+		fixture.ExpectError = strings.TrimSpace(message.String())
+	}
+	return fixture, nil
+}
+
+// checkJSON reports a syntax error with its line number, and rejects events that are
+// not objects with a detail object, which the handler cannot decode.
+func checkJSON(data []byte) error {
+	var event map[string]interface{}
+	if err := json.Unmarshal(data, &event); err != nil {
+		if syntax, ok := err.(*json.SyntaxError); ok {
+			line := bytes.Count(data[:syntax.Offset], []byte("\n")) + 1
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		return err
+	}
+	if _, ok := event["detail"].(map[string]interface{}); !ok {
+		return fmt.Errorf("event has no detail object")
+	}
+	return nil
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	return id[:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:]
+}
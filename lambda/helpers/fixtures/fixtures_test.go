@@ -0,0 +1,118 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The fixtures shipped with the deployer, relative to this package.
+const repoFixtures = "../../fixtures"
+
+func testData() Data {
+	return Data{
+		Account:    "123456789012",
+		Partition:  "aws",
+		Region:     "us-east-1",
+		Repository: "my-app-repo",
+		Tags:       []string{"latest", "v1.2.0"},
+		Now:        time.Date(2024, 5, 29, 12, 34, 56, 0, time.UTC),
+		ID:         "00000000-0000-0000-0000-000000000000",
+	}
+}
+
+func TestShippedFixtures(t *testing.T) {
+	names, err := Names(repoFixtures)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"missing-tags", "multi-tag", "scan-complete", "scan-failed"}, names)
+
+	for _, name := range names {
+		fixture, err := Load(repoFixtures, name, testData())
+		assert.NoError(t, err, name)
+
+		var event struct {
+			Account   string
+			Time      string
+			Resources []string
+			Detail    struct {
+				Repository string   `json:"repository-name"`
+				Tags       []string `json:"image-tags"`
+				Date       string
+			}
+		}
+		assert.NoError(t, json.Unmarshal(fixture.Payload, &event), name)
+		assert.Equal(t, "123456789012", event.Account, name)
+		assert.Equal(t, []string{"arn:aws:ecr:us-east-1:123456789012:repository/my-app-repo"}, event.Resources, name)
+		assert.Equal(t, "2024-05-29T12:34:56Z", event.Time, name)
+		assert.Equal(t, "my-app-repo", event.Detail.Repository, name)
+		assert.Equal(t, "2024-05-29", event.Detail.Date, name)
+
+		switch name {
+		case "multi-tag":
+			assert.Equal(t, []string{"latest", "v1.2.0"}, event.Detail.Tags)
+		case "missing-tags":
+			assert.Empty(t, event.Detail.Tags)
+			assert.Equal(t, "no image tags found", fixture.ExpectError)
+		default:
+			assert.Equal(t, []string{"latest"}, event.Detail.Tags, name)
+			assert.Empty(t, fixture.ExpectError, name)
+		}
+	}
+}
+
+// The CLI's default -event-tags has one tag, so multi-tag must add the second itself.
+func TestMultiTagWithDefaultData(t *testing.T) {
+	for tags, want := range map[string][]string{
+		DefaultTags:     {"latest", "v1.2.0"},
+		"v1.2.0":        {"v1.2.0", "latest"},
+		"v2.0.0":        {"v2.0.0", "latest"},
+		"latest,v1.2.0": {"latest", "v1.2.0"},
+		"a,b,c":         {"a", "b", "c"},
+	} {
+		data := NewData("123456789012", DefaultRepository, tags, time.Now())
+		fixture, err := Load(repoFixtures, "multi-tag", data)
+		assert.NoError(t, err, tags)
+
+		var event struct {
+			Detail struct {
+				Tags []string `json:"image-tags"`
+			}
+		}
+		assert.NoError(t, json.Unmarshal(fixture.Payload, &event), tags)
+		assert.Equal(t, want, event.Detail.Tags, tags)
+	}
+}
+
+func TestMalformedFixtures(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, source string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name+Extension), []byte(source), 0o644))
+	}
+
+	write("bad-template", `{"detail": {"repository-name": "{{.Repository}"}}`)
+	_, err := Load(dir, "bad-template", testData())
+	assert.ErrorContains(t, err, "fixture bad-template is malformed")
+
+	write("unknown-field", `{"detail": {"repository-name": "{{.Repo}}"}}`)
+	_, err = Load(dir, "unknown-field", testData())
+	assert.ErrorContains(t, err, "failed to render")
+
+	write("bad-json", "{\n\"detail\": {\n\"image-tags\": [\"latest\",]\n}\n}")
+	_, err = Load(dir, "bad-json", testData())
+	assert.ErrorContains(t, err, "line 3")
+
+	write("no-detail", `{"source": "aws.ecr"}`)
+	_, err = Load(dir, "no-detail", testData())
+	assert.ErrorContains(t, err, "no detail object")
+
+	write("one-tag", `{"detail": {"image-tags": {{json (multiple .Tags "latest")}}}}`)
+	_, err = Load(dir, "one-tag", NewData("123456789012", DefaultRepository, "latest", time.Now()))
+	assert.ErrorContains(t, err, "need at least two image tags")
+
+	_, err = Load(dir, "missing", testData())
+	assert.ErrorContains(t, err, `fixture "missing" not found`)
+}
@@ -0,0 +1,297 @@
+// Package history keeps the audit log of deploys: who deployed which commit and code,
+// the version it released, what configuration changed and how it ended. Records are
+// appended to a JSONL file and can also be inserted into MongoDB.
+package history
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"lambdax/helpers/deploy"
+)
+
+// DefaultPath is the history file, next to the state file.
+const DefaultPath = "../deployments.jsonl"
+
+// MongoCollection is the collection records are inserted into.
+const MongoCollection = "deployments"
+
+// Outcomes of a deploy.
+const (
+	OutcomeReleased   = "released"
+	OutcomeUnchanged  = "unchanged"
+	OutcomeRolledBack = "rolled-back"
+	OutcomeFailed     = "failed"
+)
+
+// Record is one deploy of one function.
+type Record struct {
+	ID       string    `json:"id" bson:"id"`
+	Time     time.Time `json:"time" bson:"time"`
+	Function string    `json:"function" bson:"function"`
+	Alias    string    `json:"alias,omitempty" bson:"alias,omitempty"`
+
+	// Caller is the ARN of the user or role that deployed, from STS.
+	Caller  string `json:"caller,omitempty" bson:"caller,omitempty"`
+	Account string `json:"account,omitempty" bson:"account,omitempty"`
+	Region  string `json:"region,omitempty" bson:"region,omitempty"`
+
+	// GitCommit is the commit of the handler's source; GitDirty is set when it had
+	// uncommitted changes.
+	GitCommit string `json:"gitCommit,omitempty" bson:"gitCommit,omitempty"`
+	GitDirty  bool   `json:"gitDirty,omitempty" bson:"gitDirty,omitempty"`
+
+	// CodeSHA256 is the package hash as Lambda reports it, or the image digest.
+	CodeSHA256      string `json:"codeSha256,omitempty" bson:"codeSha256,omitempty"`
+	Version         string `json:"version,omitempty" bson:"version,omitempty"`
+	PreviousVersion string `json:"previousVersion,omitempty" bson:"previousVersion,omitempty"`
+
+	// Changes are the configuration fields the deploy changed on the function.
+	Changes []deploy.Change `json:"changes,omitempty" bson:"changes,omitempty"`
+	// Config is the configuration deployed, with environment values replaced by
+	// EnvironmentSet or EnvironmentChanged.
+	Config map[string]interface{} `json:"config,omitempty" bson:"config,omitempty"`
+
+	Outcome  string `json:"outcome" bson:"outcome"`
+	Error    string `json:"error,omitempty" bson:"error,omitempty"`
+	Duration string `json:"duration,omitempty" bson:"duration,omitempty"`
+}
+
+// New starts the record of a deploy of the function.
+func New(functionName, alias string, now time.Time) *Record {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return &Record{
+		ID:       hex.EncodeToString(b),
+		Time:     now.UTC(),
+		Function: functionName,
+		Alias:    alias,
+	}
+}
+
+// What the history keeps of an environment value.
+const (
+	EnvironmentSet     = "<set>"
+	EnvironmentChanged = "<changed>"
+)
+
+// SetConfig records the deployed configuration. Environment values may be secrets and a
+// hash of a short one is easily reversed, so nothing of them is kept: each variable
+// only records whether the deploy changed it, as listed in Changes. Call it again once
+// Changes is set.
+func (r *Record) SetConfig(cfg *deploy.FunctionConfig) {
+	redacted := *cfg
+	if cfg.Environment != nil {
+		changed := map[string]bool{}
+		for _, change := range r.Changes {
+			if key, ok := strings.CutPrefix(change.Field, "environment."); ok {
+				changed[key] = true
+			}
+		}
+		redacted.Environment = map[string]string{}
+		for key := range cfg.Environment {
+			redacted.Environment[key] = EnvironmentSet
+			if changed[key] {
+				redacted.Environment[key] = EnvironmentChanged
+			}
+		}
+	}
+	data, _ := json.Marshal(redacted)
+	r.Config = nil
+	json.Unmarshal(data, &r.Config)
+}
+
+// Finish sets the outcome from the deploy's error and released version.
+func (r *Record) Finish(version string, err error, duration time.Duration) {
+	r.Duration = duration.Round(time.Millisecond).String()
+	switch {
+	case err != nil:
+		if r.Outcome != OutcomeRolledBack {
+			r.Outcome = OutcomeFailed
+		}
+		r.Error = err.Error()
+	case version == "":
+		r.Outcome = OutcomeUnchanged
+	default:
+		r.Outcome = OutcomeReleased
+		r.Version = version
+	}
+}
+
+// Git returns the commit checked out in dir and whether it has uncommitted changes, or
+// "" outside a git repository.
+func Git(dir string) (string, bool) {
+	commit, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", false
+	}
+	status, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--", ".").Output()
+	return strings.TrimSpace(string(commit)), err == nil && strings.TrimSpace(string(status)) != ""
+}
+
+// appendMu serializes appends of functions deployed concurrently from a manifest.
+var appendMu sync.Mutex
+
+// Append writes the record as one line at the end of the history file.
+func Append(path string, record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment record: %v", err)
+	}
+
+	appendMu.Lock()
+	defer appendMu.Unlock()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history %s: %v", path, err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write history %s: %v", path, err)
+	}
+	return f.Close()
+}
+
+// Load reads the history file, oldest record first. A missing file is an empty history.
+func Load(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("history %s line %d: %v", path, line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history %s: %v", path, err)
+	}
+	return records, nil
+}
+
+// Find returns the record with the given ID, or the only one whose ID starts with it.
+func Find(records []Record, id string) (*Record, error) {
+	var found *Record
+	for i := range records {
+		switch {
+		case records[i].ID == id:
+			return &records[i], nil
+		case strings.HasPrefix(records[i].ID, id):
+			if found != nil {
+				return nil, fmt.Errorf("deployment %q is ambiguous", id)
+			}
+			found = &records[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no deployment %q in the history", id)
+	}
+	return found, nil
+}
+
+// Diff lists what differs from deployment a to deployment b: code, version, commit,
+// caller and every configuration field.
+func Diff(a, b *Record) []deploy.Change {
+	var changes []deploy.Change
+	add := func(field, from, to string) {
+		if from != to {
+			changes = append(changes, deploy.Change{Field: field, From: quote(from), To: quote(to)})
+		}
+	}
+
+	add("function", a.Function, b.Function)
+	add("codeSha256", a.CodeSHA256, b.CodeSHA256)
+	add("version", a.Version, b.Version)
+	add("gitCommit", a.GitCommit, b.GitCommit)
+	add("caller", a.Caller, b.Caller)
+	add("outcome", a.Outcome, b.Outcome)
+
+	from, to := flatten(a.Config), flatten(b.Config)
+	for _, key := range unionKeys(from, to) {
+		add("config."+key, from[key], to[key])
+	}
+	return changes
+}
+
+// flatten turns nested configuration into dotted keys with JSON values.
+func flatten(config map[string]interface{}) map[string]string {
+	flat := map[string]string{}
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		if object, ok := value.(map[string]interface{}); ok && len(object) > 0 {
+			for key, item := range object {
+				if prefix != "" {
+					key = prefix + "." + key
+				}
+				walk(key, item)
+			}
+			return
+		}
+		data, _ := json.Marshal(value)
+		flat[prefix] = string(data)
+	}
+	walk("", config)
+	delete(flat, "")
+	return flat
+}
+
+func quote(value string) string {
+	if value == "" {
+		return "<unset>"
+	}
+	return value
+}
+
+func unionKeys(a, b map[string]string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]string{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type mongoCollection interface {
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+}
+
+// Insert stores the record in a MongoDB collection.
+func Insert(collection mongoCollection, record *Record) error {
+	if _, err := collection.InsertOne(context.Background(), record); err != nil {
+		return fmt.Errorf("failed to insert deployment record into MongoDB: %v", err)
+	}
+	return nil
+}
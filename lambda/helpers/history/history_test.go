@@ -0,0 +1,119 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"lambdax/helpers/deploy"
+)
+
+func record(id, version string, memorySize int32, environment map[string]string) *Record {
+	r := New("MyGoLambdaFunction", "live", time.Date(2024, 5, 29, 12, 0, 0, 0, time.UTC))
+	r.ID = id
+	r.Caller = "arn:aws:sts::123456789012:assumed-role/deployer/ci"
+	r.CodeSHA256 = "sha-" + version
+	r.SetConfig(&deploy.FunctionConfig{FunctionName: "MyGoLambdaFunction", MemorySize: memorySize, Environment: environment})
+	r.Finish(version, nil, 42*time.Second)
+	return r
+}
+
+func TestAppendAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deployments.jsonl")
+
+	records, err := Load(path)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	assert.NoError(t, Append(path, record("aaaa1111", "3", 128, nil)))
+	failed := New("MyGoLambdaFunction", "live", time.Now())
+	failed.Finish("", fmt.Errorf("smoke test scan-complete failed"), time.Second)
+	assert.NoError(t, Append(path, failed))
+
+	records, err = Load(path)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, OutcomeReleased, records[0].Outcome)
+	assert.Equal(t, "3", records[0].Version)
+	assert.Equal(t, "42s", records[0].Duration)
+	assert.Equal(t, OutcomeFailed, records[1].Outcome)
+	assert.Equal(t, "smoke test scan-complete failed", records[1].Error)
+}
+
+func TestFinish(t *testing.T) {
+	r := New("fn", "live", time.Now())
+	r.Finish("", nil, time.Second)
+	assert.Equal(t, OutcomeUnchanged, r.Outcome)
+
+	// A rollback during the deploy is kept as the outcome
+	r = New("fn", "live", time.Now())
+	r.Outcome = OutcomeRolledBack
+	r.Finish("", fmt.Errorf("smoke test failed"), time.Second)
+	assert.Equal(t, OutcomeRolledBack, r.Outcome)
+}
+
+func TestSetConfigRedactsEnvironment(t *testing.T) {
+	r := record("aaaa1111", "3", 128, map[string]string{"MONGO_PASSWORD": "hunter2"})
+	environment := r.Config["environment"].(map[string]interface{})
+	assert.Equal(t, EnvironmentSet, environment["MONGO_PASSWORD"])
+
+	// A value the deploy changed is marked, still without it
+	r.Changes = []deploy.Change{{Field: "environment.MONGO_PASSWORD", From: "<old value>", To: "<new value>"}}
+	r.SetConfig(&deploy.FunctionConfig{FunctionName: "MyGoLambdaFunction", Environment: map[string]string{"MONGO_PASSWORD": "hunter3"}})
+	environment = r.Config["environment"].(map[string]interface{})
+	assert.Equal(t, EnvironmentChanged, environment["MONGO_PASSWORD"])
+}
+
+func TestFind(t *testing.T) {
+	records := []Record{*record("aaaa1111", "3", 128, nil), *record("aabb2222", "4", 128, nil)}
+
+	found, err := Find(records, "aabb")
+	assert.NoError(t, err)
+	assert.Equal(t, "4", found.Version)
+
+	_, err = Find(records, "aa")
+	assert.ErrorContains(t, err, "ambiguous")
+	_, err = Find(records, "ffff")
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	a := record("aaaa1111", "3", 128, map[string]string{"LEVEL": "info", "TOKEN": "x"})
+	b := record("bbbb2222", "4", 256, map[string]string{"LEVEL": "info", "TOKEN": "y"})
+	b.Changes = []deploy.Change{{Field: "environment.TOKEN", From: "<old value>", To: "<new value>"}}
+	b.SetConfig(&deploy.FunctionConfig{FunctionName: "MyGoLambdaFunction", MemorySize: 256, Environment: map[string]string{"LEVEL": "info", "TOKEN": "y"}})
+
+	changes := Diff(a, b)
+	fields := map[string]deploy.Change{}
+	for _, change := range changes {
+		fields[change.Field] = change
+	}
+	assert.Len(t, changes, 4)
+	assert.Equal(t, "sha-3", fields["codeSha256"].From)
+	assert.Equal(t, "4", fields["version"].To)
+	assert.Equal(t, deploy.Change{Field: "config.memorySize", From: "128", To: "256"}, fields["config.memorySize"])
+	assert.Contains(t, fields, "config.environment.TOKEN")
+
+	assert.Empty(t, Diff(a, a))
+}
+
+type mockCollection struct {
+	documents []interface{}
+}
+
+func (m *mockCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	m.documents = append(m.documents, document)
+	return &mongo.InsertOneResult{InsertedID: len(m.documents)}, nil
+}
+
+func TestInsert(t *testing.T) {
+	collection := &mockCollection{}
+	assert.NoError(t, Insert(collection, record("aaaa1111", "3", 128, nil)))
+	assert.Len(t, collection.documents, 1)
+}
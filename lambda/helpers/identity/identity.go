@@ -0,0 +1,85 @@
+// Package identity resolves the account and partition the deployer runs in with STS
+// GetCallerIdentity, and builds ARNs from them, so nothing assumes a fixed account or
+// the aws partition.
+package identity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type stsClient interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// Identity is the caller's account and partition, and the region ARNs are built in.
+type Identity struct {
+	Account   string
+	Partition string
+	Region    string
+	// CallerArn is the user or role the deployer runs as.
+	CallerArn string
+}
+
+// Resolve asks STS who the caller is. The partition is taken from the caller's ARN, so
+// GovCloud (aws-us-gov) and China (aws-cn) credentials yield ARNs of their partition.
+func Resolve(client stsClient, region string) (*Identity, error) {
+	output, err := client.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %v", err)
+	}
+	callerArn := aws.ToString(output.Arn)
+	parts := strings.SplitN(callerArn, ":", 3)
+	if len(parts) < 3 || parts[0] != "arn" || parts[1] == "" {
+		return nil, fmt.Errorf("caller identity %q is not an ARN", callerArn)
+	}
+	return &Identity{
+		Account:   aws.ToString(output.Account),
+		Partition: parts[1],
+		Region:    region,
+		CallerArn: callerArn,
+	}, nil
+}
+
+// PartitionForRegion is the partition of a region, for when STS cannot be asked.
+func PartitionForRegion(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	}
+	return "aws"
+}
+
+// Arn builds the ARN of a regional resource of the caller's account.
+func (i Identity) Arn(service, resource string) string {
+	return fmt.Sprintf("arn:%s:%s:%s:%s:%s", i.Partition, service, i.Region, i.Account, resource)
+}
+
+// FunctionArn is the ARN of a Lambda function.
+func (i Identity) FunctionArn(functionName string) string {
+	return i.Arn("lambda", "function:"+functionName)
+}
+
+// RoleArn is the ARN of an IAM role; IAM ARNs have no region.
+func (i Identity) RoleArn(roleName string) string {
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", i.Partition, i.Account, roleName)
+}
+
+// RuleArn is the ARN of an EventBridge rule. Rules on the default bus leave the bus
+// out of the ARN.
+func (i Identity) RuleArn(eventBusName, ruleName string) string {
+	if eventBusName == "" || eventBusName == "default" {
+		return i.Arn("events", "rule/"+ruleName)
+	}
+	return i.Arn("events", "rule/"+eventBusName+"/"+ruleName)
+}
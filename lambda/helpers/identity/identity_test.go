@@ -0,0 +1,53 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSTSClient struct {
+	arn string
+	err error
+}
+
+func (m *mockSTSClient) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &sts.GetCallerIdentityOutput{Account: aws.String("123456789012"), Arn: aws.String(m.arn)}, nil
+}
+
+func TestResolve(t *testing.T) {
+	id, err := Resolve(&mockSTSClient{arn: "arn:aws:sts::123456789012:assumed-role/deployer/ci"}, "us-east-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "aws", id.Partition)
+	assert.Equal(t, "123456789012", id.Account)
+	assert.Equal(t, "arn:aws:lambda:us-east-1:123456789012:function:MyGoLambdaFunction", id.FunctionArn("MyGoLambdaFunction"))
+	assert.Equal(t, "arn:aws:iam::123456789012:role/MyGoLambdaFunction-exec", id.RoleArn("MyGoLambdaFunction-exec"))
+	assert.Equal(t, "arn:aws:events:us-east-1:123456789012:rule/eventbus/Rule-ECRPushEvent", id.RuleArn("eventbus", "Rule-ECRPushEvent"))
+	assert.Equal(t, "arn:aws:events:us-east-1:123456789012:rule/Rule-DebugCatchAll", id.RuleArn("default", "Rule-DebugCatchAll"))
+
+	id, err = Resolve(&mockSTSClient{arn: "arn:aws-us-gov:iam::123456789012:user/deployer"}, "us-gov-west-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws-us-gov:lambda:us-gov-west-1:123456789012:function:fn", id.FunctionArn("fn"))
+
+	id, err = Resolve(&mockSTSClient{arn: "arn:aws-cn:iam::123456789012:user/deployer"}, "cn-north-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws-cn:iam::123456789012:role/r", id.RoleArn("r"))
+
+	_, err = Resolve(&mockSTSClient{err: fmt.Errorf("ExpiredToken")}, "us-east-1")
+	assert.Error(t, err)
+	_, err = Resolve(&mockSTSClient{arn: "not-an-arn"}, "us-east-1")
+	assert.Error(t, err)
+}
+
+func TestPartitionForRegion(t *testing.T) {
+	assert.Equal(t, "aws", PartitionForRegion("eu-west-1"))
+	assert.Equal(t, "aws-cn", PartitionForRegion("cn-northwest-1"))
+	assert.Equal(t, "aws-us-gov", PartitionForRegion("us-gov-east-1"))
+}
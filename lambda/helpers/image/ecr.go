@@ -0,0 +1,68 @@
+package image
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+
+	"setup/helpers/progress"
+)
+
+type ecrClient interface {
+	GetAuthorizationToken(ctx context.Context, params *ecr.GetAuthorizationTokenInput, optFns ...func(*ecr.Options)) (*ecr.GetAuthorizationTokenOutput, error)
+	DescribeRepositories(ctx context.Context, params *ecr.DescribeRepositoriesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error)
+	CreateRepository(ctx context.Context, params *ecr.CreateRepositoryInput, optFns ...func(*ecr.Options)) (*ecr.CreateRepositoryOutput, error)
+}
+
+// ECRRegistry returns the account's ECR registry with credentials from an
+// authorization token, which is valid for 12 hours.
+func ECRRegistry(client ecrClient) (*Registry, error) {
+	result, err := client.GetAuthorizationToken(context.Background(), &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ECR authorization token: %v", err)
+	}
+	if len(result.AuthorizationData) == 0 {
+		return nil, fmt.Errorf("ECR returned no authorization data")
+	}
+	data := result.AuthorizationData[0]
+
+	// The token is base64 of "AWS:<password>"
+	token, err := base64.StdEncoding.DecodeString(aws.ToString(data.AuthorizationToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ECR authorization token: %v", err)
+	}
+	username, password, ok := strings.Cut(string(token), ":")
+	if !ok {
+		return nil, fmt.Errorf("ECR authorization token is malformed")
+	}
+	return &Registry{Endpoint: aws.ToString(data.ProxyEndpoint), Username: username, Password: password}, nil
+}
+
+// EnsureRepository creates the ECR repository if it does not exist.
+func EnsureRepository(client ecrClient, name string) error {
+	_, err := client.DescribeRepositories(context.Background(), &ecr.DescribeRepositoriesInput{
+		RepositoryNames: []string{name},
+	})
+	if err == nil {
+		return nil
+	}
+	if !strings.Contains(err.Error(), "RepositoryNotFoundException") {
+		return fmt.Errorf("failed to describe repository %s: %v", name, err)
+	}
+
+	_, err = client.CreateRepository(context.Background(), &ecr.CreateRepositoryInput{
+		RepositoryName:             aws.String(name),
+		ImageTagMutability:         types.ImageTagMutabilityMutable,
+		ImageScanningConfiguration: &types.ImageScanningConfiguration{ScanOnPush: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create repository %s: %v", name, err)
+	}
+	progress.Printf("Repository %s created\n", name)
+	return nil
+}
@@ -0,0 +1,253 @@
+// Package image builds a container image for the function in pure Go, without a Docker
+// daemon, and pushes it to ECR or any registry speaking the OCI distribution API.
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OCI media types of the image parts.
+const (
+	MediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeConfig   = "application/vnd.oci.image.config.v1+json"
+	MediaTypeLayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+// EntrypointPath is where the bootstrap binary lives in the image.
+const EntrypointPath = "/var/runtime/bootstrap"
+
+// CABundlePath is where the CA bundle is written, the path Go's crypto/x509 reads first
+// on Linux. The image has no base, so HTTPS calls need a bundle to verify AWS endpoints.
+const CABundlePath = "/etc/ssl/certs/ca-certificates.crt"
+
+// layerEpoch is the modification time of every file in the image, and the image's
+// creation time, so the same binary always gives the same digest.
+var layerEpoch = time.Unix(0, 0).UTC()
+
+// Blob is a content-addressed part of an image.
+type Blob struct {
+	MediaType string
+	Digest    string
+	Data      []byte
+}
+
+// Image is a single-layer image holding the bootstrap binary.
+type Image struct {
+	Manifest Blob
+	Config   Blob
+	Layer    Blob
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int    `json:"size"`
+}
+
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+type imageConfig struct {
+	Created      time.Time `json:"created"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Config       struct {
+		Entrypoint []string `json:"Entrypoint"`
+		Env        []string `json:"Env"`
+		WorkingDir string   `json:"WorkingDir"`
+	} `json:"config"`
+	RootFS struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// Build assembles the image for goarch: the bootstrap binary as the entrypoint and,
+// when given, a CA bundle.
+func Build(bootstrap []byte, goarch string, caBundle []byte) (*Image, error) {
+	if goarch == "" {
+		goarch = "amd64"
+	}
+
+	files := []file{{path: EntrypointPath, mode: 0o755, data: bootstrap}}
+	if len(caBundle) > 0 {
+		files = append(files, file{path: CABundlePath, mode: 0o644, data: caBundle})
+	}
+	layerTar, err := tarFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	layerGzip, err := gzipBytes(layerTar)
+	if err != nil {
+		return nil, err
+	}
+	layer := newBlob(MediaTypeLayer, layerGzip)
+
+	var cfg imageConfig
+	cfg.Created = layerEpoch
+	cfg.Architecture = goarch
+	cfg.OS = "linux"
+	cfg.Config.Entrypoint = []string{EntrypointPath}
+	cfg.Config.Env = []string{"PATH=/usr/local/bin:/usr/bin:/bin", "LAMBDA_TASK_ROOT=/var/task"}
+	cfg.Config.WorkingDir = "/var/task"
+	cfg.RootFS.Type = "layers"
+	// The diff ID is the digest of the uncompressed layer
+	cfg.RootFS.DiffIDs = []string{digest(layerTar)}
+	configJSON, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	config := newBlob(MediaTypeConfig, configJSON)
+
+	manifestJSON, err := json.Marshal(manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		Config:        config.descriptor(),
+		Layers:        []descriptor{layer.descriptor()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		Manifest: newBlob(MediaTypeManifest, manifestJSON),
+		Config:   config,
+		Layer:    layer,
+	}, nil
+}
+
+// WriteLayout writes the image as an OCI image layout in dir, tagged with tag.
+func WriteLayout(dir string, img *Image, tag string) error {
+	for _, blob := range []Blob{img.Layer, img.Config, img.Manifest} {
+		path := filepath.Join(dir, "blobs", "sha256", hex.EncodeToString(blobSum(blob)))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, blob.Data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	layout := []byte(`{"imageLayoutVersion":"1.0.0"}`)
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), layout, 0o644); err != nil {
+		return err
+	}
+
+	index := map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests": []map[string]interface{}{{
+			"mediaType":   MediaTypeManifest,
+			"digest":      img.Manifest.Digest,
+			"size":        len(img.Manifest.Data),
+			"annotations": map[string]string{"org.opencontainers.image.ref.name": tag},
+		}},
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write OCI layout %s: %v", dir, err)
+	}
+	return nil
+}
+
+type file struct {
+	path string
+	mode int64
+	data []byte
+}
+
+// tarFiles writes the files and their parent directories with fixed owners and times.
+func tarFiles(files []file) ([]byte, error) {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+
+	written := map[string]bool{}
+	for _, f := range files {
+		// Parent directories first, outermost first
+		var parents []string
+		for dir := filepath.Dir(f.path); dir != "/"; dir = filepath.Dir(dir) {
+			parents = append([]string{dir}, parents...)
+		}
+		for _, dir := range parents {
+			if written[dir] {
+				continue
+			}
+			written[dir] = true
+			err := w.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     dir[1:] + "/",
+				Mode:     0o755,
+				ModTime:  layerEpoch,
+				Format:   tar.FormatPAX,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err := w.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.path[1:],
+			Mode:     f.mode,
+			Size:     int64(len(f.data)),
+			ModTime:  layerEpoch,
+			Format:   tar.FormatPAX,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gzipBytes compresses without a name or timestamp in the header.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newBlob(mediaType string, data []byte) Blob {
+	return Blob{MediaType: mediaType, Digest: digest(data), Data: data}
+}
+
+func (b Blob) descriptor() descriptor {
+	return descriptor{MediaType: b.MediaType, Digest: b.Digest, Size: len(b.Data)}
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func blobSum(blob Blob) []byte {
+	sum := sha256.Sum256(blob.Data)
+	return sum[:]
+}
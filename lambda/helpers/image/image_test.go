@@ -0,0 +1,177 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	first, err := Build([]byte("binary"), "arm64", []byte("cert"))
+	assert.NoError(t, err)
+	second, err := Build([]byte("binary"), "arm64", []byte("cert"))
+	assert.NoError(t, err)
+	assert.Equal(t, first.Manifest.Digest, second.Manifest.Digest)
+
+	var cfg imageConfig
+	assert.NoError(t, json.Unmarshal(first.Config.Data, &cfg))
+	assert.Equal(t, "arm64", cfg.Architecture)
+	assert.Equal(t, []string{EntrypointPath}, cfg.Config.Entrypoint)
+
+	gz, err := gzip.NewReader(bytes.NewReader(first.Layer.Data))
+	assert.NoError(t, err)
+	files := map[string]int64{}
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		files[header.Name] = header.Mode
+	}
+	assert.Equal(t, int64(0o755), files["var/runtime/bootstrap"])
+	assert.Equal(t, int64(0o644), files["etc/ssl/certs/ca-certificates.crt"])
+	assert.Contains(t, files, "var/runtime/")
+
+	other, err := Build([]byte("changed binary"), "arm64", nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Manifest.Digest, other.Manifest.Digest)
+}
+
+func TestWriteLayout(t *testing.T) {
+	img, err := Build([]byte("binary"), "amd64", nil)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	assert.NoError(t, WriteLayout(dir, img, "latest"))
+
+	index, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(index), img.Manifest.Digest)
+
+	manifest, err := os.ReadFile(filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(img.Manifest.Digest, "sha256:")))
+	assert.NoError(t, err)
+	assert.Equal(t, img.Manifest.Data, manifest)
+}
+
+// registryStandIn is a local stand-in for an OCI distribution registry. It keeps blobs
+// and manifests in memory and requires basic auth.
+type registryStandIn struct {
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   map[string][]byte
+	blobPuts  int
+}
+
+func newRegistryStandIn(t *testing.T) (*registryStandIn, *Registry) {
+	standIn := &registryStandIn{blobs: map[string][]byte{}, manifests: map[string][]byte{}, uploads: map[string][]byte{}}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+	return standIn, &Registry{Endpoint: server.URL, Username: "AWS", Password: "token"}
+}
+
+func (s *registryStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, password, ok := r.BasicAuth(); !ok || user != "AWS" || password != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodHead && strings.Contains(path, "/blobs/"):
+		if _, ok := s.blobs[path[strings.LastIndex(path, "/")+1:]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/blobs/uploads/"):
+		id := fmt.Sprint(len(s.uploads) + 1)
+		s.uploads[id] = nil
+		w.Header().Set("Location", path+id)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPatch:
+		id := path[strings.LastIndex(path, "/")+1:]
+		body, _ := io.ReadAll(r.Body)
+		s.uploads[id] = append(s.uploads[id], body...)
+		w.Header().Set("Location", path)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && strings.Contains(path, "/blobs/uploads/"):
+		id := path[strings.LastIndex(path, "/")+1:]
+		s.blobs[r.URL.Query().Get("digest")] = s.uploads[id]
+		s.blobPuts++
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && strings.Contains(path, "/manifests/"):
+		body, _ := io.ReadAll(r.Body)
+		s.manifests[path] = body
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPush(t *testing.T) {
+	standIn, registry := newRegistryStandIn(t)
+	img, err := Build([]byte("binary"), "amd64", nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, registry.Push("my-go-lambda", "latest", img))
+	assert.Equal(t, img.Layer.Data, standIn.blobs[img.Layer.Digest])
+	assert.Equal(t, img.Config.Data, standIn.blobs[img.Config.Digest])
+	assert.Equal(t, img.Manifest.Data, standIn.manifests["/v2/my-go-lambda/manifests/latest"])
+
+	// Blobs already in the registry are not uploaded again
+	assert.NoError(t, registry.Push("my-go-lambda", "v2", img))
+	assert.Equal(t, 2, standIn.blobPuts)
+
+	assert.Equal(t, registry.Host()+"/my-go-lambda@"+img.Manifest.Digest, registry.ImageURI("my-go-lambda", img.Manifest.Digest))
+
+	registry.Password = "wrong"
+	assert.ErrorContains(t, registry.Push("my-go-lambda", "latest", img), "401")
+}
+
+func TestECRRegistry(t *testing.T) {
+	client := &mockECRClient{}
+	registry, err := ECRRegistry(client)
+	assert.NoError(t, err)
+	assert.Equal(t, "AWS", registry.Username)
+	assert.Equal(t, "secret", registry.Password)
+	assert.Equal(t, "123456789012.dkr.ecr.us-east-1.amazonaws.com", registry.Host())
+
+	assert.NoError(t, EnsureRepository(client, "my-go-lambda"))
+	assert.Equal(t, "my-go-lambda", client.created)
+}
+
+type mockECRClient struct {
+	created string
+}
+
+func (m *mockECRClient) GetAuthorizationToken(ctx context.Context, params *ecr.GetAuthorizationTokenInput, optFns ...func(*ecr.Options)) (*ecr.GetAuthorizationTokenOutput, error) {
+	return &ecr.GetAuthorizationTokenOutput{AuthorizationData: []types.AuthorizationData{{
+		AuthorizationToken: aws.String(base64.StdEncoding.EncodeToString([]byte("AWS:secret"))),
+		ProxyEndpoint:      aws.String("https://123456789012.dkr.ecr.us-east-1.amazonaws.com"),
+	}}}, nil
+}
+
+func (m *mockECRClient) DescribeRepositories(ctx context.Context, params *ecr.DescribeRepositoriesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error) {
+	return nil, fmt.Errorf("RepositoryNotFoundException: repository does not exist")
+}
+
+func (m *mockECRClient) CreateRepository(ctx context.Context, params *ecr.CreateRepositoryInput, optFns ...func(*ecr.Options)) (*ecr.CreateRepositoryOutput, error) {
+	m.created = aws.ToString(params.RepositoryName)
+	return &ecr.CreateRepositoryOutput{}, nil
+}
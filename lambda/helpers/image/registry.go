@@ -0,0 +1,157 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"setup/helpers/progress"
+)
+
+// Registry is a registry speaking the OCI distribution API, such as ECR.
+type Registry struct {
+	// Endpoint is the registry URL, e.g. https://123456789012.dkr.ecr.us-east-1.amazonaws.com.
+	Endpoint string
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+// Host is the registry host as it appears in image URIs.
+func (r *Registry) Host() string {
+	return strings.TrimPrefix(strings.TrimPrefix(r.Endpoint, "https://"), "http://")
+}
+
+// ImageURI references an image in repository by digest, which Lambda resolves to
+// exactly the pushed image.
+func (r *Registry) ImageURI(repository, digest string) string {
+	return r.Host() + "/" + repository + "@" + digest
+}
+
+// Push uploads the layer, config and manifest of the image to repository and tags it.
+// Blobs the registry already has are skipped.
+func (r *Registry) Push(repository, tag string, img *Image) error {
+	for _, blob := range []Blob{img.Layer, img.Config} {
+		if err := r.pushBlob(repository, blob); err != nil {
+			return err
+		}
+	}
+
+	req, err := r.request(http.MethodPut, "/v2/"+repository+"/manifests/"+tag, img.Manifest.Data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", img.Manifest.MediaType)
+	if _, err := r.do(req, http.StatusCreated); err != nil {
+		return fmt.Errorf("failed to push manifest %s:%s: %v", repository, tag, err)
+	}
+	progress.Printf("Pushed %s/%s:%s (%s)\n", r.Host(), repository, tag, img.Manifest.Digest)
+	return nil
+}
+
+func (r *Registry) pushBlob(repository string, blob Blob) error {
+	req, err := r.request(http.MethodHead, "/v2/"+repository+"/blobs/"+blob.Digest, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := r.do(req, http.StatusOK); err == nil {
+		return nil
+	}
+
+	// Start an upload session, send the blob in one chunk and commit it by digest
+	req, err = r.request(http.MethodPost, "/v2/"+repository+"/blobs/uploads/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.do(req, http.StatusAccepted)
+	if err != nil {
+		return fmt.Errorf("failed to start upload of %s: %v", blob.Digest, err)
+	}
+	location, err := r.resolve(resp.Header.Get("Location"))
+	if err != nil {
+		return err
+	}
+
+	req, err = http.NewRequest(http.MethodPatch, location.String(), bytes.NewReader(blob.Data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", "0-"+strconv.Itoa(len(blob.Data)-1))
+	r.authorize(req)
+	resp, err = r.do(req, http.StatusAccepted)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", blob.Digest, err)
+	}
+	if next := resp.Header.Get("Location"); next != "" {
+		if location, err = r.resolve(next); err != nil {
+			return err
+		}
+	}
+
+	query := location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+	req, err = http.NewRequest(http.MethodPut, location.String(), nil)
+	if err != nil {
+		return err
+	}
+	r.authorize(req)
+	if _, err := r.do(req, http.StatusCreated); err != nil {
+		return fmt.Errorf("failed to commit %s: %v", blob.Digest, err)
+	}
+	return nil
+}
+
+func (r *Registry) request(method, path string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(r.Endpoint, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	r.authorize(req)
+	return req, nil
+}
+
+func (r *Registry) authorize(req *http.Request) {
+	if r.Username != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+}
+
+// resolve turns an upload Location, which may be relative, into an absolute URL.
+func (r *Registry) resolve(location string) (*url.URL, error) {
+	base, err := url.Parse(r.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("registry returned invalid upload location %q: %v", location, err)
+	}
+	return base.ResolveReference(ref), nil
+}
+
+func (r *Registry) do(req *http.Request, want int) (*http.Response, error) {
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != want {
+		return nil, fmt.Errorf("%s %s returned %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,228 @@
+// Package logs follows the function's CloudWatch log group by polling FilterLogEvents,
+// so the handler's output can be read without opening the console.
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// DefaultPollInterval is how often Tail asks for new events when following.
+const DefaultPollInterval = 2 * time.Second
+
+type logsClient interface {
+	FilterLogEvents(ctx context.Context, params *cloudwatchlogs.FilterLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error)
+}
+
+// Options select the events Tail prints.
+type Options struct {
+	LogGroup string
+	// StartTime is the oldest event printed.
+	StartTime time.Time
+	// FilterPattern is a CloudWatch Logs filter pattern, applied by the service.
+	FilterPattern string
+	// RequestID keeps only the lines of one invocation.
+	RequestID string
+	// Follow keeps polling for new events until the context is done.
+	Follow       bool
+	PollInterval time.Duration
+	// JSON prints each event as a JSON object on one line, for scripts, instead of Format.
+	JSON bool
+}
+
+// Lambda marks the lines of an invocation with START, END and REPORT lines in text
+// format, and with a requestId field in JSON format.
+var platformLine = regexp.MustCompile(`^(START|END|REPORT) RequestId: ([0-9a-fA-F-]+)`)
+
+// Tail prints the matching events of the log group to out, oldest first. With
+// opts.Follow it polls for new events until ctx is done.
+func Tail(ctx context.Context, client logsClient, opts Options, out io.Writer) error {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	t := &tail{opts: opts, out: out, requests: map[string]string{}, seen: map[string]bool{}}
+	start := opts.StartTime
+	for {
+		latest, err := t.poll(ctx, client, start)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if !opts.Follow {
+			return nil
+		}
+		// Ask again from the newest timestamp seen; events at that millisecond that
+		// were already printed are skipped by ID
+		if !latest.IsZero() {
+			start = latest
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+type tail struct {
+	opts Options
+	out  io.Writer
+	// requests holds the invocation each log stream is in, from its last START line
+	requests map[string]string
+	// seen holds the IDs of printed events at the newest timestamp
+	seen       map[string]bool
+	seenAtTime int64
+}
+
+// poll prints the events since start and returns the timestamp of the newest one.
+func (t *tail) poll(ctx context.Context, client logsClient, start time.Time) (time.Time, error) {
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: aws.String(t.opts.LogGroup),
+		StartTime:    aws.Int64(start.UnixMilli()),
+	}
+	if t.opts.FilterPattern != "" {
+		input.FilterPattern = aws.String(t.opts.FilterPattern)
+	}
+
+	var latest time.Time
+	paginator := cloudwatchlogs.NewFilterLogEventsPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return latest, fmt.Errorf("failed to read log group %s: %v", t.opts.LogGroup, err)
+		}
+		for _, event := range page.Events {
+			timestamp := aws.ToInt64(event.Timestamp)
+			if timestamp < t.seenAtTime || t.seen[aws.ToString(event.EventId)] {
+				continue
+			}
+			if timestamp > t.seenAtTime {
+				t.seen = map[string]bool{}
+				t.seenAtTime = timestamp
+			}
+			t.seen[aws.ToString(event.EventId)] = true
+			latest = time.UnixMilli(timestamp)
+
+			if !t.matches(event) {
+				continue
+			}
+			if t.opts.JSON {
+				fmt.Fprintln(t.out, FormatJSON(event))
+			} else {
+				fmt.Fprintln(t.out, Format(event))
+			}
+		}
+	}
+	return latest, nil
+}
+
+// matches applies the request ID filter, following START and END lines per stream.
+func (t *tail) matches(event types.FilteredLogEvent) bool {
+	message := aws.ToString(event.Message)
+	stream := aws.ToString(event.LogStreamName)
+
+	requestID := t.requests[stream]
+	if match := platformLine.FindStringSubmatch(message); match != nil {
+		requestID = match[2]
+		switch match[1] {
+		case "START":
+			t.requests[stream] = requestID
+		case "END":
+			delete(t.requests, stream)
+		}
+	} else if id := jsonRequestID(message); id != "" {
+		requestID = id
+	}
+
+	return t.opts.RequestID == "" || requestID == t.opts.RequestID
+}
+
+// Format renders an event as its time, the short log stream name and the message.
+// JSON messages are indented.
+func Format(event types.FilteredLogEvent) string {
+	timestamp := time.UnixMilli(aws.ToInt64(event.Timestamp)).UTC().Format("2006-01-02T15:04:05.000Z")
+
+	// Streams are named date/[version]id; the id is enough to tell instances apart
+	stream := aws.ToString(event.LogStreamName)
+	if i := strings.LastIndex(stream, "]"); i >= 0 {
+		stream = stream[i+1:]
+	}
+	if len(stream) > 8 {
+		stream = stream[:8]
+	}
+
+	message := strings.TrimRight(aws.ToString(event.Message), "\n")
+	trimmed := strings.TrimSpace(message)
+	if strings.HasPrefix(trimmed, "{") {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, []byte(trimmed), "", "  "); err == nil {
+			message = indented.String()
+		}
+	}
+	return fmt.Sprintf("%s %s %s", timestamp, stream, message)
+}
+
+// FormatJSON renders an event as a JSON object with its time, log stream and message.
+func FormatJSON(event types.FilteredLogEvent) string {
+	data, _ := json.Marshal(struct {
+		Timestamp string `json:"timestamp"`
+		LogStream string `json:"logStream"`
+		Message   string `json:"message"`
+	}{
+		Timestamp: time.UnixMilli(aws.ToInt64(event.Timestamp)).UTC().Format("2006-01-02T15:04:05.000Z"),
+		LogStream: aws.ToString(event.LogStreamName),
+		Message:   strings.TrimRight(aws.ToString(event.Message), "\n"),
+	})
+	return string(data)
+}
+
+// jsonRequestID returns the requestId of a JSON log line, or "".
+func jsonRequestID(message string) string {
+	if !strings.HasPrefix(strings.TrimSpace(message), "{") {
+		return ""
+	}
+	var line struct {
+		RequestID string `json:"requestId"`
+		Record    struct {
+			RequestID string `json:"requestId"`
+		} `json:"record"`
+	}
+	if err := json.Unmarshal([]byte(message), &line); err != nil {
+		return ""
+	}
+	if line.RequestID != "" {
+		return line.RequestID
+	}
+	// Platform events in JSON format carry it in the record
+	return line.Record.RequestID
+}
+
+// ParseSince parses a start time given on the command line: a duration before now,
+// such as 15m, or an RFC 3339 time.
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration like 15m nor an RFC 3339 time", value)
+}
@@ -0,0 +1,140 @@
+package logs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const stream = "2024/05/01/[$LATEST]0123456789abcdef"
+
+func TestTail(t *testing.T) {
+	client := &mockLogsClient{events: []types.FilteredLogEvent{
+		event("1", 1000, "START RequestId: aaaa-1111 Version: 3"),
+		event("2", 1001, "2024/05/01 12:00:00 image tag: latest"),
+		event("3", 1002, "END RequestId: aaaa-1111"),
+		event("4", 1003, "START RequestId: bbbb-2222 Version: 3"),
+		event("5", 1004, "2024/05/01 12:00:01 image tag: v1.2.0"),
+		event("6", 1005, "END RequestId: bbbb-2222"),
+	}}
+
+	t.Run("all events", func(t *testing.T) {
+		var out bytes.Buffer
+		err := Tail(context.Background(), client, Options{LogGroup: "/aws/lambda/fn", StartTime: time.UnixMilli(900), FilterPattern: "tag"}, &out)
+		assert.NoError(t, err)
+		assert.Len(t, strings.Split(strings.TrimSpace(out.String()), "\n"), 6)
+		assert.Equal(t, "/aws/lambda/fn", aws.ToString(client.inputs[0].LogGroupName))
+		assert.Equal(t, int64(900), aws.ToInt64(client.inputs[0].StartTime))
+		assert.Equal(t, "tag", aws.ToString(client.inputs[0].FilterPattern))
+	})
+
+	t.Run("one request", func(t *testing.T) {
+		var out bytes.Buffer
+		err := Tail(context.Background(), client, Options{LogGroup: "/aws/lambda/fn", RequestID: "bbbb-2222"}, &out)
+		assert.NoError(t, err)
+		assert.NotContains(t, out.String(), "latest")
+		assert.Contains(t, out.String(), "v1.2.0")
+		assert.Len(t, strings.Split(strings.TrimSpace(out.String()), "\n"), 3)
+	})
+
+	t.Run("JSON request ID", func(t *testing.T) {
+		client := &mockLogsClient{events: []types.FilteredLogEvent{
+			event("1", 1000, `{"level":"INFO","msg":"stored tag","requestId":"cccc-3333"}`),
+			event("2", 1001, `{"level":"INFO","msg":"other","requestId":"dddd-4444"}`),
+		}}
+		var out bytes.Buffer
+		err := Tail(context.Background(), client, Options{LogGroup: "/aws/lambda/fn", RequestID: "cccc-3333"}, &out)
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "stored tag")
+		assert.NotContains(t, out.String(), "other")
+	})
+}
+
+func TestTailFollow(t *testing.T) {
+	client := &mockLogsClient{events: []types.FilteredLogEvent{event("1", 1000, "first")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	client.onCall = func(calls int) {
+		switch calls {
+		case 2:
+			// The same millisecond again, plus a new event in it
+			client.events = append(client.events, event("2", 1000, "second"))
+		case 3:
+			cancel()
+		}
+	}
+
+	var out bytes.Buffer
+	err := Tail(ctx, client, Options{LogGroup: "/aws/lambda/fn", Follow: true, PollInterval: time.Millisecond}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(out.String(), "first"))
+	assert.Equal(t, 1, strings.Count(out.String(), "second"))
+	assert.Equal(t, int64(1000), aws.ToInt64(client.inputs[1].StartTime))
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "1970-01-01T00:00:01.000Z 01234567 image tag: latest",
+		Format(event("1", 1000, "image tag: latest\n")))
+
+	formatted := Format(event("1", 1000, `{"level":"INFO","msg":"stored"}`))
+	assert.Equal(t, "1970-01-01T00:00:01.000Z 01234567 {\n  \"level\": \"INFO\",\n  \"msg\": \"stored\"\n}", formatted)
+
+	// Not JSON after all: printed as is
+	assert.Equal(t, "1970-01-01T00:00:01.000Z 01234567 {not json", Format(event("1", 1000, "{not json")))
+}
+
+func TestFormatJSON(t *testing.T) {
+	assert.JSONEq(t, `{"timestamp":"1970-01-01T00:00:01.000Z","logStream":"`+stream+`","message":"image tag: latest"}`,
+		FormatJSON(event("1", 1000, "image tag: latest\n")))
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	since, err := ParseSince("15m", now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-15*time.Minute), since)
+
+	since, err = ParseSince("2024-05-01T10:00:00Z", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), since)
+
+	_, err = ParseSince("yesterday", now)
+	assert.Error(t, err)
+}
+
+func event(id string, timestamp int64, message string) types.FilteredLogEvent {
+	return types.FilteredLogEvent{
+		EventId:       aws.String(id),
+		Timestamp:     aws.Int64(timestamp),
+		LogStreamName: aws.String(stream),
+		Message:       aws.String(message),
+	}
+}
+
+type mockLogsClient struct {
+	events []types.FilteredLogEvent
+	onCall func(calls int)
+
+	inputs []*cloudwatchlogs.FilterLogEventsInput
+}
+
+func (client *mockLogsClient) FilterLogEvents(ctx context.Context, params *cloudwatchlogs.FilterLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	client.inputs = append(client.inputs, params)
+	if client.onCall != nil {
+		client.onCall(len(client.inputs))
+	}
+	var events []types.FilteredLogEvent
+	for _, event := range client.events {
+		if aws.ToInt64(event.Timestamp) >= aws.ToInt64(params.StartTime) {
+			events = append(events, event)
+		}
+	}
+	return &cloudwatchlogs.FilterLogEventsOutput{Events: events}, nil
+}
@@ -0,0 +1,135 @@
+// Package manifest reads the list of functions the deployer builds and deploys
+// together, and runs their deploys on a bounded pool of workers.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lambdax/helpers/deploy"
+)
+
+// DefaultWorkers is how many functions are built and deployed at once.
+const DefaultWorkers = 4
+
+// Manifest lists the functions to deploy.
+type Manifest struct {
+	Functions []Function `json:"functions"`
+}
+
+// Function is one function of the manifest. Paths are relative to the manifest.
+type Function struct {
+	// Package is the directory of the handler's Go package.
+	Package string `json:"package"`
+	// Output is where the deployment zip is written; defaults to
+	// <package>/lambdaFunction.zip.
+	Output string `json:"output,omitempty"`
+	// Config is the function configuration, in the format of function.json.
+	Config string `json:"config"`
+	// Triggers are the EventBridge rules, as recorded by setup, allowed to invoke the
+	// function. Empty means the rules setup pointed at the deployed function.
+	Triggers []string `json:"triggers,omitempty"`
+	// Smoke are the fixtures or event files the new version is smoke tested with.
+	Smoke []string `json:"smoke,omitempty"`
+
+	// FunctionConfig is the loaded Config.
+	FunctionConfig *deploy.FunctionConfig `json:"-"`
+}
+
+// Name is the function's name from its configuration.
+func (f Function) Name() string {
+	return f.FunctionConfig.FunctionName
+}
+
+// Load reads the manifest and the configuration of every function in it.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %v", path, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %v", path, err)
+	}
+	if len(m.Functions) == 0 {
+		return nil, fmt.Errorf("manifest %s lists no functions", path)
+	}
+
+	dir := filepath.Dir(path)
+	names := map[string]bool{}
+	for i := range m.Functions {
+		f := &m.Functions[i]
+		if f.Package == "" || f.Config == "" {
+			return nil, fmt.Errorf("manifest %s: function %d needs package and config", path, i+1)
+		}
+		f.Package = filepath.Join(dir, f.Package)
+		f.Config = filepath.Join(dir, f.Config)
+		if f.Output == "" {
+			f.Output = filepath.Join(f.Package, "lambdaFunction.zip")
+		} else {
+			f.Output = filepath.Join(dir, f.Output)
+		}
+
+		if f.FunctionConfig, err = deploy.LoadConfig(f.Config); err != nil {
+			return nil, err
+		}
+		if names[f.Name()] {
+			return nil, fmt.Errorf("manifest %s lists function %s twice", path, f.Name())
+		}
+		names[f.Name()] = true
+	}
+	return &m, nil
+}
+
+// Result is the outcome of deploying one function.
+type Result struct {
+	Name string
+	// Version is the version the deploy released, empty when nothing changed.
+	Version  string
+	Err      error
+	Duration time.Duration
+}
+
+// Run deploys every function with at most workers deploys in flight, and returns the
+// results in manifest order. A failed deploy does not stop the others.
+func Run(functions []Function, workers int, deployFunction func(Function) (string, error)) []Result {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]Result, len(functions))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(functions); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := time.Now()
+				version, err := deployFunction(functions[i])
+				results[i] = Result{Name: functions[i].Name(), Version: version, Err: err, Duration: time.Since(start)}
+			}
+		}()
+	}
+	for i := range functions {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// Failed counts the results with an error.
+func Failed(results []Result) int {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,108 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func functionConfig(name string) string {
+	return fmt.Sprintf(`{"functionName": %q, "role": "arn:aws:iam::123456789012:role/lambda-exec"}`, name)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "tags.json"), functionConfig("TagStore"))
+	writeFile(t, filepath.Join(dir, "report.json"), functionConfig("Report"))
+	writeFile(t, filepath.Join(dir, "manifest.json"), `{"functions": [
+		{"package": "lambda_function", "config": "tags.json", "triggers": ["Rule-ECRPushEvent"]},
+		{"package": "report", "output": "build/report.zip", "config": "report.json"}
+	]}`)
+
+	m, err := Load(filepath.Join(dir, "manifest.json"))
+	assert.NoError(t, err)
+	assert.Len(t, m.Functions, 2)
+
+	tags := m.Functions[0]
+	assert.Equal(t, "TagStore", tags.Name())
+	assert.Equal(t, filepath.Join(dir, "lambda_function"), tags.Package)
+	assert.Equal(t, filepath.Join(dir, "lambda_function", "lambdaFunction.zip"), tags.Output)
+	assert.Equal(t, []string{"Rule-ECRPushEvent"}, tags.Triggers)
+
+	report := m.Functions[1]
+	assert.Equal(t, "Report", report.Name())
+	assert.Equal(t, filepath.Join(dir, "build", "report.zip"), report.Output)
+	assert.Equal(t, "bootstrap", report.FunctionConfig.Handler)
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "tags.json"), functionConfig("TagStore"))
+
+	writeFile(t, filepath.Join(dir, "empty.json"), `{"functions": []}`)
+	_, err := Load(filepath.Join(dir, "empty.json"))
+	assert.ErrorContains(t, err, "lists no functions")
+
+	writeFile(t, filepath.Join(dir, "twice.json"), `{"functions": [
+		{"package": "a", "config": "tags.json"},
+		{"package": "b", "config": "tags.json"}
+	]}`)
+	_, err = Load(filepath.Join(dir, "twice.json"))
+	assert.ErrorContains(t, err, "lists function TagStore twice")
+
+	writeFile(t, filepath.Join(dir, "incomplete.json"), `{"functions": [{"package": "a"}]}`)
+	_, err = Load(filepath.Join(dir, "incomplete.json"))
+	assert.ErrorContains(t, err, "needs package and config")
+}
+
+func TestRun(t *testing.T) {
+	var functions []Function
+	for i := 0; i < 6; i++ {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "function.json"), functionConfig(fmt.Sprintf("fn-%d", i)))
+		writeFile(t, filepath.Join(dir, "manifest.json"), `{"functions": [{"package": ".", "config": "function.json"}]}`)
+		m, err := Load(filepath.Join(dir, "manifest.json"))
+		assert.NoError(t, err)
+		functions = append(functions, m.Functions...)
+	}
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	results := Run(functions, 2, func(f Function) (string, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		if f.Name() == "fn-3" {
+			return "", fmt.Errorf("smoke test failed")
+		}
+		return "7", nil
+	})
+
+	assert.Equal(t, 2, maxInFlight)
+	assert.Len(t, results, 6)
+	for i, result := range results {
+		assert.Equal(t, fmt.Sprintf("fn-%d", i), result.Name)
+	}
+	assert.Equal(t, "7", results[0].Version)
+	assert.EqualError(t, results[3].Err, "smoke test failed")
+	assert.Equal(t, 1, Failed(results))
+}
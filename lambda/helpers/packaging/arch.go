@@ -0,0 +1,95 @@
+package packaging
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+)
+
+// Lambda architecture names keyed by GOARCH.
+var lambdaArchitectures = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "arm64",
+}
+
+var elfMachines = map[elf.Machine]string{
+	elf.EM_X86_64:  "amd64",
+	elf.EM_AARCH64: "arm64",
+}
+
+// LambdaArchitecture returns the Lambda architecture ("x86_64" or "arm64") for a GOARCH.
+func LambdaArchitecture(goarch string) (string, error) {
+	arch, ok := lambdaArchitectures[goarch]
+	if !ok {
+		return "", fmt.Errorf("unsupported architecture %q, use amd64 or arm64", goarch)
+	}
+	return arch, nil
+}
+
+// GoArch returns the GOARCH for a Lambda architecture, the inverse of LambdaArchitecture.
+func GoArch(lambdaArch string) (string, error) {
+	for goarch, arch := range lambdaArchitectures {
+		if arch == lambdaArch {
+			return goarch, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported Lambda architecture %q", lambdaArch)
+}
+
+// BinaryArch returns the GOARCH an ELF binary was built for.
+func BinaryArch(binary []byte) (string, error) {
+	f, err := elf.NewFile(bytes.NewReader(binary))
+	if err != nil {
+		return "", fmt.Errorf("bootstrap is not a Linux ELF binary: %v", err)
+	}
+	defer f.Close()
+
+	goarch, ok := elfMachines[f.Machine]
+	if !ok {
+		return "", fmt.Errorf("bootstrap is built for unsupported machine %s", f.Machine)
+	}
+	return goarch, nil
+}
+
+// ZipArch returns the GOARCH of the bootstrap binary inside a deployment zip.
+func ZipArch(archive []byte) (string, error) {
+	binary, err := Bootstrap(archive)
+	if err != nil {
+		return "", err
+	}
+	return BinaryArch(binary)
+}
+
+// Bootstrap extracts the bootstrap binary from a deployment zip.
+func Bootstrap(archive []byte) ([]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("deployment package is not a zip: %v", err)
+	}
+	for _, f := range r.File {
+		if f.Name != BootstrapName {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("deployment package has no %s entry", BootstrapName)
+}
+
+// CheckArch refuses a deployment zip whose bootstrap does not match goarch.
+func CheckArch(archive []byte, goarch string) error {
+	actual, err := ZipArch(archive)
+	if err != nil {
+		return err
+	}
+	if actual != goarch {
+		return fmt.Errorf("bootstrap is built for %s but the function is configured for %s", actual, goarch)
+	}
+	return nil
+}
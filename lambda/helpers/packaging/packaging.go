@@ -0,0 +1,177 @@
+// Package packaging cross-compiles the Lambda handler and zips it into a deployment
+// package, replacing the old build.sh.
+package packaging
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"setup/helpers/progress"
+)
+
+// BootstrapName is the executable name the provided.* runtimes start.
+const BootstrapName = "bootstrap"
+
+// zipEpoch is the timestamp written for every zip entry, so the same binary always
+// produces byte-identical packages. It is the earliest time the zip format can encode.
+var zipEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Options control a package build.
+type Options struct {
+	// SourceDir is the Go package of the handler, e.g. "lambda_function".
+	SourceDir string
+	// OutputZip is where the deployment package is written.
+	OutputZip string
+	// GOARCH is the target architecture; empty means amd64.
+	GOARCH string
+}
+
+// Result describes a built package.
+type Result struct {
+	ZipPath string
+	// SHA256 is the base64 SHA-256 of the zip, the same form Lambda reports as CodeSha256.
+	SHA256 string
+	Size   int
+}
+
+// Package builds the handler and writes the deployment zip.
+func Package(ctx context.Context, opts Options) (*Result, error) {
+	tmpDir, err := os.MkdirTemp("", "lambda-build-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binary := filepath.Join(tmpDir, BootstrapName)
+	if err := Build(ctx, opts.SourceDir, binary, opts.GOARCH); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(binary)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := Zip(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(opts.OutputZip, archive, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", opts.OutputZip, err)
+	}
+
+	return &Result{ZipPath: opts.OutputZip, SHA256: Hash(archive), Size: len(archive)}, nil
+}
+
+// Build cross-compiles the package in sourceDir into a static Linux binary. The flags
+// strip paths, VCS stamps and build IDs so identical sources give identical binaries.
+func Build(ctx context.Context, sourceDir, output, goarch string) error {
+	if goarch == "" {
+		goarch = "amd64"
+	}
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "build",
+		"-tags", "lambda.norpc",
+		"-trimpath",
+		"-buildvcs=false",
+		"-ldflags", "-s -w -buildid=",
+		"-o", absOutput,
+		".",
+	)
+	cmd.Dir = sourceDir
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+goarch, "CGO_ENABLED=0")
+	cmd.Stdout = progress.Out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go build failed for %s (GOARCH=%s): %v", sourceDir, goarch, err)
+	}
+	return nil
+}
+
+// Zip returns a deployment zip holding the binary as an executable bootstrap entry.
+// Timestamps and modes are fixed, so the output depends only on the binary.
+func Zip(bootstrap []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	if err := writeEntry(w, BootstrapName, 0o755, bootstrap); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ZipDir zips every regular file under dir, e.g. a layer's contents, with paths relative
+// to dir. Entries are sorted and timestamps fixed, and files are 0755 when executable and
+// 0644 otherwise, so the output depends only on the file names and contents.
+func ZipDir(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	// WalkDir visits entries in lexical order
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		mode := fs.FileMode(0o644)
+		if info.Mode()&0o111 != 0 {
+			mode = 0o755
+		}
+		return writeEntry(w, filepath.ToSlash(rel), mode, data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to zip %s: %v", dir, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeEntry(w *zip.Writer, name string, mode fs.FileMode, data []byte) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: zipEpoch,
+	}
+	header.SetMode(mode)
+
+	f, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// Hash returns the base64 SHA-256 of a package.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
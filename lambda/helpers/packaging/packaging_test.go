@@ -0,0 +1,121 @@
+package packaging
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZipIsDeterministic(t *testing.T) {
+	first, err := Zip([]byte("binary"))
+	assert.NoError(t, err)
+	second, err := Zip([]byte("binary"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Equal(t, Hash(first), Hash(second))
+
+	other, err := Zip([]byte("changed binary"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, Hash(first), Hash(other))
+}
+
+func TestZipBootstrapEntry(t *testing.T) {
+	archive, err := Zip([]byte("binary"))
+	assert.NoError(t, err)
+
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	assert.NoError(t, err)
+	assert.Len(t, r.File, 1)
+
+	entry := r.File[0]
+	assert.Equal(t, BootstrapName, entry.Name)
+	assert.Equal(t, os.FileMode(0o755), entry.Mode().Perm())
+	assert.True(t, entry.Modified.Equal(zipEpoch))
+
+	rc, err := entry.Open()
+	assert.NoError(t, err)
+	content, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "binary", string(content))
+}
+
+func TestZipDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "extensions"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "extensions", "telemetry"), []byte("binary"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca-bundle.pem"), []byte("cert"), 0o600))
+
+	first, err := ZipDir(dir)
+	assert.NoError(t, err)
+	second, err := ZipDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, Hash(first), Hash(second))
+
+	reader, err := zip.NewReader(bytes.NewReader(first), int64(len(first)))
+	assert.NoError(t, err)
+	assert.Len(t, reader.File, 2)
+	assert.Equal(t, "ca-bundle.pem", reader.File[0].Name)
+	assert.Equal(t, os.FileMode(0o644), reader.File[0].Mode())
+	assert.Equal(t, "extensions/telemetry", reader.File[1].Name)
+	assert.Equal(t, os.FileMode(0o755), reader.File[1].Mode())
+}
+
+func TestPackage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles a binary")
+	}
+
+	src := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "go.mod"), []byte("module handler\n\ngo 1.22\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+
+	out := filepath.Join(t.TempDir(), "function.zip")
+	first, err := Package(context.Background(), Options{SourceDir: src, OutputZip: out})
+	assert.NoError(t, err)
+
+	second, err := Package(context.Background(), Options{SourceDir: src, OutputZip: out})
+	assert.NoError(t, err)
+	assert.Equal(t, first.SHA256, second.SHA256)
+
+	onDisk, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, Hash(onDisk), second.SHA256)
+	assert.NoError(t, CheckArch(onDisk, "amd64"))
+
+	_, err = Package(context.Background(), Options{SourceDir: src, OutputZip: out, GOARCH: "arm64"})
+	assert.NoError(t, err)
+	arm, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.NoError(t, CheckArch(arm, "arm64"))
+	assert.EqualError(t, CheckArch(arm, "amd64"), "bootstrap is built for arm64 but the function is configured for amd64")
+}
+
+func TestCheckArchRejectsNonELF(t *testing.T) {
+	archive, err := Zip([]byte("#!/bin/sh\nexec ./handler\n"))
+	assert.NoError(t, err)
+	assert.Error(t, CheckArch(archive, "amd64"))
+}
+
+func TestLambdaArchitecture(t *testing.T) {
+	arch, err := LambdaArchitecture("arm64")
+	assert.NoError(t, err)
+	assert.Equal(t, "arm64", arch)
+
+	arch, err = LambdaArchitecture("amd64")
+	assert.NoError(t, err)
+	assert.Equal(t, "x86_64", arch)
+
+	_, err = LambdaArchitecture("386")
+	assert.Error(t, err)
+
+	goarch, err := GoArch("x86_64")
+	assert.NoError(t, err)
+	assert.Equal(t, "amd64", goarch)
+}
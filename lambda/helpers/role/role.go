@@ -0,0 +1,218 @@
+// Package role creates or verifies the function's execution role, with an inline policy
+// limited to what the handler does.
+package role
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+
+	"setup/helpers/progress"
+)
+
+// PolicyName is the inline policy the deployer manages on the role.
+const PolicyName = "lambda-least-privilege"
+
+// LambdaService is the principal that must be trusted to assume an execution role.
+const LambdaService = "lambda.amazonaws.com"
+
+// propagationDelay is how long a new role is given before Lambda can assume it. IAM is
+// eventually consistent and CreateFunction rejects a role it cannot assume yet.
+var propagationDelay = 10 * time.Second
+
+type iamClient interface {
+	GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	CreateRole(ctx context.Context, params *iam.CreateRoleInput, optFns ...func(*iam.Options)) (*iam.CreateRoleOutput, error)
+	PutRolePolicy(ctx context.Context, params *iam.PutRolePolicyInput, optFns ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error)
+}
+
+// Permissions are the resources the handler touches.
+type Permissions struct {
+	Region       string
+	FunctionName string
+	// LogGroup defaults to /aws/lambda/<FunctionName>.
+	LogGroup string
+	// ParameterPath is the SSM parameter name, or a path with a trailing *, the handler
+	// writes with ssm:PutParameter.
+	ParameterPath string
+	// SecretID is the Secrets Manager secret holding the MongoDB credentials.
+	SecretID string
+}
+
+// PolicyDocument is an IAM policy.
+type PolicyDocument struct {
+	Version   string
+	Statement []Statement
+}
+
+// Statement is a single IAM policy statement.
+type Statement struct {
+	Sid       string `json:",omitempty"`
+	Effect    string
+	Principal map[string]string `json:",omitempty"`
+	Action    []string
+	Resource  []string `json:",omitempty"`
+}
+
+// TrustPolicy lets Lambda assume the role.
+func TrustPolicy() PolicyDocument {
+	return PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []Statement{{
+			Effect:    "Allow",
+			Principal: map[string]string{"Service": LambdaService},
+			Action:    []string{"sts:AssumeRole"},
+		}},
+	}
+}
+
+// ExecutionPolicy allows exactly what the handler does: write its parameter, read the
+// MongoDB secret and write its own logs.
+func ExecutionPolicy(partition, account string, p Permissions) PolicyDocument {
+	logGroup := p.LogGroup
+	if logGroup == "" {
+		logGroup = "/aws/lambda/" + p.FunctionName
+	}
+	logGroupArn := fmt.Sprintf("arn:%s:logs:%s:%s:log-group:%s", partition, p.Region, account, logGroup)
+
+	return PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []Statement{
+			{
+				Sid:      "WriteImageTagParameter",
+				Effect:   "Allow",
+				Action:   []string{"ssm:PutParameter"},
+				Resource: []string{fmt.Sprintf("arn:%s:ssm:%s:%s:parameter/%s", partition, p.Region, account, strings.TrimPrefix(p.ParameterPath, "/"))},
+			},
+			{
+				Sid:    "ReadMongoCredentials",
+				Effect: "Allow",
+				Action: []string{"secretsmanager:GetSecretValue"},
+				// Secrets Manager appends a random 6-character suffix to secret ARNs
+				Resource: []string{fmt.Sprintf("arn:%s:secretsmanager:%s:%s:secret:%s-??????", partition, p.Region, account, p.SecretID)},
+			},
+			{
+				Sid:      "WriteFunctionLogs",
+				Effect:   "Allow",
+				Action:   []string{"logs:CreateLogGroup", "logs:CreateLogStream", "logs:PutLogEvents"},
+				Resource: []string{logGroupArn, logGroupArn + ":*"},
+			},
+		},
+	}
+}
+
+// Ensure creates the role if it does not exist, verifies the trust policy of an
+// existing one, and puts the least-privilege inline policy. It returns the role ARN.
+func Ensure(client iamClient, roleName string, p Permissions) (string, error) {
+	existing, err := client.GetRole(context.Background(), &iam.GetRoleInput{RoleName: aws.String(roleName)})
+	var roleArn string
+	switch {
+	case err == nil:
+		if err := verifyTrust(roleName, aws.ToString(existing.Role.AssumeRolePolicyDocument)); err != nil {
+			return "", err
+		}
+		roleArn = aws.ToString(existing.Role.Arn)
+	case strings.Contains(err.Error(), "NoSuchEntity"):
+		trust, _ := json.Marshal(TrustPolicy())
+		created, err := client.CreateRole(context.Background(), &iam.CreateRoleInput{
+			RoleName:                 aws.String(roleName),
+			AssumeRolePolicyDocument: aws.String(string(trust)),
+			Description:              aws.String("Execution role of " + p.FunctionName),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to create role %s: %v", roleName, err)
+		}
+		roleArn = aws.ToString(created.Role.Arn)
+		progress.Printf("Role created: %s\n", roleArn)
+		defer func() {
+			progress.Printf("Waiting %s for the new role to propagate\n", propagationDelay)
+			time.Sleep(propagationDelay)
+		}()
+	default:
+		return "", fmt.Errorf("failed to get role %s: %v", roleName, err)
+	}
+
+	partition, account, err := partitionAndAccount(roleArn)
+	if err != nil {
+		return "", err
+	}
+	policy, _ := json.Marshal(ExecutionPolicy(partition, account, p))
+	_, err = client.PutRolePolicy(context.Background(), &iam.PutRolePolicyInput{
+		RoleName:       aws.String(roleName),
+		PolicyName:     aws.String(PolicyName),
+		PolicyDocument: aws.String(string(policy)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to put policy %s on role %s: %v", PolicyName, roleName, err)
+	}
+	progress.Printf("Policy %s applied to role %s\n", PolicyName, roleName)
+	return roleArn, nil
+}
+
+// Verify checks that an existing role, given by ARN, can be assumed by Lambda.
+func Verify(client iamClient, roleArn string) error {
+	roleName := roleArn[strings.LastIndex(roleArn, "/")+1:]
+	existing, err := client.GetRole(context.Background(), &iam.GetRoleInput{RoleName: aws.String(roleName)})
+	if err != nil {
+		return fmt.Errorf("failed to get role %s: %v", roleArn, err)
+	}
+	return verifyTrust(roleName, aws.ToString(existing.Role.AssumeRolePolicyDocument))
+}
+
+// verifyTrust checks that a trust policy, URL-encoded as IAM returns it, allows Lambda
+// to assume the role.
+func verifyTrust(roleName, document string) error {
+	decoded, err := url.QueryUnescape(document)
+	if err != nil {
+		return fmt.Errorf("role %s: failed to decode trust policy: %v", roleName, err)
+	}
+
+	var policy struct {
+		Statement []struct {
+			Effect    string
+			Principal struct {
+				Service interface{}
+			}
+			Action interface{}
+		}
+	}
+	if err := json.Unmarshal([]byte(decoded), &policy); err != nil {
+		return fmt.Errorf("role %s: failed to parse trust policy: %v", roleName, err)
+	}
+
+	for _, statement := range policy.Statement {
+		if statement.Effect == "Allow" && contains(statement.Principal.Service, LambdaService) && contains(statement.Action, "sts:AssumeRole") {
+			return nil
+		}
+	}
+	return fmt.Errorf("role %s does not trust %s, so Lambda cannot assume it", roleName, LambdaService)
+}
+
+// contains matches a policy value, which is either a string or a list of strings.
+func contains(value interface{}, want string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == want
+	case []interface{}:
+		for _, item := range v {
+			if item == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func partitionAndAccount(roleArn string) (string, string, error) {
+	parts := strings.Split(roleArn, ":")
+	if len(parts) < 6 || parts[2] != "iam" {
+		return "", "", fmt.Errorf("%q is not an IAM role ARN", roleArn)
+	}
+	return parts[1], parts[4], nil
+}
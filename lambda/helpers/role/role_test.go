@@ -0,0 +1,117 @@
+package role
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPermissions() Permissions {
+	return Permissions{
+		Region:        "us-east-1",
+		FunctionName:  "MyGoLambdaFunction",
+		ParameterPath: "my-app-repo",
+		SecretID:      "myApp/mongo-db-credentials",
+	}
+}
+
+func TestExecutionPolicy(t *testing.T) {
+	policy := ExecutionPolicy("aws", "123456789012", testPermissions())
+	assert.Len(t, policy.Statement, 3)
+
+	resources := map[string][]string{}
+	for _, statement := range policy.Statement {
+		assert.Equal(t, "Allow", statement.Effect)
+		for _, action := range statement.Action {
+			assert.NotContains(t, action, "*")
+			resources[action] = statement.Resource
+		}
+	}
+	assert.Equal(t, []string{"arn:aws:ssm:us-east-1:123456789012:parameter/my-app-repo"}, resources["ssm:PutParameter"])
+	assert.Equal(t, []string{"arn:aws:secretsmanager:us-east-1:123456789012:secret:myApp/mongo-db-credentials-??????"}, resources["secretsmanager:GetSecretValue"])
+	assert.Equal(t, []string{
+		"arn:aws:logs:us-east-1:123456789012:log-group:/aws/lambda/MyGoLambdaFunction",
+		"arn:aws:logs:us-east-1:123456789012:log-group:/aws/lambda/MyGoLambdaFunction:*",
+	}, resources["logs:PutLogEvents"])
+}
+
+func TestEnsure(t *testing.T) {
+	propagationDelay = 0
+
+	t.Run("role created", func(t *testing.T) {
+		client := &mockIAMClient{}
+		arn, err := Ensure(client, "MyGoLambdaFunction-exec", testPermissions())
+		assert.NoError(t, err)
+		assert.Equal(t, "arn:aws:iam::123456789012:role/MyGoLambdaFunction-exec", arn)
+		assert.Contains(t, client.trust, LambdaService)
+		assert.Contains(t, client.policy, "arn:aws:ssm:us-east-1:123456789012:parameter/my-app-repo")
+	})
+
+	t.Run("existing role verified", func(t *testing.T) {
+		client := &mockIAMClient{existingTrust: trustDocument(t, "lambda.amazonaws.com")}
+		_, err := Ensure(client, "MyGoLambdaFunction-exec", testPermissions())
+		assert.NoError(t, err)
+		assert.Empty(t, client.trust)
+		assert.NotEmpty(t, client.policy)
+	})
+
+	t.Run("existing role not trusting lambda", func(t *testing.T) {
+		client := &mockIAMClient{existingTrust: trustDocument(t, "ec2.amazonaws.com")}
+		_, err := Ensure(client, "MyGoLambdaFunction-exec", testPermissions())
+		assert.ErrorContains(t, err, "does not trust lambda.amazonaws.com")
+		assert.Empty(t, client.policy)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	client := &mockIAMClient{existingTrust: url.QueryEscape(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":["edgelambda.amazonaws.com","lambda.amazonaws.com"]},"Action":"sts:AssumeRole"}]}`)}
+	assert.NoError(t, Verify(client, "arn:aws:iam::123456789012:role/service-role/exec"))
+
+	_, _, err := partitionAndAccount("arn:aws:lambda:us-east-1:123456789012:function:fn")
+	assert.Error(t, err)
+}
+
+// trustDocument returns a trust policy for service, URL-encoded as GetRole returns it.
+func trustDocument(t *testing.T, service string) string {
+	policy := TrustPolicy()
+	policy.Statement[0].Principal["Service"] = service
+	data, err := json.Marshal(policy)
+	assert.NoError(t, err)
+	return url.QueryEscape(string(data))
+}
+
+type mockIAMClient struct {
+	// existingTrust is the trust policy of an existing role; empty means no role
+	existingTrust string
+	trust         string
+	policy        string
+}
+
+func (m *mockIAMClient) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	if m.existingTrust == "" {
+		return nil, fmt.Errorf("NoSuchEntity: The role with name %s cannot be found", aws.ToString(params.RoleName))
+	}
+	return &iam.GetRoleOutput{Role: &types.Role{
+		Arn:                      aws.String("arn:aws:iam::123456789012:role/" + aws.ToString(params.RoleName)),
+		AssumeRolePolicyDocument: aws.String(m.existingTrust),
+	}}, nil
+}
+
+func (m *mockIAMClient) CreateRole(ctx context.Context, params *iam.CreateRoleInput, optFns ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+	m.trust = aws.ToString(params.AssumeRolePolicyDocument)
+	return &iam.CreateRoleOutput{Role: &types.Role{
+		Arn: aws.String("arn:aws:iam::123456789012:role/" + aws.ToString(params.RoleName)),
+	}}, nil
+}
+
+func (m *mockIAMClient) PutRolePolicy(ctx context.Context, params *iam.PutRolePolicyInput, optFns ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+	m.policy = aws.ToString(params.PolicyDocument)
+	return &iam.PutRolePolicyOutput{}, nil
+}
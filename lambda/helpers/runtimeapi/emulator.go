@@ -0,0 +1,315 @@
+// Package runtimeapi emulates the Lambda Runtime API, so the compiled bootstrap can be
+// run locally exactly as Lambda runs it: it polls for the next invocation and posts
+// the response or error back, under a deadline and with a request ID.
+package runtimeapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiPrefix is the path prefix of every Runtime API endpoint.
+const apiPrefix = "/2018-06-01/runtime/"
+
+// Config describes the emulated function.
+type Config struct {
+	FunctionName string
+	// FunctionArn is sent as the invoked function ARN.
+	FunctionArn string
+	// Timeout is the deadline of each invocation.
+	Timeout time.Duration
+}
+
+// FunctionError is the error a runtime reports for an invocation or its init.
+type FunctionError struct {
+	ErrorMessage string   `json:"errorMessage"`
+	ErrorType    string   `json:"errorType"`
+	StackTrace   []string `json:"stackTrace,omitempty"`
+}
+
+func (e *FunctionError) Error() string {
+	if e.ErrorType == "" {
+		return e.ErrorMessage
+	}
+	return e.ErrorType + ": " + e.ErrorMessage
+}
+
+// Result is the outcome of an invocation.
+type Result struct {
+	RequestID string
+	// Payload is the response, empty when the invocation failed.
+	Payload []byte
+	// Error is set when the function, its init or the deadline failed the invocation.
+	Error    *FunctionError
+	Duration time.Duration
+	TimedOut bool
+}
+
+type invocation struct {
+	id       string
+	payload  []byte
+	deadline time.Time
+	start    time.Time
+	done     chan *Result
+	once     sync.Once
+}
+
+func (i *invocation) finish(result *Result) {
+	i.once.Do(func() {
+		result.RequestID = i.id
+		result.Duration = time.Since(i.start)
+		i.done <- result
+	})
+}
+
+// Emulator serves the Runtime API on a local port. It hands out one invocation at a
+// time, like a single Lambda execution environment.
+type Emulator struct {
+	config   Config
+	listener net.Listener
+	server   *http.Server
+
+	next chan *invocation
+
+	mu       sync.Mutex
+	current  *invocation
+	initErr  *FunctionError
+	initDone chan struct{}
+}
+
+// Start serves the Runtime API on a free port of 127.0.0.1.
+func Start(config Config) (*Emulator, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = 3 * time.Second
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the Runtime API: %v", err)
+	}
+
+	e := &Emulator{
+		config:   config,
+		listener: listener,
+		next:     make(chan *invocation),
+		initDone: make(chan struct{}),
+	}
+	e.server = &http.Server{Handler: e}
+	go e.server.Serve(listener)
+	return e, nil
+}
+
+// Address is the host:port the runtime reads from AWS_LAMBDA_RUNTIME_API.
+func (e *Emulator) Address() string {
+	return e.listener.Addr().String()
+}
+
+// Close stops the server; invocations in flight fail.
+func (e *Emulator) Close() error {
+	e.Fail(&FunctionError{ErrorType: "Runtime.Shutdown", ErrorMessage: "emulator closed"})
+	return e.server.Close()
+}
+
+// InitError returns the error the runtime reported during init, or nil.
+func (e *Emulator) InitError() *FunctionError {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.initErr
+}
+
+// Invoke queues the payload for the runtime and waits for its response, error or the
+// deadline. A deadline that passes leaves the runtime busy; the caller restarts it.
+func (e *Emulator) Invoke(ctx context.Context, payload []byte) (*Result, error) {
+	if err := e.InitError(); err != nil {
+		return &Result{Error: err}, nil
+	}
+
+	inv := &invocation{
+		id:      newRequestID(),
+		payload: payload,
+		done:    make(chan *Result, 1),
+	}
+	inv.start = time.Now()
+	inv.deadline = inv.start.Add(e.config.Timeout)
+	timer := time.NewTimer(e.config.Timeout)
+	defer timer.Stop()
+
+	// Wait for the runtime to ask for the invocation; the deadline runs from now, as
+	// Lambda counts a slow init against the first invocation
+	select {
+	case e.next <- inv:
+	case <-e.initDone:
+		return &Result{RequestID: inv.id, Error: e.InitError(), Duration: time.Since(inv.start)}, nil
+	case <-timer.C:
+		return e.timedOut(inv), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case result := <-inv.done:
+		return result, nil
+	case <-timer.C:
+		return e.timedOut(inv), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (e *Emulator) timedOut(inv *invocation) *Result {
+	inv.finish(&Result{
+		TimedOut: true,
+		Error: &FunctionError{
+			ErrorType:    "Sandbox.Timedout",
+			ErrorMessage: fmt.Sprintf("Task timed out after %.2f seconds", e.config.Timeout.Seconds()),
+		},
+	})
+	e.mu.Lock()
+	if e.current == inv {
+		e.current = nil
+	}
+	e.mu.Unlock()
+	return <-inv.done
+}
+
+// Fail ends the invocation in flight with err, e.g. when the runtime process exits.
+func (e *Emulator) Fail(err *FunctionError) {
+	e.mu.Lock()
+	inv := e.current
+	e.current = nil
+	e.mu.Unlock()
+	if inv != nil {
+		inv.finish(&Result{Error: err})
+	}
+}
+
+// ServeHTTP implements the Runtime API.
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	switch {
+	case r.Method == http.MethodGet && path == "invocation/next":
+		e.handleNext(w, r)
+	case r.Method == http.MethodPost && path == "init/error":
+		e.handleInitError(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "invocation/"):
+		id, action, _ := strings.Cut(strings.TrimPrefix(path, "invocation/"), "/")
+		switch action {
+		case "response":
+			e.handleResult(w, r, id, false)
+		case "error":
+			e.handleResult(w, r, id, true)
+		default:
+			writeError(w, http.StatusNotFound, "InvalidRequest", "unknown endpoint "+r.URL.Path)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "InvalidRequest", "unknown endpoint "+r.Method+" "+r.URL.Path)
+	}
+}
+
+// handleNext blocks until an invocation is queued and sends it with the headers
+// aws-lambda-go reads: request ID, deadline, function ARN and trace ID.
+func (e *Emulator) handleNext(w http.ResponseWriter, r *http.Request) {
+	select {
+	case inv := <-e.next:
+		e.mu.Lock()
+		e.current = inv
+		e.mu.Unlock()
+
+		w.Header().Set("Lambda-Runtime-Aws-Request-Id", inv.id)
+		w.Header().Set("Lambda-Runtime-Deadline-Ms", strconv.FormatInt(inv.deadline.UnixMilli(), 10))
+		w.Header().Set("Lambda-Runtime-Invoked-Function-Arn", e.config.FunctionArn)
+		w.Header().Set("Lambda-Runtime-Trace-Id", "Root=1-"+strconv.FormatInt(inv.start.Unix(), 16)+"-"+strings.ReplaceAll(inv.id, "-", "")[:24]+";Sampled=0")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(inv.payload)
+	case <-r.Context().Done():
+	}
+}
+
+func (e *Emulator) handleResult(w http.ResponseWriter, r *http.Request, id string, failed bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+
+	e.mu.Lock()
+	inv := e.current
+	if inv == nil || inv.id != id {
+		e.mu.Unlock()
+		// Lambda answers a late or unknown request ID with 400, as it does for
+		// responses after the deadline
+		writeError(w, http.StatusBadRequest, "InvalidRequestID", "invalid request ID "+id)
+		return
+	}
+	e.current = nil
+	e.mu.Unlock()
+
+	result := &Result{}
+	if failed {
+		result.Error = parseFunctionError(body, r.Header.Get("Lambda-Runtime-Function-Error-Type"))
+	} else {
+		result.Payload = body
+	}
+	inv.finish(result)
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status":"OK"}`))
+}
+
+func (e *Emulator) handleInitError(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
+		return
+	}
+
+	e.mu.Lock()
+	if e.initErr != nil {
+		e.mu.Unlock()
+		writeError(w, http.StatusForbidden, "InvalidStateTransition", "init error already reported")
+		return
+	}
+	e.initErr = parseFunctionError(body, r.Header.Get("Lambda-Runtime-Function-Error-Type"))
+	if e.initErr.ErrorType == "" {
+		e.initErr.ErrorType = "Runtime.InitError"
+	}
+	close(e.initDone)
+	e.mu.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status":"OK"}`))
+}
+
+func parseFunctionError(body []byte, errorType string) *FunctionError {
+	var functionError FunctionError
+	if err := json.Unmarshal(body, &functionError); err != nil {
+		functionError.ErrorMessage = string(body)
+	}
+	if functionError.ErrorType == "" {
+		functionError.ErrorType = errorType
+	}
+	return &functionError
+}
+
+func writeError(w http.ResponseWriter, status int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"errorType": errorType, "errorMessage": message})
+}
+
+// newRequestID returns a random ID in the UUID format Lambda uses.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	s := hex.EncodeToString(b)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
@@ -0,0 +1,165 @@
+package runtimeapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"lambdax/helpers/packaging"
+)
+
+const functionArn = "arn:aws:lambda:us-east-1:123456789012:function:MyGoLambdaFunction"
+
+func startEmulator(t *testing.T, timeout time.Duration) *Emulator {
+	t.Helper()
+	e, err := Start(Config{FunctionName: "MyGoLambdaFunction", FunctionArn: functionArn, Timeout: timeout})
+	assert.NoError(t, err)
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+// next asks for the next invocation as a runtime does.
+func next(t *testing.T, e *Emulator) (http.Header, []byte) {
+	t.Helper()
+	resp, err := http.Get("http://" + e.Address() + "/2018-06-01/runtime/invocation/next")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.Header, body
+}
+
+func post(t *testing.T, e *Emulator, path, body string) int {
+	t.Helper()
+	resp, err := http.Post("http://"+e.Address()+"/2018-06-01/runtime/"+path, "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestInvokeResponse(t *testing.T) {
+	e := startEmulator(t, 3*time.Second)
+
+	go func() {
+		headers, payload := next(t, e)
+		id := headers.Get("Lambda-Runtime-Aws-Request-Id")
+		assert.Equal(t, functionArn, headers.Get("Lambda-Runtime-Invoked-Function-Arn"))
+		deadline, err := strconv.ParseInt(headers.Get("Lambda-Runtime-Deadline-Ms"), 10, 64)
+		assert.NoError(t, err)
+		assert.InDelta(t, time.Now().Add(3*time.Second).UnixMilli(), deadline, 1000)
+		assert.Contains(t, headers.Get("Lambda-Runtime-Trace-Id"), "Root=1-")
+
+		// A response for another request ID is refused
+		assert.Equal(t, http.StatusBadRequest, post(t, e, "invocation/not-the-id/response", `{}`))
+		assert.Equal(t, http.StatusAccepted, post(t, e, "invocation/"+id+"/response", `{"echo":`+string(payload)+`}`))
+	}()
+
+	result, err := e.Invoke(context.Background(), []byte(`{"detail":{}}`))
+	assert.NoError(t, err)
+	assert.Nil(t, result.Error)
+	assert.JSONEq(t, `{"echo":{"detail":{}}}`, string(result.Payload))
+	assert.Len(t, result.RequestID, 36)
+}
+
+func TestInvokeError(t *testing.T) {
+	e := startEmulator(t, 3*time.Second)
+
+	go func() {
+		headers, _ := next(t, e)
+		id := headers.Get("Lambda-Runtime-Aws-Request-Id")
+		post(t, e, "invocation/"+id+"/error", `{"errorMessage":"no image tags found","errorType":"errorString"}`)
+	}()
+
+	result, err := e.Invoke(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &FunctionError{ErrorMessage: "no image tags found", ErrorType: "errorString"}, result.Error)
+}
+
+func TestInvokeTimeout(t *testing.T) {
+	e := startEmulator(t, 50*time.Millisecond)
+
+	ids := make(chan string, 1)
+	go func() {
+		headers, _ := next(t, e)
+		ids <- headers.Get("Lambda-Runtime-Aws-Request-Id")
+	}()
+
+	result, err := e.Invoke(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.True(t, result.TimedOut)
+	assert.Equal(t, "Task timed out after 0.05 seconds", result.Error.ErrorMessage)
+
+	// The late response is refused
+	assert.Equal(t, http.StatusBadRequest, post(t, e, "invocation/"+<-ids+"/response", `{}`))
+}
+
+func TestInitError(t *testing.T) {
+	e := startEmulator(t, 3*time.Second)
+	assert.Equal(t, http.StatusAccepted, post(t, e, "init/error", `{"errorMessage":"missing config","errorType":"Runtime.Unknown"}`))
+	assert.Equal(t, http.StatusForbidden, post(t, e, "init/error", `{}`))
+
+	result, err := e.Invoke(context.Background(), []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "missing config", result.Error.ErrorMessage)
+	assert.Equal(t, "Runtime.Unknown", e.InitError().ErrorType)
+}
+
+func TestRuntime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles a binary")
+	}
+
+	// The handler is built as it is for Lambda, with lambda.norpc, for this host
+	bootstrap := filepath.Join(t.TempDir(), packaging.BootstrapName)
+	assert.NoError(t, packaging.Build(context.Background(), "testdata/echo", bootstrap, runtime.GOARCH))
+
+	e := startEmulator(t, 2*time.Second)
+	var logs bytes.Buffer
+	r := &Runtime{Emulator: e, Bootstrap: bootstrap, Stdout: &logs, Stderr: &logs}
+	t.Cleanup(r.Stop)
+
+	var response struct {
+		Action      string `json:"action"`
+		RequestID   string `json:"requestId"`
+		FunctionArn string `json:"functionArn"`
+		HasDeadline bool   `json:"hasDeadline"`
+	}
+
+	result, err := r.Invoke(context.Background(), []byte(`{"action":"echo"}`))
+	assert.NoError(t, err)
+	assert.Nil(t, result.Error)
+	assert.NoError(t, json.Unmarshal(result.Payload, &response))
+	assert.Equal(t, result.RequestID, response.RequestID)
+	assert.Equal(t, functionArn, response.FunctionArn)
+	assert.True(t, response.HasDeadline)
+
+	result, err = r.Invoke(context.Background(), []byte(`{"action":"fail"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "asked to fail", result.Error.ErrorMessage)
+
+	result, err = r.Invoke(context.Background(), []byte(`{"action":"exit"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "Runtime.ExitError", result.Error.ErrorType)
+
+	// A new bootstrap serves the next invocation
+	result, err = r.Invoke(context.Background(), []byte(`{"action":"echo"}`))
+	assert.NoError(t, err)
+	assert.Nil(t, result.Error)
+
+	result, err = r.Invoke(context.Background(), []byte(`{"action":"sleep"}`))
+	assert.NoError(t, err)
+	assert.True(t, result.TimedOut)
+
+	result, err = r.Invoke(context.Background(), []byte(`{"action":"echo"}`))
+	assert.NoError(t, err)
+	assert.Nil(t, result.Error)
+}
@@ -0,0 +1,127 @@
+package runtimeapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// Runtime runs a bootstrap binary against an emulator, restarting it after a timeout
+// or crash as Lambda replaces a broken execution environment.
+type Runtime struct {
+	Emulator  *Emulator
+	Bootstrap string
+	// MemorySize is reported to the function in AWS_LAMBDA_FUNCTION_MEMORY_SIZE.
+	MemorySize int32
+	// Env is added to the host environment, which passes AWS credentials and region
+	// through to the function.
+	Env    []string
+	Stdout io.Writer
+	Stderr io.Writer
+
+	cmd     *exec.Cmd
+	exited  chan struct{}
+	exitErr error
+}
+
+// Start starts the bootstrap.
+func (r *Runtime) Start() error {
+	memorySize := r.MemorySize
+	if memorySize == 0 {
+		memorySize = 128
+	}
+	name := r.Emulator.config.FunctionName
+
+	cmd := exec.Command(r.Bootstrap)
+	cmd.Dir = filepath.Dir(r.Bootstrap)
+	cmd.Env = append(os.Environ(),
+		"AWS_LAMBDA_RUNTIME_API="+r.Emulator.Address(),
+		"AWS_LAMBDA_FUNCTION_NAME="+name,
+		"AWS_LAMBDA_FUNCTION_VERSION=$LATEST",
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE="+strconv.Itoa(int(memorySize)),
+		"AWS_LAMBDA_LOG_GROUP_NAME=/aws/lambda/"+name,
+		"AWS_LAMBDA_LOG_STREAM_NAME=local",
+		"_HANDLER="+filepath.Base(r.Bootstrap),
+		"LAMBDA_TASK_ROOT="+cmd.Dir,
+	)
+	cmd.Env = append(cmd.Env, r.Env...)
+	cmd.Stdout = r.Stdout
+	cmd.Stderr = r.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %v", r.Bootstrap, err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		r.exitErr = cmd.Wait()
+		close(exited)
+	}()
+	r.cmd, r.exited = cmd, exited
+	return nil
+}
+
+// Stop kills the bootstrap, if it is running.
+func (r *Runtime) Stop() {
+	if r.cmd == nil {
+		return
+	}
+	r.cmd.Process.Kill()
+	<-r.exited
+	r.cmd = nil
+}
+
+// Invoke sends the payload to the bootstrap, starting it first if needed. A bootstrap
+// that exits fails the invocation with Runtime.ExitError and is started again on the
+// next one; one that times out is killed.
+func (r *Runtime) Invoke(ctx context.Context, payload []byte) (*Result, error) {
+	if r.cmd != nil {
+		select {
+		case <-r.exited:
+			// Exited after its last invocation
+			r.cmd = nil
+		default:
+		}
+	}
+	if r.cmd == nil {
+		if err := r.Start(); err != nil {
+			return nil, err
+		}
+	}
+
+	invokeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	exited := r.exited
+	go func() {
+		select {
+		case <-exited:
+			cancel()
+		case <-invokeCtx.Done():
+		}
+	}()
+
+	result, err := r.Emulator.Invoke(invokeCtx, payload)
+	if err != nil && ctx.Err() == nil {
+		// The bootstrap exited before answering
+		r.cmd = nil
+		exitErr := &FunctionError{
+			ErrorType:    "Runtime.ExitError",
+			ErrorMessage: fmt.Sprintf("Runtime exited with error: %v", r.exitErr),
+		}
+		r.Emulator.Fail(exitErr)
+		if initErr := r.Emulator.InitError(); initErr != nil {
+			return &Result{Error: initErr}, nil
+		}
+		return &Result{Error: exitErr}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.TimedOut {
+		r.Stop()
+	}
+	return result, nil
+}
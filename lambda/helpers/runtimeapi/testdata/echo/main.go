@@ -0,0 +1,42 @@
+// Command echo is a handler for the runtime tests: it echoes the event with the
+// invocation's request ID and deadline, fails, sleeps or exits when the event asks.
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+type event struct {
+	Action string `json:"action"`
+}
+
+type response struct {
+	Action      string `json:"action"`
+	RequestID   string `json:"requestId"`
+	FunctionArn string `json:"functionArn"`
+	HasDeadline bool   `json:"hasDeadline"`
+}
+
+func handle(ctx context.Context, e event) (*response, error) {
+	switch e.Action {
+	case "fail":
+		return nil, errors.New("asked to fail")
+	case "sleep":
+		time.Sleep(time.Minute)
+	case "exit":
+		os.Exit(3)
+	}
+	lc, _ := lambdacontext.FromContext(ctx)
+	_, hasDeadline := ctx.Deadline()
+	return &response{Action: e.Action, RequestID: lc.AwsRequestID, FunctionArn: lc.InvokedFunctionArn, HasDeadline: hasDeadline}, nil
+}
+
+func main() {
+	lambda.Start(handle)
+}
@@ -6,6 +6,7 @@ import (
     "fmt"
     "log"
     "math/rand"
+    "os"
     "time"
  
     "github.com/aws/aws-lambda-go/events"
@@ -20,6 +21,16 @@ import (
     "errors"
 )
  
+// The deployer sets the secret from the executionRole of function.json. The prefix is
+// only set when function.json's environment opts in to a parameter hierarchy.
+const (
+    secretIDVariable        = "MONGO_SECRET_ID"
+    parameterPrefixVariable = "PARAMETER_PREFIX"
+)
+ 
+// defaultSecretID is the MongoDB secret read when none is configured.
+const defaultSecretID = "myApp/mongo-db-credentials"
+ 
 // LambdaHandler defines the interface for the Lambda function handler.
 type LambdaHandler interface {
     HandleRequest(ctx context.Context, event events.CloudWatchEvent) error
@@ -45,6 +56,11 @@ type LambdaFunction struct {
     SSMClient            SSMClient
     SecretsManagerClient SecretsManagerClient
     MongoCollection      MongoCollection
+    // SecretID is the secret holding the MongoDB credentials, defaultSecretID when empty.
+    SecretID string
+    // ParameterPrefix is put before the repository name to name the parameter written;
+    // empty names it after the repository alone.
+    ParameterPrefix string
 }
  
 // ParameterStoreData defines the structure for the data stored in Parameter Store.
@@ -60,6 +76,8 @@ func NewLambdaFunction() *LambdaFunction {
     return &LambdaFunction{
         SSMClient:            ssm.NewFromConfig(cfg),
         SecretsManagerClient: secretsmanager.NewFromConfig(cfg),
+        SecretID:             os.Getenv(secretIDVariable),
+        ParameterPrefix:      os.Getenv(parameterPrefixVariable),
     }
 }
  
@@ -102,7 +120,7 @@ func (lf *LambdaFunction) HandleRequest(ctx context.Context, event events.CloudW
     }
  
     // Store data in Parameter Store.
-    err = lf.storeInParameterStore(ctx, repositoryName, string(psDataJSON))
+    err = lf.storeInParameterStore(ctx, lf.ParameterPrefix+repositoryName, string(psDataJSON))
     if err != nil {
         return err
     }
@@ -110,8 +128,12 @@ func (lf *LambdaFunction) HandleRequest(ctx context.Context, event events.CloudW
     log.Println("Successfully updated the parameter store.")
  
     // Retrieve MongoDB connection string from Secrets Manager.
+    secretID := lf.SecretID
+    if secretID == "" {
+        secretID = defaultSecretID
+    }
     secretValue, err := lf.SecretsManagerClient.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
-        SecretId: aws.String("myApp/mongo-db-credentials"),
+        SecretId: aws.String(secretID),
     })
     if err != nil {
         log.Printf("Error retrieving secret: %v", err)
@@ -185,4 +207,4 @@ func main() {
     // Start the Lambda function.
     lambdaFunction := NewLambdaFunction()
     lambda.Start(lambdaFunction.HandleRequest)
-}
\ No newline at end of file
+}
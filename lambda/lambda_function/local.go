@@ -0,0 +1,286 @@
+//go:build local
+
+// The local invoke is only built with -tags local, so the deployed bootstrap, built
+// without it, carries none of it.
+package main
+ 
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "sync"
+    "time"
+ 
+    "github.com/aws/aws-lambda-go/events"
+    "github.com/aws/aws-sdk-go-v2/aws"
+    "github.com/aws/aws-sdk-go-v2/config"
+    "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+    "github.com/aws/aws-sdk-go-v2/service/ssm"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+ 
+// defaultLocalSecret is what the local Secrets Manager returns for every secret.
+const defaultLocalSecret = `{"connectionString": "mongodb://localhost:27017"}`
+ 
+// LocalOptions select the stand-ins of a local invoke. Each dependency is either a
+// local stand-in that only records what the handler did, or the real service.
+type LocalOptions struct {
+    // SSM is "local" or "aws".
+    SSM string
+    // SecretsManager is "local" or "aws"; LocalSecret is the local secret's value.
+    SecretsManager string
+    LocalSecret    string
+    // Mongo is "local", or a connection string of a real MongoDB; MongoDatabase and
+    // MongoCollection name the collection written to.
+    Mongo           string
+    MongoDatabase   string
+    MongoCollection string
+}
+ 
+// SideEffect is a call the handler made to one of its dependencies.
+type SideEffect struct {
+    Service string
+    Action  string
+    Detail  string
+}
+ 
+// sideEffects records the calls of a local invoke and prints each as it happens.
+type sideEffects struct {
+    mu      sync.Mutex
+    out     io.Writer
+    effects []SideEffect
+}
+ 
+func (s *sideEffects) record(service, action, detail string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.effects = append(s.effects, SideEffect{Service: service, Action: action, Detail: detail})
+    fmt.Fprintf(s.out, "[%s] %s %s\n", service, action, detail)
+}
+ 
+// localSSM stores parameters in memory.
+type localSSM struct {
+    effects    *sideEffects
+    parameters map[string]string
+}
+ 
+func (l *localSSM) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+    name, value := aws.ToString(params.Name), aws.ToString(params.Value)
+    _, exists := l.parameters[name]
+    if exists && !aws.ToBool(params.Overwrite) {
+        return nil, fmt.Errorf("ParameterAlreadyExists: parameter %s already exists", name)
+    }
+    l.parameters[name] = value
+    l.effects.record("ssm", "PutParameter", fmt.Sprintf("%s (%s, overwrite=%t) = %s", name, params.Type, aws.ToBool(params.Overwrite), value))
+    return &ssm.PutParameterOutput{Version: 1}, nil
+}
+ 
+// localSecretsManager returns the same secret for every secret ID.
+type localSecretsManager struct {
+    effects *sideEffects
+    secret  string
+}
+ 
+func (l *localSecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+    l.effects.record("secretsmanager", "GetSecretValue", aws.ToString(params.SecretId))
+    return &secretsmanager.GetSecretValueOutput{
+        Name:         params.SecretId,
+        SecretString: aws.String(l.secret),
+    }, nil
+}
+ 
+// localCollection keeps inserted documents in memory.
+type localCollection struct {
+    effects   *sideEffects
+    documents []interface{}
+}
+ 
+func (l *localCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+    l.documents = append(l.documents, document)
+    data, err := json.Marshal(document)
+    if err != nil {
+        return nil, err
+    }
+    l.effects.record("mongo", "InsertOne", string(data))
+    return &mongo.InsertOneResult{InsertedID: len(l.documents)}, nil
+}
+ 
+// recordingSSM, recordingSecretsManager and recordingCollection pass calls to the real
+// services and record them.
+type recordingSSM struct {
+    effects *sideEffects
+    client  SSMClient
+}
+ 
+func (r *recordingSSM) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+    output, err := r.client.PutParameter(ctx, params, optFns...)
+    r.effects.record("ssm", "PutParameter", fmt.Sprintf("%s = %s (AWS, err=%v)", aws.ToString(params.Name), aws.ToString(params.Value), err))
+    return output, err
+}
+ 
+type recordingSecretsManager struct {
+    effects *sideEffects
+    client  SecretsManagerClient
+}
+ 
+func (r *recordingSecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+    output, err := r.client.GetSecretValue(ctx, params, optFns...)
+    r.effects.record("secretsmanager", "GetSecretValue", fmt.Sprintf("%s (AWS, err=%v)", aws.ToString(params.SecretId), err))
+    return output, err
+}
+ 
+type recordingCollection struct {
+    effects    *sideEffects
+    collection MongoCollection
+}
+ 
+func (r *recordingCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+    result, err := r.collection.InsertOne(ctx, document, opts...)
+    data, _ := json.Marshal(document)
+    r.effects.record("mongo", "InsertOne", fmt.Sprintf("%s (MongoDB, err=%v)", data, err))
+    return result, err
+}
+ 
+// newLocalFunction wires the handler to the dependencies opts selects.
+func newLocalFunction(ctx context.Context, opts LocalOptions, effects *sideEffects) (*LambdaFunction, func(), error) {
+    lf := &LambdaFunction{SecretID: os.Getenv(secretIDVariable), ParameterPrefix: os.Getenv(parameterPrefixVariable)}
+    cleanup := func() {}
+ 
+    var awsConfig *aws.Config
+    loadAWSConfig := func() (aws.Config, error) {
+        if awsConfig == nil {
+            cfg, err := config.LoadDefaultConfig(ctx)
+            if err != nil {
+                return aws.Config{}, fmt.Errorf("unable to load SDK config: %v", err)
+            }
+            awsConfig = &cfg
+        }
+        return *awsConfig, nil
+    }
+ 
+    switch opts.SSM {
+    case "", "local":
+        lf.SSMClient = &localSSM{effects: effects, parameters: map[string]string{}}
+    case "aws":
+        cfg, err := loadAWSConfig()
+        if err != nil {
+            return nil, cleanup, err
+        }
+        lf.SSMClient = &recordingSSM{effects: effects, client: ssm.NewFromConfig(cfg)}
+    default:
+        return nil, cleanup, fmt.Errorf("ssm stand-in %q must be local or aws", opts.SSM)
+    }
+ 
+    switch opts.SecretsManager {
+    case "", "local":
+        secret := opts.LocalSecret
+        if secret == "" {
+            secret = defaultLocalSecret
+        }
+        lf.SecretsManagerClient = &localSecretsManager{effects: effects, secret: secret}
+    case "aws":
+        cfg, err := loadAWSConfig()
+        if err != nil {
+            return nil, cleanup, err
+        }
+        lf.SecretsManagerClient = &recordingSecretsManager{effects: effects, client: secretsmanager.NewFromConfig(cfg)}
+    default:
+        return nil, cleanup, fmt.Errorf("secrets manager stand-in %q must be local or aws", opts.SecretsManager)
+    }
+ 
+    switch {
+    case opts.Mongo == "" || opts.Mongo == "local":
+        lf.MongoCollection = &localCollection{effects: effects}
+    case strings.HasPrefix(opts.Mongo, "mongodb://") || strings.HasPrefix(opts.Mongo, "mongodb+srv://"):
+        client, err := mongo.Connect(ctx, options.Client().ApplyURI(opts.Mongo))
+        if err != nil {
+            return nil, cleanup, fmt.Errorf("failed to connect to MongoDB: %v", err)
+        }
+        cleanup = func() { client.Disconnect(context.Background()) }
+        collection := client.Database(opts.MongoDatabase).Collection(opts.MongoCollection)
+        lf.MongoCollection = &recordingCollection{effects: effects, collection: collection}
+    default:
+        return nil, cleanup, fmt.Errorf("mongo stand-in %q must be local or a mongodb:// connection string", opts.Mongo)
+    }
+    return lf, cleanup, nil
+}
+ 
+// RunLocal feeds the event to HandleRequest in this process, with the dependencies opts
+// selects, and prints every side effect to out. It returns the handler's error.
+func RunLocal(ctx context.Context, payload []byte, opts LocalOptions, out io.Writer) ([]SideEffect, error) {
+    var event events.CloudWatchEvent
+    if err := json.Unmarshal(payload, &event); err != nil {
+        return nil, fmt.Errorf("event is not a CloudWatch event: %v", err)
+    }
+ 
+    effects := &sideEffects{out: out}
+    lf, cleanup, err := newLocalFunction(ctx, opts, effects)
+    defer cleanup()
+    if err != nil {
+        return nil, err
+    }
+ 
+    start := time.Now()
+    handlerErr := lf.HandleRequest(ctx, event)
+    duration := time.Since(start)
+ 
+    fmt.Fprintf(out, "--- %d side effects in %s ---\n", len(effects.effects), duration.Round(time.Millisecond))
+    for i, effect := range effects.effects {
+        fmt.Fprintf(out, "%d. %s %s: %s\n", i+1, effect.Service, effect.Action, effect.Detail)
+    }
+    if handlerErr != nil {
+        fmt.Fprintf(out, "Handler returned error: %v\n", handlerErr)
+    } else {
+        fmt.Fprintln(out, "Handler succeeded")
+    }
+    return effects.effects, handlerErr
+}
+ 
+// init runs a local invoke instead of the Lambda runtime when the bootstrap is started
+// with -local first; anything else, a test binary included, goes on to main.
+func init() {
+    if len(os.Args) < 2 || !strings.HasPrefix(os.Args[1], "-local") {
+        return
+    }
+    os.Exit(runLocalMain(os.Args[1:]))
+}
+ 
+// runLocalMain is main for a local invoke: it reads the event from the -local file, "-"
+// for stdin, and returns the exit code, non-zero when the handler fails. The handler's
+// error is then the last line of the output, as {"errorMessage": ...} like Lambda reports it.
+func runLocalMain(args []string) int {
+    flags := flag.NewFlagSet("local", flag.ExitOnError)
+    eventFile := flags.String("local", "", "invoke the handler locally with this event file (- for stdin)")
+    var opts LocalOptions
+    flags.StringVar(&opts.SSM, "ssm", "local", "Parameter Store, local or aws")
+    flags.StringVar(&opts.SecretsManager, "secretsmanager", "local", "Secrets Manager, local or aws")
+    flags.StringVar(&opts.LocalSecret, "local-secret", defaultLocalSecret, "value the local Secrets Manager returns")
+    flags.StringVar(&opts.Mongo, "mongo", "local", "MongoDB, local or a mongodb:// connection string")
+    flags.StringVar(&opts.MongoDatabase, "mongo-database", "myApp", "database written to with -mongo")
+    flags.StringVar(&opts.MongoCollection, "mongo-collection", "imageTags", "collection written to with -mongo")
+    flags.Parse(args)
+ 
+    var payload []byte
+    var err error
+    if *eventFile == "-" {
+        payload, err = io.ReadAll(os.Stdin)
+    } else {
+        payload, err = os.ReadFile(*eventFile)
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "failed to read event %s: %v\n", *eventFile, err)
+        return 2
+    }
+ 
+    if _, err := RunLocal(context.Background(), payload, opts, os.Stdout); err != nil {
+        data, _ := json.Marshal(map[string]string{"errorMessage": err.Error()})
+        fmt.Println(string(data))
+        return 1
+    }
+    return 0
+}
@@ -0,0 +1,70 @@
+//go:build local
+
+package main
+ 
+import (
+    "bytes"
+    "context"
+    "testing"
+ 
+    "github.com/stretchr/testify/assert"
+)
+ 
+const localEvent = `{
+    "version": "0",
+    "detail-type": "ECR Image Scan",
+    "source": "aws.ecr",
+    "detail": {"scan-status": "COMPLETE", "repository-name": "my-app-repo", "image-tags": ["latest"]}
+}`
+ 
+func TestRunLocal(t *testing.T) {
+    var out bytes.Buffer
+    effects, err := RunLocal(context.Background(), []byte(localEvent), LocalOptions{}, &out)
+    assert.NoError(t, err)
+ 
+    // Parameter Store, then the secret, then MongoDB
+    assert.Len(t, effects, 3)
+    assert.Equal(t, "ssm", effects[0].Service)
+    assert.Contains(t, effects[0].Detail, "my-app-repo (String, overwrite=true)")
+    assert.Equal(t, SideEffect{Service: "secretsmanager", Action: "GetSecretValue", Detail: "myApp/mongo-db-credentials"}, effects[1])
+    assert.Equal(t, "mongo", effects[2].Service)
+    assert.Contains(t, effects[2].Detail, `"repositoryName":"my-app-repo"`)
+ 
+    assert.Contains(t, out.String(), "[ssm] PutParameter my-app-repo")
+    assert.Contains(t, out.String(), "--- 3 side effects")
+    assert.Contains(t, out.String(), "Handler succeeded")
+}
+ 
+func TestRunLocalConfiguredResources(t *testing.T) {
+    // The deployer passes the execution role's secret and parameter path
+    t.Setenv(secretIDVariable, "team/mongo")
+    t.Setenv(parameterPrefixVariable, "/myApp/image-tags/")
+ 
+    var out bytes.Buffer
+    effects, err := RunLocal(context.Background(), []byte(localEvent), LocalOptions{}, &out)
+    assert.NoError(t, err)
+    assert.Contains(t, effects[0].Detail, "/myApp/image-tags/my-app-repo (String, overwrite=true)")
+    assert.Equal(t, "team/mongo", effects[1].Detail)
+}
+ 
+func TestRunLocalHandlerError(t *testing.T) {
+    var out bytes.Buffer
+    event := `{"detail": {"repository-name": "my-app-repo", "image-tags": []}}`
+    effects, err := RunLocal(context.Background(), []byte(event), LocalOptions{}, &out)
+    assert.EqualError(t, err, "no image tags found in event detail")
+    assert.Empty(t, effects)
+    assert.Contains(t, out.String(), "Handler returned error: no image tags found")
+}
+ 
+func TestRunLocalBadSecret(t *testing.T) {
+    var out bytes.Buffer
+    effects, err := RunLocal(context.Background(), []byte(localEvent), LocalOptions{LocalSecret: "not json"}, &out)
+    assert.Error(t, err)
+    // The parameter was already written when the secret failed to parse
+    assert.Len(t, effects, 2)
+}
+ 
+func TestRunLocalUnknownStandIn(t *testing.T) {
+    _, err := RunLocal(context.Background(), []byte(localEvent), LocalOptions{Mongo: "postgres://localhost"}, &bytes.Buffer{})
+    assert.ErrorContains(t, err, "must be local or a mongodb:// connection string")
+}
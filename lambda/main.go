@@ -1,73 +1,1229 @@
 package main
  
 import (
+    "bufio"
+    "bytes"
     "context"
     "encoding/json"
+    "errors"
+    "flag"
     "fmt"
+    "io"
     "log"
     "os"
     "os/exec"
-    "runtime"
+    "os/signal"
+    "path/filepath"
+    goruntime "runtime"
+    "strings"
+    "sync"
     "time"
  
     "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/config"
+    "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+    "github.com/aws/aws-sdk-go-v2/service/ecr"
+    "github.com/aws/aws-sdk-go-v2/service/eventbridge"
+    "github.com/aws/aws-sdk-go-v2/service/iam"
     "github.com/aws/aws-sdk-go-v2/service/lambda"
-    "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+    "github.com/aws/aws-sdk-go-v2/service/s3"
+    "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+    "github.com/aws/aws-sdk-go-v2/service/ssm"
+    "github.com/aws/aws-sdk-go-v2/service/sts"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+ 
+    "lambdax/helpers/deploy"
+    "lambdax/helpers/fixtures"
+    "lambdax/helpers/history"
+    "lambdax/helpers/identity"
+    "lambdax/helpers/image"
+    "lambdax/helpers/logs"
+    "lambdax/helpers/manifest"
+    "lambdax/helpers/packaging"
+    "lambdax/helpers/role"
+    "lambdax/helpers/runtimeapi"
+    helpers "setup/helpers/eventbridge"
+    "setup/helpers/lock"
+    "setup/helpers/progress"
+    "setup/helpers/provision"
+    "setup/helpers/state"
 )
  
 func main() {
-    // Run the build script to prepare the deployment package
-    if err := runBuildScript(); err != nil {
-        log.Fatalf("failed to execute build script: %v", err)
+    profile := flag.String("profile", "", "shared config profile for every AWS call; empty uses the default credential chain")
+    region := flag.String("region", "", "AWS region for every AWS call; empty uses the profile's or AWS_REGION")
+    output := flag.String("output", "text", "text, or json to print each command's result as JSON on stdout, with progress on stderr")
+    statePath := flag.String("state", state.DefaultPath, "state file shared with setup")
+    manifestPath := flag.String("manifest", "", "build, deploy or destroy every function listed in this manifest instead of -config")
+    workers := flag.Int("workers", manifest.DefaultWorkers, "manifest: number of functions built and deployed at once")
+    configPath := flag.String("config", "function.json", "function configuration: memory, timeout, environment, VPC, logging and more")
+    arch := flag.String("arch", "", "overrides the configured architecture: amd64 or arm64 (Graviton)")
+    runtime := flag.String("runtime", "", "overrides the configured OS-only runtime: provided.al2 or provided.al2023")
+    switchArch := flag.Bool("switch-arch", false, "deploy: allow moving an existing function to the configured architecture; without it a mismatch is refused")
+    alias := flag.String("alias", deploy.DefaultAlias, "alias that receives traffic; each deploy publishes a version and moves the alias to it")
+    canary := flag.String("canary", "", "traffic shifting schedule in percent, e.g. \"10,100\"; empty shifts all traffic at once")
+    canaryInterval := flag.Duration("canary-interval", 5*time.Minute, "how long each canary step holds before the next")
+    s3Bucket := flag.String("s3-bucket", "", "stage the package in this bucket and deploy from S3, for packages over the direct upload limit")
+    s3Prefix := flag.String("s3-prefix", "lambda-packages", "key prefix for staged packages")
+    s3Endpoint := flag.String("s3-endpoint", "", "S3-compatible endpoint for staging, e.g. a local MinIO; uses path-style addressing")
+    registry := flag.String("registry", "", "image packages: push to this registry instead of the account's ECR registry, e.g. http://localhost:5000")
+    imageLayout := flag.String("image-layout", "", "image packages: also write the image as an OCI layout to this directory")
+    caBundle := flag.String("ca-bundle", image.CABundlePath, "image packages: CA bundle copied into the image, which has no base to bring one")
+    layerKeep := flag.Int("layer-keep", 3, "prune-layers: number of newest versions of each published layer to keep")
+    invocationType := flag.String("invocation-type", "RequestResponse", "invoke: RequestResponse, Event (async) or DryRun")
+    qualifier := flag.String("qualifier", "", "invoke: version or alias to invoke; defaults to -alias")
+    logTail := flag.Bool("log-tail", false, "invoke: print the last 4 KB of the function's log (RequestResponse only)")
+    since := flag.String("since", "10m", "logs: start time, a duration before now such as 1h or an RFC 3339 time")
+    filterPattern := flag.String("filter", "", "logs: CloudWatch Logs filter pattern, e.g. \"image tag\" or { $.level = \"ERROR\" }")
+    requestID := flag.String("request-id", "", "logs: only print the lines of this invocation")
+    follow := flag.Bool("follow", true, "logs: keep polling for new events until interrupted")
+    localSSM := flag.String("local-ssm", "local", "local-invoke: Parameter Store stand-in, local or aws")
+    localSecrets := flag.String("local-secretsmanager", "local", "local-invoke: Secrets Manager stand-in, local or aws")
+    localMongo := flag.String("local-mongo", "local", "local-invoke: MongoDB stand-in, local or a mongodb:// connection string")
+    historyPath := flag.String("history", history.DefaultPath, "deploy: append a record of each deploy to this JSONL file, read by the history command; empty disables it")
+    historyMongo := flag.String("history-mongo", "", "deploy: also insert each record into MongoDB: a mongodb:// connection string, or \"secret\" for the execution role's Secrets Manager secret")
+    historyDatabase := flag.String("history-mongo-database", "myApp", "deploy: database of the deployments collection written with -history-mongo")
+    useLock := flag.Bool("lock", true, "deploy and setup: hold a lease on the function in Parameter Store while running, so concurrent runs cannot interleave")
+    lockTTL := flag.Duration("lock-ttl", lock.DefaultTTL, "lifetime of the lock lease without a heartbeat; a crashed run's lease can be taken over after it")
+    lockWait := flag.Duration("lock-wait", 0, "how long to wait for a deploy or setup holding the lock; 0 fails at once")
+    yes := flag.Bool("yes", false, "destroy and break-lock: do not ask for confirmation, for CI")
+    webhookURL := flag.String("webhook-url", "", "setup: deploy webhook that ECR push events are posted to; empty skips the API destination")
+    webhookAuth := flag.String("webhook-auth", "api-key", "setup: webhook auth type: basic, api-key or oauth (credentials are read from WEBHOOK_* environment variables)")
+    webhookRoleArn := flag.String("webhook-role-arn", "", "setup: role EventBridge assumes to invoke the webhook")
+    webhookRateLimit := flag.Int("webhook-rate-limit", 10, "setup: maximum webhook invocations per second")
+    debugRule := flag.Bool("debug-rule", false, "setup: create a catch-all rule that logs every event on -debug-bus to CloudWatch Logs")
+    debugBus := flag.String("debug-bus", "eventbus", "setup: bus the catch-all debug rule listens on (\"default\" for the default bus)")
+    debugRetentionDays := flag.Int("debug-retention-days", 7, "setup: retention of the debug log group in days")
+    lint := flag.Bool("lint", false, "setup: only validate the rule and target configuration, without calling AWS; exits non-zero on errors")
+    smoke := flag.String("smoke", "", "comma-separated fixture names or .json event files invoked against the new version before the alias moves; the handler runs for real, so name events that are safe in the target account. Empty skips the smoke test")
+    fixturesDir := flag.String("fixtures", fixtures.DefaultDir, "directory of event fixture templates")
+    eventAccount := flag.String("event-account", "", "account filled into event fixtures; empty is the caller's account from STS")
+    eventRepository := flag.String("event-repository", fixtures.DefaultRepository, "repository filled into event fixtures")
+    eventTags := flag.String("event-tags", fixtures.DefaultTags, "comma-separated image tags filled into event fixtures; multi-tag adds latest or v1.2.0 when given only one")
+    flag.Usage = func() {
+        fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] command [flags] [args]\n\nflags go before the command's arguments.\n\ncommands:\n%s\nflags:\n", os.Args[0], commandUsage)
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+ 
+    // Flags may also follow the command, as in "invoke -log-tail missing-tags", but not
+    // its arguments, where the flag package stops parsing
+    command := flag.Arg(0)
+    if flag.NArg() > 0 {
+        flag.CommandLine.Parse(flag.Args()[1:])
+    }
+    for _, arg := range flag.Args() {
+        if strings.HasPrefix(arg, "-") && arg != "-" {
+            log.Fatalf("flag %s follows the arguments of %s and would be ignored; put flags before the arguments, e.g. %s invoke -log-tail missing-tags", arg, command, os.Args[0])
+        }
+    }
+ 
+    awsProfile, awsRegion = *profile, *region
+    switch *output {
+    case "text":
+    case "json":
+        // Results go to stdout and progress to stderr, so stdout parses as JSON
+        jsonOut = os.Stdout
+        progress.Out = os.Stderr
+    default:
+        log.Fatalf("invalid -output %q: must be text or json", *output)
+    }
+ 
+    // setup, fixtures and history do not touch the function
+    switch command {
+    case "setup":
+        runSetup(provision.Options{
+            StatePath:          *statePath,
+            WebhookURL:         *webhookURL,
+            WebhookAuth:        *webhookAuth,
+            WebhookRoleArn:     *webhookRoleArn,
+            WebhookRateLimit:   int32(*webhookRateLimit),
+            DebugRule:          *debugRule,
+            DebugBus:           *debugBus,
+            DebugRetentionDays: int32(*debugRetentionDays),
+            Lock:               lock.Options{TTL: *lockTTL, Wait: *lockWait},
+            SkipLock:           !*useLock,
+        }, *lint)
+        return
+    case "fixtures":
+        names, err := fixtures.Names(*fixturesDir)
+        if err != nil {
+            log.Fatalf("failed to list fixtures: %v", err)
+        }
+        if !printResult(names) {
+            progress.Println(strings.Join(names, "\n"))
+        }
+        return
+    case "history":
+        runHistory(*historyPath, flag.Args())
+        return
+    }
+ 
+    // Load the function configuration, or the functions of the manifest
+    var functionConfig *deploy.FunctionConfig
+    var m *manifest.Manifest
+    if *manifestPath != "" {
+        var err error
+        if m, err = manifest.Load(*manifestPath); err != nil {
+            log.Fatalf("%v", err)
+        }
+        for _, f := range m.Functions {
+            if err := overrideConfig(f.FunctionConfig, *arch, *runtime, *switchArch); err != nil {
+                log.Fatalf("invalid function configuration %s: %v", f.Config, err)
+            }
+        }
+        switch command {
+        case "", "build", "deploy", "destroy":
+        default:
+            log.Fatalf("-manifest applies to build, deploy and destroy, not %s", command)
+        }
+    } else {
+        var err error
+        if functionConfig, err = deploy.LoadConfig(*configPath); err != nil {
+            log.Fatalf("failed to load function configuration: %v", err)
+        }
+        if err := overrideConfig(functionConfig, *arch, *runtime, *switchArch); err != nil {
+            log.Fatalf("invalid function configuration: %v", err)
+        }
+    }
+ 
+    weights, err := deploy.ParseWeights(*canary)
+    if err != nil {
+        log.Fatalf("invalid -canary: %v", err)
+    }
+ 
+    events := &eventSource{
+        dir: *fixturesDir,
+        data: fixtures.NewData(*eventAccount, *eventRepository, *eventTags, time.Now()),
+    }
+ 
+    switch command {
+    case "build":
+        if m != nil {
+            printResult(runBuild(manifestTargets(m, nil)))
+            break
+        }
+        printResult(runBuild([]deployTarget{primaryTarget(functionConfig, nil)})[0])
+    case "", "deploy":
+        opts := deployOptions{
+            alias:          *alias,
+            weights:        weights,
+            canaryInterval: *canaryInterval,
+            s3Bucket:       *s3Bucket,
+            s3Prefix:       *s3Prefix,
+            s3Endpoint:     *s3Endpoint,
+            registry:       *registry,
+            imageLayout:    *imageLayout,
+            caBundle:       *caBundle,
+            historyPath:    *historyPath,
+            lock:           lock.Options{TTL: *lockTTL, Wait: *lockWait},
+            skipLock:       !*useLock,
+        }
+        if *historyMongo != "" {
+            secretID := "myApp/mongo-db-credentials"
+            if functionConfig != nil && functionConfig.ExecutionRole != nil {
+                secretID = functionConfig.ExecutionRole.SecretID
+            }
+            client, err := connectHistory(*historyMongo, secretID)
+            if err != nil {
+                log.Fatalf("-history-mongo: %v", err)
+            }
+            defer client.Disconnect(context.Background())
+            opts.historyCollection = client.Database(*historyDatabase).Collection(history.MongoCollection)
+        }
+        if m != nil {
+            runManifest(m, *workers, events, *statePath, opts)
+            break
+        }
+        smokeTests, err := events.smokeTests(*smoke)
+        if err != nil {
+            log.Fatalf("invalid -smoke: %v", err)
+        }
+        runDeploy(primaryTarget(functionConfig, smokeTests), *statePath, opts)
+    case "destroy":
+        names := []string{}
+        if m != nil {
+            for _, f := range m.Functions {
+                names = append(names, f.Name())
+            }
+        } else {
+            names = append(names, functionConfig.FunctionName)
+        }
+        if !*yes && !confirm(fmt.Sprintf("Delete %s with all versions and aliases? Type yes to confirm: ", strings.Join(names, ", "))) {
+            log.Fatalf("nothing was deleted")
+        }
+        runDestroy(names, *statePath)
+    case "rollback":
+        runRollback(functionConfig, *statePath, *alias, flag.Arg(0))
+    case "invoke":
+        parsedType, err := deploy.ParseInvocationType(*invocationType)
+        if err != nil {
+            log.Fatalf("invalid -invocation-type: %v", err)
+        }
+        if *qualifier == "" {
+            *qualifier = *alias
+        }
+        event := flag.Arg(0)
+        if event == "" {
+            event = "scan-complete"
+        }
+        runInvoke(functionConfig.FunctionName, events, event, deploy.InvokeOptions{
+            Qualifier:      *qualifier,
+            InvocationType: parsedType,
+            LogTail:        *logTail,
+        })
+    case "emulate":
+        names := strings.Join(flag.Args(), ",")
+        if names == "" {
+            names = *smoke
+        }
+        if names == "" {
+            log.Fatalf("emulate needs fixture names or event files, e.g. emulate scan-complete")
+        }
+        tests, err := events.smokeTests(names)
+        if err != nil {
+            log.Fatalf("%v", err)
+        }
+        runEmulate(functionConfig, events.data, tests)
+    case "local-invoke":
+        event := flag.Arg(0)
+        if event == "" {
+            event = "scan-complete"
+        }
+        runLocalInvoke(events, event, []string{"-ssm", *localSSM, "-secretsmanager", *localSecrets, "-mongo", *localMongo})
+    case "logs":
+        startTime, err := logs.ParseSince(*since, time.Now())
+        if err != nil {
+            log.Fatalf("invalid -since: %v", err)
+        }
+        runLogs(logs.Options{
+            LogGroup:      functionConfig.LogGroupName(),
+            StartTime:     startTime,
+            FilterPattern: *filterPattern,
+            RequestID:     *requestID,
+            Follow:        *follow,
+            JSON:          jsonOut != nil,
+        })
+    case "prune-layers":
+        runPruneLayers(functionConfig, *layerKeep)
+    case "break-lock":
+        name := flag.Arg(0)
+        if name == "" {
+            name = functionConfig.FunctionName
+        }
+        runBreakLock(name, *yes)
+    default:
+        flag.Usage()
+        os.Exit(2)
+    }
+}
+ 
+// commandUsage lists the commands for -help.
+const commandUsage = `  build                                    build the deployment package only
+  deploy                                   build, deploy, release and smoke test (the default)
+  destroy                                  delete the function and forget it in the state file
+  setup                                    create the event bus, rules and targets
+  invoke [fixture | event file]            invoke the deployed function
+  logs                                     print the function's log group
+  rollback [version]                       point the alias back at the previous version
+  emulate [fixtures | event files]         run the bootstrap against a local Runtime API
+  local-invoke [fixture | event file]      run the handler in-process against stand-ins
+  fixtures                                 list the event fixtures
+  prune-layers                             delete old versions of published layers
+  history [id [id]]                        list past deploys, show one, or diff two
+  break-lock [name]                        remove a stuck deploy lock (default: the function's)
+`
+ 
+// awsProfile and awsRegion are -profile and -region; empty leaves the choice to the SDK.
+var awsProfile, awsRegion string
+ 
+// jsonOut is where results are written with -output json, and nil otherwise.
+var jsonOut *os.File
+ 
+// printResult writes a command's result as JSON when -output json is set, and reports
+// whether it did.
+func printResult(result interface{}) bool {
+    if jsonOut == nil {
+        return false
+    }
+    encoder := json.NewEncoder(jsonOut)
+    encoder.SetIndent("", "  ")
+    if err := encoder.Encode(result); err != nil {
+        log.Fatalf("failed to write result: %v", err)
+    }
+    return true
+}
+ 
+// confirm asks a yes/no question on the terminal.
+func confirm(question string) bool {
+    fmt.Fprint(os.Stderr, question)
+    answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+    return strings.TrimSpace(answer) == "yes"
+}
+ 
+// overrideConfig applies -arch, -runtime and -switch-arch to a function configuration and
+// validates it.
+func overrideConfig(functionConfig *deploy.FunctionConfig, arch, runtime string, switchArch bool) error {
+    functionConfig.SwitchArchitecture = switchArch
+    if arch != "" {
+        functionConfig.Architecture = arch
     }
+    if runtime != "" {
+        functionConfig.Runtime = runtime
+    }
+    return functionConfig.Validate()
+}
  
-    // Load the AWS configuration
-    cfg, err := config.LoadDefaultConfig(context.Background())
+// loadAWSConfig loads the shared AWS configuration, with the -profile and -region given.
+func loadAWSConfig() aws.Config {
+    var options []func(*config.LoadOptions) error
+    if awsProfile != "" {
+        options = append(options, config.WithSharedConfigProfile(awsProfile))
+    }
+    if awsRegion != "" {
+        options = append(options, config.WithRegion(awsRegion))
+    }
+    cfg, err := config.LoadDefaultConfig(context.Background(), options...)
     if err != nil {
         log.Fatalf("unable to load SDK config: %v", err)
     }
+    return cfg
+}
+ 
+// identityMu guards caller, the identity resolved by the first callerIdentity.
+var (
+    identityMu sync.Mutex
+    caller     *identity.Identity
+)
+ 
+// callerIdentity resolves the account and partition of the credentials with STS, once.
+func callerIdentity() (*identity.Identity, error) {
+    identityMu.Lock()
+    defer identityMu.Unlock()
+    if caller == nil {
+        awsConfig := loadAWSConfig()
+        resolved, err := identity.Resolve(sts.NewFromConfig(awsConfig), awsConfig.Region)
+        if err != nil {
+            return nil, err
+        }
+        caller = resolved
+    }
+    return caller, nil
+}
+ 
+// newLambdaClient creates a Lambda client from the shared AWS configuration.
+func newLambdaClient() *lambda.Client {
+    return lambda.NewFromConfig(loadAWSConfig())
+}
+ 
+// deployOptions controls how a deploy releases the new version.
+type deployOptions struct {
+    alias          string
+    weights        []int
+    canaryInterval time.Duration
+    // s3Bucket, when set, stages the package in S3 instead of uploading it inline
+    s3Bucket   string
+    s3Prefix   string
+    s3Endpoint string
+    // registry overrides ECR as the destination of image packages
+    registry    string
+    imageLayout string
+    caBundle    string
+    // historyPath and historyCollection receive a record of each deploy; empty or nil
+    // skips them
+    historyPath       string
+    historyCollection *mongo.Collection
+    // lock is the lease taken on the function while it deploys, unless skipLock is set
+    lock     lock.Options
+    skipLock bool
+}
+ 
+// deployTarget is a function to build and deploy.
+type deployTarget struct {
+    config    *deploy.FunctionConfig
+    sourceDir string
+    outputZip string
+    // triggers names the rules allowed to invoke the function; empty means the rules
+    // setup pointed at the deployed function
+    triggers   []string
+    smokeTests []deploy.SmokeTest
+    // primary is recorded as the function setup targets
+    primary bool
+}
+ 
+// stateMu serializes state file updates, which read, modify and write the whole file,
+// between functions deployed concurrently from a manifest.
+var stateMu sync.Mutex
+ 
+func updateState(statePath string, fn func(s *state.State)) error {
+    stateMu.Lock()
+    defer stateMu.Unlock()
+    return state.Update(statePath, fn)
+}
+ 
+// primaryTarget is the function of -config, built from lambda_function.
+func primaryTarget(functionConfig *deploy.FunctionConfig, smokeTests []deploy.SmokeTest) deployTarget {
+    return deployTarget{
+        config:     functionConfig,
+        sourceDir:  "lambda_function",
+        outputZip:  "lambda_function/lambdaFunction.zip",
+        smokeTests: smokeTests,
+        primary:    true,
+    }
+}
+ 
+// manifestTargets are the functions of the manifest. With events, their smoke tests
+// are resolved too.
+func manifestTargets(m *manifest.Manifest, events *eventSource) []deployTarget {
+    var targets []deployTarget
+    for i, f := range m.Functions {
+        var smokeTests []deploy.SmokeTest
+        if events != nil {
+            var err error
+            if smokeTests, err = events.smokeTests(strings.Join(f.Smoke, ",")); err != nil {
+                log.Fatalf("%s: invalid smoke test: %v", f.Name(), err)
+            }
+        }
+        targets = append(targets, deployTarget{
+            config:     f.FunctionConfig,
+            sourceDir:  f.Package,
+            outputZip:  f.Output,
+            triggers:   f.Triggers,
+            smokeTests: smokeTests,
+            primary:    i == 0,
+        })
+    }
+    return targets
+}
+ 
+// buildResult is the result of build for -output json.
+type buildResult struct {
+    Function     string `json:"function"`
+    Zip          string `json:"zip"`
+    Size         int    `json:"size"`
+    SHA256       string `json:"sha256"`
+    Architecture string `json:"architecture"`
+}
+ 
+// buildPackage cross-compiles the target's handler and writes its deployment zip.
+func buildPackage(target deployTarget) (*packaging.Result, error) {
+    pkg, err := packaging.Package(context.Background(), packaging.Options{
+        SourceDir: target.sourceDir,
+        OutputZip: target.outputZip,
+        GOARCH:    target.config.Architecture,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to build deployment package: %v", err)
+    }
+    return pkg, nil
+}
+ 
+// runBuild builds the deployment packages without calling AWS.
+func runBuild(targets []deployTarget) []buildResult {
+    var results []buildResult
+    for _, target := range targets {
+        pkg, err := buildPackage(target)
+        if err != nil {
+            log.Fatalf("%s: %v", target.config.FunctionName, err)
+        }
+        progress.Printf("Deployment package %s (%d bytes) SHA-256: %s\n", pkg.ZipPath, pkg.Size, pkg.SHA256)
+        results = append(results, buildResult{
+            Function:     target.config.FunctionName,
+            Zip:          pkg.ZipPath,
+            Size:         pkg.Size,
+            SHA256:       pkg.SHA256,
+            Architecture: target.config.Architecture,
+        })
+    }
+    return results
+}
+ 
+// deployResult is the result of deploy for -output json.
+type deployResult struct {
+    Function string `json:"function"`
+    Alias    string `json:"alias"`
+    // Version is the released version, empty when nothing changed
+    Version   string `json:"version,omitempty"`
+    Unchanged bool   `json:"unchanged"`
+    Duration  string `json:"duration"`
+    Error     string `json:"error,omitempty"`
+}
+ 
+func newDeployResult(name, alias, version string, err error, duration time.Duration) deployResult {
+    result := deployResult{
+        Function:  name,
+        Alias:     alias,
+        Version:   version,
+        Unchanged: err == nil && version == "",
+        Duration:  duration.Round(time.Millisecond).String(),
+    }
+    if err != nil {
+        result.Error = err.Error()
+    }
+    return result
+}
+ 
+func runDeploy(target deployTarget, statePath string, opts deployOptions) {
+    start := time.Now()
+    version, err := deployAndRecord(target, statePath, opts)
+    printResult(newDeployResult(target.config.FunctionName, opts.alias, version, err, time.Since(start)))
+    if err != nil {
+        log.Fatalf("%v", err)
+    }
+}
+ 
+// runManifest deploys every function of the manifest, workers at a time, and reports
+// the outcome of each.
+func runManifest(m *manifest.Manifest, workers int, events *eventSource, statePath string, opts deployOptions) {
+    targets := map[string]deployTarget{}
+    for _, target := range manifestTargets(m, events) {
+        targets[target.config.FunctionName] = target
+    }
+ 
+    results := manifest.Run(m.Functions, workers, func(f manifest.Function) (string, error) {
+        return deployAndRecord(targets[f.Name()], statePath, opts)
+    })
+ 
+    var deployResults []deployResult
+    for _, result := range results {
+        deployResults = append(deployResults, newDeployResult(result.Name, opts.alias, result.Version, result.Err, result.Duration))
+    }
+    printResult(deployResults)
+ 
+    progress.Println("\nFunction results:")
+    for _, result := range results {
+        switch {
+        case result.Err != nil:
+            progress.Printf("  %-30s FAILED after %s: %v\n", result.Name, result.Duration.Round(time.Second), result.Err)
+        case result.Version == "":
+            progress.Printf("  %-30s unchanged\n", result.Name)
+        default:
+            progress.Printf("  %-30s version %s in %s\n", result.Name, result.Version, result.Duration.Round(time.Second))
+        }
+    }
+    if failed := manifest.Failed(results); failed > 0 {
+        log.Fatalf("%d of %d functions failed to deploy", failed, len(results))
+    }
+}
+ 
+// deployAndRecord deploys the target under its lock and records who deployed what, and
+// how it ended, in the deploy history.
+func deployAndRecord(target deployTarget, statePath string, opts deployOptions) (version string, err error) {
+    // Cancelled when the lease is lost, which stops the deploy before its next change
+    ctx := context.Background()
+    if !opts.skipLock {
+        held, err := acquireLock(target.config.FunctionName, "deploy", opts.lock)
+        if err != nil {
+            return "", err
+        }
+        ctx = held.Context()
+        defer func() {
+            lockErr := held.Release()
+            if lockErr == nil {
+                return
+            }
+            lockErr = fmt.Errorf("%v; another run may have changed %s meanwhile", lockErr, target.config.FunctionName)
+            switch {
+            case err != nil:
+                err = fmt.Errorf("%v\n%v", err, lockErr)
+            case version != "":
+                err = fmt.Errorf("deployed version %s, but %v", version, lockErr)
+            default:
+                err = lockErr
+            }
+        }()
+    }
+ 
+    start := time.Now()
+    record := history.New(target.config.FunctionName, opts.alias, start)
+    if caller, err := callerIdentity(); err == nil {
+        record.Caller, record.Account, record.Region = caller.CallerArn, caller.Account, caller.Region
+    }
+    record.GitCommit, record.GitDirty = history.Git(target.sourceDir)
+    record.SetConfig(target.config)
+ 
+    version, err = deployFunction(ctx, target, statePath, opts, record)
+    record.Finish(version, err, time.Since(start))
+ 
+    if recordErr := recordDeploy(record, opts); recordErr != nil {
+        if err != nil {
+            return "", fmt.Errorf("%v\n%v", err, recordErr)
+        }
+        return version, fmt.Errorf("deployed version %s, but %v", version, recordErr)
+    }
+    return version, err
+}
+ 
+// leaseHeld fails once the deploy lost its lock, e.g. to break-lock or a run that took
+// over after a missed heartbeat, so it does not change the function under that run.
+func leaseHeld(ctx context.Context) error {
+    if ctx.Err() != nil {
+        return fmt.Errorf("stopped the deploy: %v", context.Cause(ctx))
+    }
+    return nil
+}
+ 
+// acquireLock takes the lease on name for the operation, owned by the caller's ARN, or
+// the local user when STS is unavailable.
+func acquireLock(name, operation string, opts lock.Options) (*lock.Lock, error) {
+    opts.Owner, opts.Operation = lock.DefaultOwner(), operation
+    if caller, err := callerIdentity(); err == nil {
+        opts.Owner = caller.CallerArn
+    }
+    held, err := lock.Acquire(ssm.NewFromConfig(loadAWSConfig()), name, opts)
+    if err != nil {
+        return nil, fmt.Errorf("not deploying: %v", err)
+    }
+    return held, nil
+}
+ 
+// recordDeploy appends the record to the history file and inserts it into MongoDB.
+func recordDeploy(record *history.Record, opts deployOptions) error {
+    if opts.historyPath != "" {
+        if err := history.Append(opts.historyPath, record); err != nil {
+            return err
+        }
+    }
+    if opts.historyCollection != nil {
+        if err := history.Insert(opts.historyCollection, record); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+ 
+// connectHistory connects to the MongoDB deploy records are inserted into: target is a
+// connection string, or "secret" for the connectionString of the Secrets Manager secret.
+func connectHistory(target, secretID string) (*mongo.Client, error) {
+    uri := target
+    if target == "secret" {
+        secret, err := secretsmanager.NewFromConfig(loadAWSConfig()).GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
+            SecretId: aws.String(secretID),
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to read secret %s: %v", secretID, err)
+        }
+        var secretsMap map[string]string
+        if err := json.Unmarshal([]byte(aws.ToString(secret.SecretString)), &secretsMap); err != nil {
+            return nil, fmt.Errorf("failed to parse secret %s: %v", secretID, err)
+        }
+        uri = secretsMap["connectionString"]
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to MongoDB: %v", err)
+    }
+    if err := client.Ping(ctx, nil); err != nil {
+        client.Disconnect(context.Background())
+        return nil, fmt.Errorf("failed to reach MongoDB: %v", err)
+    }
+    return client, nil
+}
+ 
+// deployFunction builds, deploys and releases one function. It returns the released
+// version, or "" when nothing changed.
+func deployFunction(ctx context.Context, target deployTarget, statePath string, opts deployOptions, record *history.Record) (string, error) {
+    functionConfig := target.config
+    alias := opts.alias
+ 
+    // A canary without checks would only delay the release, never stop it
+    if len(opts.weights) > 1 && len(target.smokeTests) == 0 {
+        return "", fmt.Errorf("-canary needs smoke tests (-smoke, or \"smoke\" in the manifest) to check each step")
+    }
+ 
+    // Cross-compile the handler and build the deployment package
+    pkg, err := buildPackage(target)
+    if err != nil {
+        return "", err
+    }
  
     // Create a Lambda client
-    svc := lambda.NewFromConfig(cfg)
+    awsConfig := loadAWSConfig()
+    svc := lambda.NewFromConfig(awsConfig)
  
     // Define the Lambda function name
-    functionName := "MyGoLambdaFunction"
+    functionName := functionConfig.FunctionName
+ 
+    // Create or verify the execution role before the function refers to it
+    if err := ensureRole(iam.NewFromConfig(awsConfig), awsConfig.Region, functionConfig); err != nil {
+        return "", fmt.Errorf("execution role: %v", err)
+    }
+ 
+    // An existing function keeps its architecture unless -switch-arch moves it
+    existing, getErr := getFunction(svc, functionName)
+    goarch := functionConfig.Architecture
+    if getErr == nil {
+        if err := functionConfig.CheckArchitecture(existing.Configuration); err != nil {
+            return "", err
+        }
+        if goarch, err = packaging.GoArch(string(deploy.DeployedArchitecture(existing.Configuration))); err != nil {
+            return "", err
+        }
+        if functionConfig.SwitchArchitecture {
+            goarch = functionConfig.Architecture
+        }
+    }
+ 
+    // Read the deployment package, refusing a bootstrap the function cannot run
+    zipFile, err := readPackage(target.outputZip, goarch)
+    if err != nil {
+        return "", err
+    }
+ 
+    var code deploy.Code
+    if functionConfig.IsImage() {
+        // Build the image around the bootstrap binary and push it
+        code, err = pushImage(awsConfig, functionConfig, zipFile, opts)
+    } else {
+        code, err = zipCode(awsConfig, svc, functionConfig, zipFile, opts)
+    }
+    if err != nil {
+        return "", err
+    }
+    record.CodeSHA256 = code.Hash()
+ 
+    if err := leaseHeld(ctx); err != nil {
+        return "", err
+    }
  
     // Check if the Lambda function already exists
-    if _, err := getFunction(svc, functionName); err != nil {
+    var result *deploy.Result
+    if getErr != nil {
         // If the function does not exist, create it
-        fmt.Println("Creating new Lambda function")
-        if createErr := createFunction(svc, functionName); createErr != nil {
-            log.Fatalf("failed to create function: %v", createErr)
+        progress.Printf("Creating new Lambda function %s\n", functionName)
+        result, err = deploy.CreateFunction(svc, functionConfig, code)
+        if err != nil {
+            return "", fmt.Errorf("failed to create function: %v", err)
         }
     } else {
-        // If the function exists, update it
-        fmt.Println("Updating existing Lambda function")
-        if updateErr := updateFunction(svc, functionName); updateErr != nil {
-            log.Fatalf("failed to update function code: %v", updateErr)
+        // If the function exists, update its code and configuration
+        progress.Printf("Updating existing Lambda function %s\n", functionName)
+        result, err = deploy.UpdateFunction(svc, functionConfig, existing.Configuration, code)
+        if err != nil {
+            return "", fmt.Errorf("failed to update function: %v", err)
         }
     }
  
-    // Invoke the Lambda function
-    if err := invokeFunction(svc, functionName); err != nil {
-        log.Fatalf("failed to invoke function: %v", err)
+    record.Changes = result.Changes
+    record.SetConfig(functionConfig)
+ 
+    // Reserved concurrency belongs to the function, not a version
+    if err := deploy.ApplyReservedConcurrency(svc, functionConfig); err != nil {
+        return "", err
+    }
+ 
+    // Nothing to release when neither code nor configuration changed and the alias
+    // already serves them; $LATEST alone may be left over from a deploy that failed
+    if result.Unchanged() {
+        served, err := deploy.AliasServes(svc, functionConfig, alias, code.Hash())
+        if err != nil {
+            return "", err
+        }
+        if served {
+            if err := deploy.ApplyProvisionedConcurrency(svc, functionConfig, alias); err != nil {
+                return "", err
+            }
+            progress.Printf("No changes to %s: alias %s serves code with SHA-256 %s\n", functionName, alias, code.Hash())
+            return "", nil
+        }
+        progress.Printf("Alias %s does not serve this package yet, releasing it\n", alias)
+    }
+ 
+    if err := leaseHeld(ctx); err != nil {
+        return "", err
+    }
+ 
+    // Publish the new code as an immutable version
+    version, err := deploy.PublishVersion(svc, functionName, "Package SHA-256 "+code.Hash())
+    if err != nil {
+        return "", err
     }
+    record.Version = version
+ 
+    // Smoke test the version by qualifier before the alias sends it any traffic, and
+    // again after each canary step
+    var check func() error
+    if len(target.smokeTests) > 0 {
+        check = func() error {
+            if err := leaseHeld(ctx); err != nil {
+                return err
+            }
+            return deploy.Verify(svc, functionName, version, target.smokeTests)
+        }
+        if err := check(); err != nil {
+            // The failed code stays in $LATEST and the published version; say so, as the
+            // next deploy only replaces $LATEST
+            return "", fmt.Errorf("%v\nalias %s was not moved to version %s; $LATEST and version %s still hold the failed code until the next deploy, and the version can be deleted with aws lambda delete-function --function-name %s --qualifier %s", err, alias, version, version, functionName, version)
+        }
+    }
+ 
+    if err := leaseHeld(ctx); err != nil {
+        return "", fmt.Errorf("%v\nalias %s was not moved to version %s", err, alias, version)
+    }
+ 
+    // Move the alias to the new version, through the canary steps if any
+    release, err := deploy.ShiftTraffic(svc, functionName, alias, version, opts.weights, opts.canaryInterval, check)
+    if err != nil {
+        var canaryErr *deploy.CanaryError
+        if !errors.As(err, &canaryErr) {
+            return "", fmt.Errorf("failed to shift traffic: %v", err)
+        }
+        // ShiftTraffic put the alias back; the state file still records that version
+        record.PreviousVersion = canaryErr.PreviousVersion
+        if canaryErr.RollbackErr == nil {
+            record.Outcome = history.OutcomeRolledBack
+        }
+        return "", err
+    }
+    record.Version, record.PreviousVersion = release.Version, release.PreviousVersion
+ 
+    // Record the deployed function for setup, and read back the rules setup created
+    var current *state.State
+    err = updateState(statePath, func(s *state.State) {
+        s.SetFunction(&state.LambdaState{
+            FunctionName:    functionName,
+            FunctionArn:     result.FunctionArn,
+            Version:         release.Version,
+            Alias:           alias,
+            AliasArn:        release.AliasArn,
+            PreviousVersion: release.PreviousVersion,
+            Triggers:        target.triggers,
+        }, target.primary)
+        current = s
+    })
+    if err != nil {
+        return "", fmt.Errorf("failed to write state: %v", err)
+    }
+ 
+    // Let the function's triggers invoke it
+    if err := grantRulePermissions(svc, functionName, alias, targetID(functionName, target.primary), current.EventBridge, target.triggers); err != nil {
+        return "", fmt.Errorf("failed to grant EventBridge permission: %v", err)
+    }
+ 
+    // Warm the new version; a failure puts the alias back where it was
+    if err := deploy.ApplyProvisionedConcurrency(svc, functionConfig, alias); err != nil {
+        if release.PreviousVersion == "" {
+            return "", fmt.Errorf("%v\nno previous version to roll back to", err)
+        }
+        if _, rollbackErr := rollback(svc, functionName, statePath, alias, release.PreviousVersion); rollbackErr != nil {
+            return "", fmt.Errorf("%v\n%v", err, rollbackErr)
+        }
+        record.Outcome = history.OutcomeRolledBack
+        return "", fmt.Errorf("%v\nrolled back alias %s to version %s", err, alias, release.PreviousVersion)
+    }
+ 
+    progress.Printf("Deployment package %s (%d bytes) SHA-256: %s\n", pkg.ZipPath, pkg.Size, pkg.SHA256)
+    return release.Version, nil
 }
  
-func runBuildScript() error {
-    // Determine the appropriate command to run the build script based on the OS
-    var cmd *exec.Cmd
-    if runtime.GOOS == "windows" {
-        // Use Git Bash for running the build script on Windows
-        gitBashPath := `C:\Program Files\Git\bin\bash.exe`
-        cmd = exec.Command(gitBashPath, "-c", "bash build.sh")
+// zipCode publishes the function's layers and, when configured, stages the zip in S3.
+func zipCode(awsConfig aws.Config, svc *lambda.Client, functionConfig *deploy.FunctionConfig, zipFile []byte, opts deployOptions) (deploy.Code, error) {
+    // Publish changed layers and resolve layer names to version ARNs
+    if err := deploy.ResolveLayers(svc, functionConfig); err != nil {
+        return deploy.Code{}, fmt.Errorf("failed to resolve layers: %v", err)
+    }
+ 
+    // Stage the package in S3 when configured; Lambda rejects large packages sent inline
+    code := deploy.Code{ZipFile: zipFile}
+    if opts.s3Bucket != "" {
+        client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+            if opts.s3Endpoint != "" {
+                o.BaseEndpoint = aws.String(opts.s3Endpoint)
+                o.UsePathStyle = true
+            }
+        })
+        location, err := deploy.StagePackage(client, opts.s3Bucket, opts.s3Prefix, functionConfig.FunctionName, zipFile)
+        if err != nil {
+            return deploy.Code{}, err
+        }
+        code.S3 = location
+    } else if len(zipFile) > deploy.DirectUploadLimit {
+        return deploy.Code{}, fmt.Errorf("deployment package is %d bytes, over the %d byte direct upload limit; stage it with -s3-bucket", len(zipFile), deploy.DirectUploadLimit)
+    }
+    return code, nil
+}
+ 
+// pushImage builds a container image from the bootstrap binary in the zip and pushes it
+// to the account's ECR registry, or to opts.registry when set.
+func pushImage(awsConfig aws.Config, functionConfig *deploy.FunctionConfig, zipFile []byte, opts deployOptions) (deploy.Code, error) {
+    binary, err := packaging.Bootstrap(zipFile)
+    if err != nil {
+        return deploy.Code{}, err
+    }
+    // The image has no base, so bring the host's CA bundle for HTTPS calls to AWS;
+    // without one every call the handler makes would fail certificate verification
+    caBundle, err := os.ReadFile(opts.caBundle)
+    if err != nil {
+        return deploy.Code{}, fmt.Errorf("failed to read CA bundle: %v; point -ca-bundle at a PEM bundle of root certificates", err)
+    }
+    if len(caBundle) == 0 {
+        return deploy.Code{}, fmt.Errorf("CA bundle %s is empty; point -ca-bundle at a PEM bundle of root certificates", opts.caBundle)
+    }
+    img, err := image.Build(binary, functionConfig.Architecture, caBundle)
+    if err != nil {
+        return deploy.Code{}, fmt.Errorf("failed to build image: %v", err)
+    }
+    // Tag with the start of the digest so pushes are easy to find in the repository
+    tag := strings.TrimPrefix(img.Manifest.Digest, "sha256:")[:12]
+    if opts.imageLayout != "" {
+        if err := image.WriteLayout(opts.imageLayout, img, tag); err != nil {
+            return deploy.Code{}, err
+        }
+    }
+ 
+    repository := functionConfig.ImageRepository
+    registry := &image.Registry{Endpoint: opts.registry}
+    if opts.registry == "" {
+        client := ecr.NewFromConfig(awsConfig)
+        if err := image.EnsureRepository(client, repository); err != nil {
+            return deploy.Code{}, err
+        }
+        if registry, err = image.ECRRegistry(client); err != nil {
+            return deploy.Code{}, err
+        }
+    }
+    if err := registry.Push(repository, tag, img); err != nil {
+        return deploy.Code{}, err
+    }
+    return deploy.Code{ImageURI: registry.ImageURI(repository, img.Manifest.Digest), ImageDigest: img.Manifest.Digest}, nil
+}
+ 
+func runRollback(functionConfig *deploy.FunctionConfig, statePath, alias, toVersion string) {
+    svc := newLambdaClient()
+ 
+    // Prefer the version recorded by the last deploy over guessing from the version list
+    current, err := state.Load(statePath)
+    if err != nil {
+        log.Fatalf("failed to load state: %v", err)
+    }
+    recorded := current.Function(functionConfig.FunctionName)
+    if toVersion == "" && recorded != nil && recorded.Alias == alias {
+        toVersion = recorded.PreviousVersion
+    }
+ 
+    release, err := rollback(svc, functionConfig.FunctionName, statePath, alias, toVersion)
+    if err != nil {
+        log.Fatalf("%v", err)
+    }
+    printResult(struct {
+        Function        string `json:"function"`
+        Alias           string `json:"alias"`
+        Version         string `json:"version"`
+        PreviousVersion string `json:"previousVersion,omitempty"`
+    }{functionConfig.FunctionName, alias, release.Version, release.PreviousVersion})
+}
+ 
+// rollback points the alias at toVersion and records the release in the state file.
+func rollback(svc *lambda.Client, functionName, statePath, alias, toVersion string) (*deploy.Release, error) {
+    release, err := deploy.Rollback(svc, functionName, alias, toVersion)
+    if err != nil {
+        return nil, fmt.Errorf("failed to roll back: %v", err)
+    }
+ 
+    err = updateState(statePath, func(s *state.State) {
+        if recorded := s.Function(functionName); recorded != nil {
+            recorded.Version = release.Version
+            recorded.PreviousVersion = release.PreviousVersion
+        }
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to write state: %v", err)
+    }
+    return release, nil
+}
+ 
+// runDestroy deletes the functions and removes them from the state file. The rules
+// setup pointed at the primary function lose their Lambda target; the event bus, the
+// rules and the execution role are kept for the next deploy.
+func runDestroy(names []string, statePath string) {
+    awsConfig := loadAWSConfig()
+    svc := lambda.NewFromConfig(awsConfig)
+ 
+    type destroyResult struct {
+        Function string   `json:"function"`
+        Deleted  bool     `json:"deleted"`
+        Targets  []string `json:"removedTargets,omitempty"`
+    }
+    var results []destroyResult
+    for _, name := range names {
+        deleted, err := deploy.DeleteFunction(svc, name)
+        if err != nil {
+            log.Fatalf("%v", err)
+        }
+        if deleted {
+            progress.Printf("Deleted Lambda function %s\n", name)
+        } else {
+            progress.Printf("No Lambda function %s to delete\n", name)
+        }
+ 
+        var primary bool
+        var eventBridge *state.EventBridgeState
+        err = updateState(statePath, func(s *state.State) {
+            primary = s.RemoveFunction(name)
+            eventBridge = s.EventBridge
+        })
+        if err != nil {
+            log.Fatalf("failed to write state: %v", err)
+        }
+ 
+        result := destroyResult{Function: name, Deleted: deleted}
+        if eventBridge != nil {
+            if result.Targets, err = detachFunction(eventbridge.NewFromConfig(awsConfig), statePath, eventBridge, targetID(name, primary)); err != nil {
+                log.Fatalf("%v", err)
+            }
+        }
+        results = append(results, result)
+    }
+    if len(results) == 1 {
+        printResult(results[0])
     } else {
-        cmd = exec.Command("/bin/bash", "build.sh")
+        printResult(results)
     }
-    cmd.Stdout = os.Stdout
-    cmd.Stderr = os.Stderr
-    return cmd.Run()
+}
+ 
+// targetID is the ID setup gives the function's target on its rules: the primary
+// function's on the ECR push rule, or one per function on the rules its triggers name.
+func targetID(functionName string, primary bool) string {
+    if primary {
+        return helpers.LambdaTargetID
+    }
+    return helpers.FunctionTargetID(functionName)
+}
+ 
+// detachFunction removes the function's target from the rules recorded with it and
+// returns the rules it was removed from.
+func detachFunction(client *eventbridge.Client, statePath string, eventBridge *state.EventBridgeState, targetID string) ([]string, error) {
+    var detached []string
+    for _, rule := range eventBridge.Rules {
+        for _, id := range rule.TargetIDs {
+            if id != targetID {
+                continue
+            }
+            if err := helpers.RemoveTarget(client, rule.Name, rule.EventBusName, id); err != nil {
+                return detached, err
+            }
+            progress.Printf("Removed target %s from rule %s\n", id, rule.Name)
+            detached = append(detached, rule.Name)
+        }
+    }
+ 
+    err := updateState(statePath, func(s *state.State) {
+        for _, name := range detached {
+            rule := s.EventBridge.Rule(name)
+            if rule == nil {
+                continue
+            }
+            var ids []string
+            for _, id := range rule.TargetIDs {
+                if id != targetID {
+                    ids = append(ids, id)
+                }
+            }
+            rule.TargetIDs = ids
+        }
+    })
+    if err != nil {
+        return detached, fmt.Errorf("failed to write state: %v", err)
+    }
+    return detached, nil
+}
+ 
+// runSetup creates the event bus, rules and targets, as setup does, or with lint only
+// validates them.
+func runSetup(opts provision.Options, lint bool) {
+    if lint {
+        current, err := state.Load(opts.StatePath)
+        if err != nil {
+            log.Fatalf("failed to load state: %v", err)
+        }
+        if err := provision.Validate(current, opts); err != nil {
+            log.Fatalf("%v", err)
+        }
+        progress.Println("EventBridge configuration is valid.")
+        printResult(struct {
+            Valid bool `json:"valid"`
+        }{true})
+        return
+    }
+ 
+    if caller, err := callerIdentity(); err == nil {
+        opts.Lock.Owner = caller.CallerArn
+    }
+    recorded, err := provision.Run(loadAWSConfig(), opts)
+    if err != nil {
+        log.Fatalf("%v", err)
+    }
+    progress.Println("EventBridge setup completed successfully.")
+    printResult(recorded)
+}
+ 
+// runPruneLayers deletes old versions of the layers the deployer publishes, keeping the
+// newest ones and those the function uses.
+func runPruneLayers(functionConfig *deploy.FunctionConfig, keep int) {
+    svc := newLambdaClient()
+ 
+    var inUse []string
+    if existing, err := getFunction(svc, functionConfig.FunctionName); err == nil {
+        for _, layer := range existing.Configuration.Layers {
+            inUse = append(inUse, aws.ToString(layer.Arn))
+        }
+    }
+ 
+    type pruneResult struct {
+        Layer   string  `json:"layer"`
+        Deleted []int64 `json:"deletedVersions"`
+    }
+    results := []pruneResult{}
+    for _, layer := range functionConfig.Layers {
+        if layer.Dir == "" {
+            // Only layers published from this repository are ours to delete
+            continue
+        }
+        deleted, err := deploy.PruneLayerVersions(svc, layer.Name, keep, inUse)
+        if err != nil {
+            log.Fatalf("%v", err)
+        }
+        progress.Printf("Layer %s: deleted %d old versions\n", layer.Name, len(deleted))
+        results = append(results, pruneResult{Layer: layer.Name, Deleted: deleted})
+    }
+    printResult(results)
+}
+ 
+// ensureRole creates the configured execution role and its least-privilege policy, or
+// checks that the role given by ARN trusts Lambda.
+func ensureRole(client *iam.Client, region string, functionConfig *deploy.FunctionConfig) error {
+    executionRole := functionConfig.ExecutionRole
+    if executionRole == nil {
+        // A role given by name is in the caller's account and partition
+        if !strings.HasPrefix(functionConfig.Role, "arn:") {
+            caller, err := callerIdentity()
+            if err != nil {
+                return err
+            }
+            functionConfig.Role = caller.RoleArn(functionConfig.Role)
+        }
+        return role.Verify(client, functionConfig.Role)
+    }
+ 
+    logGroup := ""
+    if functionConfig.Logging != nil {
+        logGroup = functionConfig.Logging.LogGroup
+    }
+    roleArn, err := role.Ensure(client, executionRole.RoleName, role.Permissions{
+        Region:        region,
+        FunctionName:  functionConfig.FunctionName,
+        LogGroup:      logGroup,
+        ParameterPath: executionRole.ParameterPath,
+        SecretID:      executionRole.SecretID,
+    })
+    if err != nil {
+        return err
+    }
+    functionConfig.Role = roleArn
+    return nil
 }
  
 func getFunction(svc *lambda.Client, functionName string) (*lambda.GetFunctionOutput, error) {
@@ -77,86 +1233,456 @@ func getFunction(svc *lambda.Client, functionName string) (*lambda.GetFunctionOu
     })
 }
  
-func createFunction(svc *lambda.Client, functionName string) error {
-    // Read the function code from the zip file
-    zipFile, err := os.ReadFile("lambda_function/lambdaFunction.zip")
+// readPackage reads the deployment zip and refuses it when the bootstrap binary was
+// built for another architecture than goarch, the one the function runs on.
+func readPackage(path, goarch string) ([]byte, error) {
+    zipFile, err := os.ReadFile(path)
     if err != nil {
-        return fmt.Errorf("failed to read file lambda_function/lambdaFunction.zip: %v", err)
+        return nil, fmt.Errorf("failed to read file %s: %v", path, err)
+    }
+    if err := packaging.CheckArch(zipFile, goarch); err != nil {
+        return nil, fmt.Errorf("refusing to upload %s: %v", path, err)
     }
+    return zipFile, nil
+}
  
-    // Create a new Lambda function
-    input := &lambda.CreateFunctionInput{
-        Code: &types.FunctionCode{
-            ZipFile: zipFile,
-        },
-        FunctionName: aws.String(functionName),
-        Handler:      aws.String("bootstrap"), // Specifies the handler for the function
-        Role:         aws.String("arn:aws:iam::975050154225:role/service-role/pujitha-role-5crlj5xc"),
-        Runtime:      types.RuntimeProvidedal2,
+// grantRulePermissions lets the rules named in triggers invoke the alias, or, without
+// triggers, every rule setup pointed at the function under targetID. A trigger setup has
+// not recorded yet is granted by the ARN setup will create it with.
+func grantRulePermissions(svc *lambda.Client, functionName, alias, targetID string, eventBridge *state.EventBridgeState, triggers []string) error {
+    if eventBridge == nil && len(triggers) == 0 {
+        progress.Println("No EventBridge rules recorded yet; run setup to connect the function")
+        return nil
+    }
+ 
+    var rules []state.RuleState
+    if len(triggers) == 0 {
+        for _, rule := range eventBridge.Rules {
+            for _, id := range rule.TargetIDs {
+                if id == targetID {
+                    rules = append(rules, rule)
+                    break
+                }
+            }
+        }
+    }
+    for _, name := range triggers {
+        rule := eventBridge.Rule(name)
+        if rule == nil {
+            caller, err := callerIdentity()
+            if err != nil {
+                return err
+            }
+            eventBusName := helpers.EventBusName
+            if eventBridge != nil {
+                eventBusName = eventBridge.EventBusName
+            }
+            rule = &state.RuleState{Name: name, Arn: caller.RuleArn(eventBusName, name), EventBusName: eventBusName}
+            progress.Printf("Rule %s is not recorded yet; granting %s ahead of setup\n", name, rule.Arn)
+        }
+        rules = append(rules, *rule)
+    }
+ 
+    for _, rule := range rules {
+        // Allow the rule, and only that rule, to invoke the alias it targets
+        if err := deploy.GrantInvoke(svc, functionName, alias, "EventBridge-"+rule.Name, rule.Arn); err != nil {
+            return err
+        }
+        progress.Printf("Rule %s may invoke %s\n", rule.Name, functionName)
+    }
+    return nil
+}
+ 
+// eventSource resolves the events given on the command line: names of fixtures in dir,
+// or paths of .json event files.
+type eventSource struct {
+    dir  string
+    data fixtures.Data
+}
+ 
+// smokeTests resolves the comma-separated events of -smoke.
+func (e *eventSource) smokeTests(events string) ([]deploy.SmokeTest, error) {
+    var tests []deploy.SmokeTest
+    for _, event := range strings.Split(events, ",") {
+        event = strings.TrimSpace(event)
+        if event == "" {
+            continue
+        }
+        fixture, err := e.load(event)
+        if err != nil {
+            return nil, err
+        }
+        tests = append(tests, deploy.SmokeTest{Name: fixture.Name, Payload: fixture.Payload, WantError: fixture.ExpectError})
     }
+    return tests, nil
+}
  
-    _, err = svc.CreateFunction(context.Background(), input)
-    return err
+func (e *eventSource) load(event string) (*fixtures.Fixture, error) {
+    e.resolve()
+    if !strings.HasSuffix(event, ".json") {
+        return fixtures.Load(e.dir, event, e.data)
+    }
+    payload, err := readEvent(event, e.data)
+    if err != nil {
+        return nil, err
+    }
+    return &fixtures.Fixture{Name: event, Payload: payload}, nil
+}
+ 
+// placeholderAccount fills events when the caller's account cannot be resolved, e.g.
+// for a local invoke without credentials.
+const placeholderAccount = "123456789012"
+ 
+// resolve fills in the region, account and partition of the events from the credentials.
+func (e *eventSource) resolve() {
+    if e.data.Region == "" {
+        e.data.Region = loadAWSConfig().Region
+    }
+    if e.data.Account == "" {
+        caller, err := callerIdentity()
+        if err != nil {
+            progress.Printf("Events use account %s: %v\n", placeholderAccount, err)
+            e.data.Account = placeholderAccount
+        } else {
+            e.data.Account, e.data.Partition = caller.Account, caller.Partition
+        }
+    }
+    if e.data.Partition == "" {
+        e.data.Partition = identity.PartitionForRegion(e.data.Region)
+    }
 }
  
-func updateFunction(svc *lambda.Client, functionName string) error {
-    // Read the function code from the zip file
-    zipFile, err := os.ReadFile("lambda_function/lambdaFunction.zip")
+// readEvent reads an event file. The event's detail date is set to today, as the
+// function stores it with the image tag, and its account and region are those of data.
+func readEvent(file string, data fixtures.Data) ([]byte, error) {
+    eventFile, err := os.ReadFile(file)
     if err != nil {
-        return fmt.Errorf("failed to read file lambda_function/lambdaFunction.zip: %v", err)
+        return nil, fmt.Errorf("failed to read %s: %v", file, err)
     }
  
-    // Update the existing Lambda function code
-    input := &lambda.UpdateFunctionCodeInput{
-        FunctionName: aws.String(functionName),
-        ZipFile:      zipFile,
+    var event map[string]interface{}
+    if err := json.Unmarshal(eventFile, &event); err != nil {
+        return nil, fmt.Errorf("failed to unmarshal %s: %v", file, err)
+    }
+    detail, ok := event["detail"].(map[string]interface{})
+    if !ok {
+        return nil, fmt.Errorf("%s has no detail object", file)
     }
+    detail["date"] = time.Now().Format("2006-01-02")
+    event["account"] = data.Account
+    event["region"] = data.Region
  
-    result, err := svc.UpdateFunctionCode(context.Background(), input)
+    payload, err := json.Marshal(event)
     if err != nil {
-        return err
+        return nil, fmt.Errorf("failed to marshal %s: %v", file, err)
     }
+    return payload, nil
+}
  
-    // Print the updated function ARN
-    fmt.Printf("Function updated: %s\n", *result.FunctionArn)
-    return nil
+func runInvoke(functionName string, events *eventSource, event string, opts deploy.InvokeOptions) {
+    fixture, err := events.load(event)
+    if err != nil {
+        log.Fatalf("%v", err)
+    }
+    opts.FunctionName = functionName
+    opts.Payload = fixture.Payload
+ 
+    invocation, err := deploy.Invoke(newLambdaClient(), opts)
+    if err != nil {
+        log.Fatalf("failed to invoke function: %v", err)
+    }
+ 
+    // Print the invoke result
+    progress.Printf("Invoked %s:%s (%s), status %d\n", functionName, opts.Qualifier, opts.InvocationType, invocation.StatusCode)
+    if invocation.ExecutedVersion != "" {
+        progress.Printf("Executed version: %s\n", invocation.ExecutedVersion)
+    }
+    if len(invocation.Payload) > 0 {
+        progress.Printf("Payload: %s\n", invocation.Payload)
+    }
+    if invocation.Logs != "" {
+        progress.Printf("--- last %d bytes of log ---\n%s", len(invocation.Logs), invocation.Logs)
+    }
+ 
+    // A payload that is not JSON is given as a string
+    var payload json.RawMessage
+    if len(invocation.Payload) > 0 {
+        payload = invocation.Payload
+        if !json.Valid(payload) {
+            payload, _ = json.Marshal(string(invocation.Payload))
+        }
+    }
+    printResult(struct {
+        Function        string          `json:"function"`
+        Qualifier       string          `json:"qualifier"`
+        InvocationType  string          `json:"invocationType"`
+        StatusCode      int32           `json:"statusCode"`
+        ExecutedVersion string          `json:"executedVersion,omitempty"`
+        Payload         json.RawMessage `json:"payload,omitempty"`
+        FunctionError   string          `json:"functionError,omitempty"`
+        Logs            string          `json:"logs,omitempty"`
+    }{functionName, opts.Qualifier, string(opts.InvocationType), invocation.StatusCode, invocation.ExecutedVersion, payload, invocation.FunctionError, invocation.Logs})
+    if invocation.FunctionError != "" {
+        log.Fatalf("function error: %s", invocation.FunctionError)
+    }
 }
  
-func invokeFunction(svc *lambda.Client, functionName string) error {
-    // Read the event JSON from the file
-    eventFile, err := os.ReadFile("./event.json")
+// runEmulate builds the deployment package and runs its bootstrap against a local
+// Runtime API emulator with each event, checking the results like the smoke tests.
+func runEmulate(functionConfig *deploy.FunctionConfig, data fixtures.Data, tests []deploy.SmokeTest) {
+    target := primaryTarget(functionConfig, nil)
+    if _, err := buildPackage(target); err != nil {
+        log.Fatalf("%v", err)
+    }
+    zipFile, err := readPackage(target.outputZip, functionConfig.Architecture)
+    if err != nil {
+        log.Fatalf("%v", err)
+    }
+    if functionConfig.Architecture != goruntime.GOARCH {
+        log.Fatalf("cannot run a %s bootstrap on this %s host; emulate with -arch %s", functionConfig.Architecture, goruntime.GOARCH, goruntime.GOARCH)
+    }
+ 
+    // Run the bootstrap exactly as packaged
+    binary, err := packaging.Bootstrap(zipFile)
     if err != nil {
-        return fmt.Errorf("failed to read event.json file: %v", err)
+        log.Fatalf("%v", err)
+    }
+    dir, err := os.MkdirTemp("", "lambda-emulate-")
+    if err != nil {
+        log.Fatalf("%v", err)
+    }
+    defer os.RemoveAll(dir)
+    bootstrap := filepath.Join(dir, packaging.BootstrapName)
+    if err := os.WriteFile(bootstrap, binary, 0o755); err != nil {
+        log.Fatalf("%v", err)
     }
  
-    // Unmarshal the event JSON
-    var event map[string]interface{}
-    err = json.Unmarshal(eventFile, &event)
+    timeout := time.Duration(functionConfig.Timeout) * time.Second
+    emulator, err := runtimeapi.Start(runtimeapi.Config{
+        FunctionName: functionConfig.FunctionName,
+        FunctionArn:  identity.Identity{Account: data.Account, Partition: data.Partition, Region: data.Region}.FunctionArn(functionConfig.FunctionName),
+        Timeout:      timeout,
+    })
     if err != nil {
-        return fmt.Errorf("failed to unmarshal event JSON: %v", err)
+        log.Fatalf("%v", err)
     }
+    defer emulator.Close()
+    r := &runtimeapi.Runtime{Emulator: emulator, Bootstrap: bootstrap, MemorySize: functionConfig.MemorySize, Stdout: progress.Out, Stderr: os.Stderr}
+    defer r.Stop()
+    progress.Printf("Runtime API emulator on %s\n", emulator.Address())
  
-    // Modify event to add the current date
-    event["detail"].(map[string]interface{})["date"] = time.Now().Format("2006-01-02")
+    type emulateResult struct {
+        Event     string `json:"event"`
+        RequestID string `json:"requestId"`
+        Duration  string `json:"duration"`
+        Response  string `json:"response,omitempty"`
+        Error     string `json:"error,omitempty"`
+        Passed    bool   `json:"passed"`
+    }
+    var results []emulateResult
+    failed := 0
+    for _, test := range tests {
+        result, err := r.Invoke(context.Background(), test.Payload)
+        if err != nil {
+            r.Stop()
+            log.Fatalf("%v", err)
+        }
  
-    // Marshal the event JSON into a payload
-    payload, err := json.Marshal(event)
+        outcome := "response " + string(result.Payload)
+        if result.Error != nil {
+            outcome = "error " + result.Error.Error()
+        }
+        progress.Printf("%s: request %s, %s, %s\n", test.Name, result.RequestID, result.Duration.Round(time.Millisecond), outcome)
+ 
+        emulated := emulateResult{
+            Event:     test.Name,
+            RequestID: result.RequestID,
+            Duration:  result.Duration.Round(time.Millisecond).String(),
+            Response:  string(result.Payload),
+            Passed:    true,
+        }
+        if result.Error != nil {
+            emulated.Error = result.Error.Error()
+        }
+        switch {
+        case test.WantError == "" && result.Error != nil:
+            progress.Printf("FAIL %s: want success\n", test.Name)
+            emulated.Passed = false
+        case test.WantError != "" && (result.Error == nil || !strings.Contains(result.Error.ErrorMessage, test.WantError)):
+            progress.Printf("FAIL %s: want error %q\n", test.Name, test.WantError)
+            emulated.Passed = false
+        }
+        if !emulated.Passed {
+            failed++
+        }
+        results = append(results, emulated)
+    }
+    printResult(results)
+    // log.Fatalf skips deferred calls; stop the bootstrap before the emulator goes away
+    r.Stop()
+    if failed > 0 {
+        log.Fatalf("%d of %d events failed", failed, len(tests))
+    }
+}
+ 
+// runLocalInvoke runs the handler in-process against local stand-ins with the event,
+// without deploying: the handler package is started with -local and reads the event on
+// stdin.
+func runLocalInvoke(events *eventSource, event string, standIns []string) {
+    fixture, err := events.load(event)
     if err != nil {
-        return fmt.Errorf("failed to marshal event: %v", err)
+        log.Fatalf("%v", err)
     }
  
-    // Invoke the Lambda function
-    invokeInput := &lambda.InvokeInput{
-        FunctionName: aws.String(functionName),
-        Payload:      payload,
+    // The local invoke is only compiled in with -tags local, never into the deployed bootstrap
+    args := append([]string{"run", "-tags", "lambda.norpc,local", "./lambda_function", "-local", "-"}, standIns...)
+    var out bytes.Buffer
+    cmd := exec.Command("go", args...)
+    cmd.Stdin = bytes.NewReader(fixture.Payload)
+    cmd.Stdout = io.MultiWriter(progress.Out, &out)
+    cmd.Stderr = os.Stderr
+    progress.Printf("Invoking the handler locally with %s\n", fixture.Name)
+    err = cmd.Run()
+ 
+    // Matched like the smoke tests match a deployed function's error
+    if fixture.ExpectError != "" {
+        if err == nil {
+            log.Fatalf("%s: handler succeeded, want error %q", fixture.Name, fixture.ExpectError)
+        }
+        message, ok := localHandlerError(out.Bytes())
+        if !ok {
+            log.Fatalf("%s: local invoke failed before the handler returned: %v", fixture.Name, err)
+        }
+        if !strings.Contains(message, fixture.ExpectError) {
+            log.Fatalf("%s: handler failed with %q, want %q", fixture.Name, message, fixture.ExpectError)
+        }
+        progress.Printf("%s: handler failed as expected with %q\n", fixture.Name, message)
+        return
+    }
+    if err != nil {
+        log.Fatalf("local invoke failed: %v", err)
     }
+}
  
-    invokeResult, err := svc.Invoke(context.Background(), invokeInput)
+// localHandlerError reads the handler's error from the output of a failed local invoke:
+// its last line, {"errorMessage": ...}. It reports false when the handler did not run.
+func localHandlerError(output []byte) (string, bool) {
+    lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+    var reported struct {
+        ErrorMessage *string `json:"errorMessage"`
+    }
+    if err := json.Unmarshal([]byte(lines[len(lines)-1]), &reported); err != nil || reported.ErrorMessage == nil {
+        return "", false
+    }
+    return *reported.ErrorMessage, true
+}
+ 
+// runLogs prints the function's log events, following them until interrupted.
+func runLogs(opts logs.Options) {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+ 
+    progress.Printf("Reading %s since %s\n", opts.LogGroup, opts.StartTime.Format(time.RFC3339))
+    client := cloudwatchlogs.NewFromConfig(loadAWSConfig())
+    var out io.Writer = os.Stdout
+    if jsonOut != nil {
+        out = jsonOut
+    }
+    if err := logs.Tail(ctx, client, opts, out); err != nil {
+        log.Fatalf("%v", err)
+    }
+}
+ 
+// runHistory lists the recorded deploys, shows one, or diffs two of them.
+func runHistory(path string, ids []string) {
+    records, err := history.Load(path)
     if err != nil {
-        return err
+        log.Fatalf("%v", err)
     }
  
-    // Print the invoke result
-    fmt.Printf("Lambda function invoked successfully: %s\n", string(invokeResult.Payload))
-    return nil
-}
\ No newline at end of file
+    switch len(ids) {
+    case 0:
+        if printResult(records) {
+            return
+        }
+        if len(records) == 0 {
+            progress.Printf("No deploys recorded in %s\n", path)
+            return
+        }
+        for _, r := range records {
+            commit := r.GitCommit
+            if len(commit) > 8 {
+                commit = commit[:8]
+            }
+            if r.GitDirty {
+                commit += "+"
+            }
+            progress.Printf("%-8s  %s  %-30s %-7s %-11s %-9s %s\n", r.ID, r.Time.Local().Format("2006-01-02 15:04:05"), r.Function, r.Version, r.Outcome, commit, r.Caller)
+        }
+    case 1:
+        record, err := history.Find(records, ids[0])
+        if err != nil {
+            log.Fatalf("%v", err)
+        }
+        if !printResult(record) {
+            data, _ := json.MarshalIndent(record, "", "  ")
+            progress.Println(string(data))
+        }
+    case 2:
+        from, err := history.Find(records, ids[0])
+        if err != nil {
+            log.Fatalf("%v", err)
+        }
+        to, err := history.Find(records, ids[1])
+        if err != nil {
+            log.Fatalf("%v", err)
+        }
+        changes := history.Diff(from, to)
+        if printResult(struct {
+            From    string          `json:"from"`
+            To      string          `json:"to"`
+            Changes []deploy.Change `json:"changes"`
+        }{from.ID, to.ID, changes}) {
+            return
+        }
+        if len(changes) == 0 {
+            progress.Printf("No differences between %s and %s\n", from.ID, to.ID)
+        }
+        for _, change := range changes {
+            progress.Printf("  %s\n", change)
+        }
+    default:
+        log.Fatalf("history takes at most two deployment IDs")
+    }
+}
+ 
+// runBreakLock removes the lease on name, whoever holds it, after confirmation.
+func runBreakLock(name string, yes bool) {
+    client := ssm.NewFromConfig(loadAWSConfig())
+    current, err := lock.Current(client, name)
+    if err != nil {
+        log.Fatalf("%v", err)
+    }
+    if current == nil {
+        progress.Printf("%s is not locked\n", name)
+        printResult(struct {
+            Name   string      `json:"name"`
+            Broken *lock.Lease `json:"broken"`
+        }{name, nil})
+        return
+    }
+ 
+    progress.Printf("%s is locked by %s\n", name, current)
+    if !current.Expired(time.Now()) && !yes && !confirm("The lease has not expired; that run may still be going. Type yes to break it: ") {
+        log.Fatalf("the lock was kept")
+    }
+    broken, err := lock.Break(client, name)
+    if err != nil {
+        log.Fatalf("%v", err)
+    }
+    progress.Printf("Broke the lock of %s\n", name)
+    printResult(struct {
+        Name   string      `json:"name"`
+        Broken *lock.Lease `json:"broken"`
+    }{name, broken})
+}
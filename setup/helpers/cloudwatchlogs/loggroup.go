@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+
+	"setup/helpers/progress"
+)
+
+type logsClient interface {
+	CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error)
+	DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
+	PutRetentionPolicy(ctx context.Context, params *cloudwatchlogs.PutRetentionPolicyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutRetentionPolicyOutput, error)
+	PutResourcePolicy(ctx context.Context, params *cloudwatchlogs.PutResourcePolicyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutResourcePolicyOutput, error)
+}
+
+// CreateLogGroup creates the log group if it does not exist yet, applies the retention
+// period and returns the log group ARN (without the trailing ":*").
+func CreateLogGroup(client logsClient, logGroupName string, retentionDays int32) (string, error) {
+	_, err := client.CreateLogGroup(context.Background(), &cloudwatchlogs.CreateLogGroupInput{
+		LogGroupName: aws.String(logGroupName),
+	})
+	if err != nil {
+		if !strings.Contains(err.Error(), "ResourceAlreadyExistsException") {
+			progress.Println("Error creating log group:", err)
+			return "", err
+		}
+		progress.Println("Log group already exists. Log group Name:", logGroupName)
+	}
+
+	if retentionDays > 0 {
+		_, err = client.PutRetentionPolicy(context.Background(), &cloudwatchlogs.PutRetentionPolicyInput{
+			LogGroupName:    aws.String(logGroupName),
+			RetentionInDays: aws.Int32(retentionDays),
+		})
+		if err != nil {
+			progress.Println("Error setting log group retention:", err)
+			return "", err
+		}
+	}
+
+	result, err := client.DescribeLogGroups(context.Background(), &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(logGroupName),
+	})
+	if err != nil {
+		progress.Println("Error describing log group:", err)
+		return "", err
+	}
+	for _, group := range result.LogGroups {
+		if aws.ToString(group.LogGroupName) == logGroupName {
+			logGroupArn := strings.TrimSuffix(aws.ToString(group.Arn), ":*")
+			progress.Println("Log group ready. Log group ARN:", logGroupArn)
+			return logGroupArn, nil
+		}
+	}
+	return "", fmt.Errorf("log group %s not found after creation", logGroupName)
+}
+
+type policyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []policyStatement `json:"Statement"`
+}
+
+type policyStatement struct {
+	Sid       string              `json:"Sid"`
+	Effect    string              `json:"Effect"`
+	Principal map[string][]string `json:"Principal"`
+	Action    []string            `json:"Action"`
+	Resource  string              `json:"Resource"`
+}
+
+// EventsResourcePolicy returns the resource policy that lets EventBridge write to the log group.
+func EventsResourcePolicy(logGroupArn string) (string, error) {
+	document := policyDocument{
+		Version: "2012-10-17",
+		Statement: []policyStatement{{
+			Sid:    "EventBridgeToCloudWatchLogs",
+			Effect: "Allow",
+			Principal: map[string][]string{
+				"Service": {"events.amazonaws.com", "delivery.logs.amazonaws.com"},
+			},
+			Action:   []string{"logs:CreateLogStream", "logs:PutLogEvents"},
+			Resource: logGroupArn + ":*",
+		}},
+	}
+	policy, err := json.Marshal(document)
+	if err != nil {
+		return "", err
+	}
+	return string(policy), nil
+}
+
+// PutEventsResourcePolicy creates or replaces the named resource policy allowing
+// EventBridge to deliver events into the log group.
+func PutEventsResourcePolicy(client logsClient, policyName, logGroupArn string) error {
+	policy, err := EventsResourcePolicy(logGroupArn)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutResourcePolicy(context.Background(), &cloudwatchlogs.PutResourcePolicyInput{
+		PolicyName:     aws.String(policyName),
+		PolicyDocument: aws.String(policy),
+	})
+	if err != nil {
+		progress.Println("Error putting log resource policy:", err)
+		return err
+	}
+
+	progress.Println("Log resource policy applied successfully. Policy Name:", policyName)
+	return nil
+}
@@ -0,0 +1,85 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateLogGroup(t *testing.T) {
+	t.Run("log group created", func(t *testing.T) {
+		client := &mockLogsClient{}
+		arn, err := CreateLogGroup(client, "/aws/events/debug-eventbus", 7)
+		assert.NoError(t, err)
+		assert.Equal(t, "arn:aws:logs:us-east-1:123456789012:log-group:/aws/events/debug-eventbus", arn)
+		assert.Equal(t, int32(7), client.retentionDays)
+	})
+
+	t.Run("log group already exists", func(t *testing.T) {
+		client := &mockLogsClient{
+			CreateLogGroupErr: fmt.Errorf("ResourceAlreadyExistsException: The specified log group already exists"),
+		}
+		arn, err := CreateLogGroup(client, "/aws/events/debug-eventbus", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "arn:aws:logs:us-east-1:123456789012:log-group:/aws/events/debug-eventbus", arn)
+	})
+
+	t.Run("error creating log group", func(t *testing.T) {
+		client := &mockLogsClient{
+			CreateLogGroupErr: fmt.Errorf("AccessDeniedException"),
+		}
+		_, err := CreateLogGroup(client, "/aws/events/debug-eventbus", 7)
+		assert.Error(t, err)
+	})
+}
+
+func TestPutEventsResourcePolicy(t *testing.T) {
+	client := &mockLogsClient{}
+	err := PutEventsResourcePolicy(client, "EventBridgeDebugLogs", "arn:aws:logs:us-east-1:123456789012:log-group:/aws/events/debug-eventbus")
+	assert.NoError(t, err)
+
+	var document policyDocument
+	assert.NoError(t, json.Unmarshal([]byte(client.policy), &document))
+	assert.Equal(t, "arn:aws:logs:us-east-1:123456789012:log-group:/aws/events/debug-eventbus:*", document.Statement[0].Resource)
+	assert.Contains(t, document.Statement[0].Principal["Service"], "events.amazonaws.com")
+}
+
+type mockLogsClient struct {
+	CreateLogGroupErr error
+
+	retentionDays int32
+	policy        string
+}
+
+func (client *mockLogsClient) CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	if client.CreateLogGroupErr != nil {
+		return nil, client.CreateLogGroupErr
+	}
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (client *mockLogsClient) DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	name := aws.ToString(params.LogGroupNamePrefix)
+	return &cloudwatchlogs.DescribeLogGroupsOutput{
+		LogGroups: []types.LogGroup{
+			{LogGroupName: aws.String(name + "-other"), Arn: aws.String("arn:aws:logs:us-east-1:123456789012:log-group:" + name + "-other:*")},
+			{LogGroupName: aws.String(name), Arn: aws.String("arn:aws:logs:us-east-1:123456789012:log-group:" + name + ":*")},
+		},
+	}, nil
+}
+
+func (client *mockLogsClient) PutRetentionPolicy(ctx context.Context, params *cloudwatchlogs.PutRetentionPolicyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+	client.retentionDays = aws.ToInt32(params.RetentionInDays)
+	return &cloudwatchlogs.PutRetentionPolicyOutput{}, nil
+}
+
+func (client *mockLogsClient) PutResourcePolicy(ctx context.Context, params *cloudwatchlogs.PutResourcePolicyInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutResourcePolicyOutput, error) {
+	client.policy = aws.ToString(params.PolicyDocument)
+	return &cloudwatchlogs.PutResourcePolicyOutput{}, nil
+}
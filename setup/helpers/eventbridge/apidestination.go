@@ -0,0 +1,95 @@
+package helpers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"setup/helpers/progress"
+)
+
+// ApiDestinationTargetID is the target ID used for the deploy webhook on a rule.
+const ApiDestinationTargetID = "DeployWebhook"
+
+// ApiDestination describes an HTTP endpoint EventBridge posts matched events to.
+type ApiDestination struct {
+	Name          string
+	ConnectionArn string
+	Endpoint      string
+	HttpMethod    types.ApiDestinationHttpMethod
+	// RateLimitPerSecond caps how fast EventBridge calls the endpoint; 0 leaves the service default.
+	RateLimitPerSecond int32
+}
+
+// CreateOrUpdateApiDestination creates the API destination, or updates it in place when it
+// already exists, and returns its ARN.
+func CreateOrUpdateApiDestination(client eventbridgeClient, dest ApiDestination) (string, error) {
+	method := dest.HttpMethod
+	if method == "" {
+		method = types.ApiDestinationHttpMethodPost
+	}
+	var rateLimit *int32
+	if dest.RateLimitPerSecond > 0 {
+		rateLimit = aws.Int32(dest.RateLimitPerSecond)
+	}
+
+	result, err := client.CreateApiDestination(context.Background(), &eventbridge.CreateApiDestinationInput{
+		Name:                         aws.String(dest.Name),
+		ConnectionArn:                aws.String(dest.ConnectionArn),
+		InvocationEndpoint:           aws.String(dest.Endpoint),
+		HttpMethod:                   method,
+		InvocationRateLimitPerSecond: rateLimit,
+	})
+	if err == nil {
+		progress.Println("API destination created successfully. API destination ARN:", aws.ToString(result.ApiDestinationArn))
+		return aws.ToString(result.ApiDestinationArn), nil
+	}
+	if !strings.Contains(err.Error(), "ResourceAlreadyExistsException") {
+		progress.Println("Error creating API destination:", err)
+		return "", err
+	}
+
+	updated, err := client.UpdateApiDestination(context.Background(), &eventbridge.UpdateApiDestinationInput{
+		Name:                         aws.String(dest.Name),
+		ConnectionArn:                aws.String(dest.ConnectionArn),
+		InvocationEndpoint:           aws.String(dest.Endpoint),
+		HttpMethod:                   method,
+		InvocationRateLimitPerSecond: rateLimit,
+	})
+	if err != nil {
+		progress.Println("Error updating API destination:", err)
+		return "", err
+	}
+
+	progress.Println("API destination updated successfully. API destination ARN:", aws.ToString(updated.ApiDestinationArn))
+	return aws.ToString(updated.ApiDestinationArn), nil
+}
+
+// AddApiDestinationTarget attaches an API destination to a rule. EventBridge assumes
+// roleArn to invoke the destination, so the role needs events:InvokeApiDestination.
+func AddApiDestinationTarget(client eventbridgeClient, ruleName, eventBusName, destinationArn, roleArn string) error {
+	target := types.Target{
+		Arn:     aws.String(destinationArn),
+		Id:      aws.String(ApiDestinationTargetID),
+		RoleArn: aws.String(roleArn),
+	}
+
+	output, err := client.PutTargets(context.Background(), &eventbridge.PutTargetsInput{
+		Rule:         aws.String(ruleName),
+		Targets:      []types.Target{target},
+		EventBusName: aws.String(eventBusName),
+	})
+	if err == nil {
+		err = failedTarget(output, ruleName)
+	}
+	if err != nil {
+		progress.Println("Error adding API destination target to rule:", err.Error())
+		return err
+	}
+
+	progress.Println("API destination target added to rule successfully")
+	return nil
+}
@@ -0,0 +1,161 @@
+package helpers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// eventbridgeStandIn is a local HTTP stand-in for the EventBridge JSON API. It records the
+// decoded request bodies per operation and answers with canned responses.
+type eventbridgeStandIn struct {
+	requests map[string][]map[string]interface{}
+	existing map[string]bool
+	// rejectTargets, when set, is the error code PutTargets fails each target with.
+	rejectTargets string
+}
+
+func newEventbridgeStandIn(t *testing.T) (*eventbridgeStandIn, *eventbridge.Client) {
+	standIn := &eventbridgeStandIn{
+		requests: map[string][]map[string]interface{}{},
+		existing: map[string]bool{},
+	}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	client := eventbridge.New(eventbridge.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  aws.AnonymousCredentials{},
+	})
+	return standIn, client
+}
+
+func (s *eventbridgeStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AWSEvents.")
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	s.requests[operation] = append(s.requests[operation], body)
+
+	name, _ := body["Name"].(string)
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	switch operation {
+	case "CreateConnection", "CreateApiDestination":
+		if s.existing[name] {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceAlreadyExistsException","message":"already exists"}`))
+			return
+		}
+		s.existing[name] = true
+		fallthrough
+	case "UpdateConnection", "UpdateApiDestination":
+		if strings.HasSuffix(operation, "Connection") {
+			json.NewEncoder(w).Encode(map[string]string{"ConnectionArn": "arn:aws:events:us-east-1:123456789012:connection/" + name})
+		} else {
+			json.NewEncoder(w).Encode(map[string]string{"ApiDestinationArn": "arn:aws:events:us-east-1:123456789012:api-destination/" + name})
+		}
+	case "PutTargets":
+		if s.rejectTargets != "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"FailedEntryCount": 1,
+				"FailedEntries": []map[string]string{{
+					"TargetId":     ApiDestinationTargetID,
+					"ErrorCode":    s.rejectTargets,
+					"ErrorMessage": "Invalid RoleArn provided",
+				}},
+			})
+			return
+		}
+		w.Write([]byte(`{"FailedEntryCount":0,"FailedEntries":[]}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"UnknownOperationException"}`))
+	}
+}
+
+func TestCreateOrUpdateConnection(t *testing.T) {
+	t.Run("api key connection created", func(t *testing.T) {
+		standIn, client := newEventbridgeStandIn(t)
+		arn, err := CreateOrUpdateConnection(client, "deploy-webhook", ConnectionAuth{
+			Type:        types.ConnectionAuthorizationTypeApiKey,
+			APIKeyName:  "X-Deploy-Token",
+			APIKeyValue: "secret",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "arn:aws:events:us-east-1:123456789012:connection/deploy-webhook", arn)
+
+		sent := standIn.requests["CreateConnection"][0]
+		assert.Equal(t, "API_KEY", sent["AuthorizationType"])
+		apiKey := sent["AuthParameters"].(map[string]interface{})["ApiKeyAuthParameters"].(map[string]interface{})
+		assert.Equal(t, "X-Deploy-Token", apiKey["ApiKeyName"])
+	})
+
+	t.Run("existing oauth connection updated", func(t *testing.T) {
+		standIn, client := newEventbridgeStandIn(t)
+		standIn.existing["deploy-webhook"] = true
+		_, err := CreateOrUpdateConnection(client, "deploy-webhook", ConnectionAuth{
+			Type:              types.ConnectionAuthorizationTypeOauthClientCredentials,
+			OAuthClientID:     "client",
+			OAuthClientSecret: "secret",
+			OAuthEndpoint:     "https://auth.internal/token",
+		})
+		assert.NoError(t, err)
+		assert.Len(t, standIn.requests["UpdateConnection"], 1)
+
+		oauth := standIn.requests["UpdateConnection"][0]["AuthParameters"].(map[string]interface{})["OAuthParameters"].(map[string]interface{})
+		assert.Equal(t, "POST", oauth["HttpMethod"])
+	})
+
+	t.Run("missing credentials rejected before any call", func(t *testing.T) {
+		standIn, client := newEventbridgeStandIn(t)
+		_, err := CreateOrUpdateConnection(client, "deploy-webhook", ConnectionAuth{
+			Type:     types.ConnectionAuthorizationTypeBasic,
+			Username: "deployer",
+		})
+		assert.Error(t, err)
+		assert.Empty(t, standIn.requests)
+	})
+}
+
+func TestCreateOrUpdateApiDestination(t *testing.T) {
+	standIn, client := newEventbridgeStandIn(t)
+	dest := ApiDestination{
+		Name:               "deploy-webhook",
+		ConnectionArn:      "arn:aws:events:us-east-1:123456789012:connection/deploy-webhook",
+		Endpoint:           "https://deploy.internal/hooks/ecr",
+		RateLimitPerSecond: 5,
+	}
+
+	arn, err := CreateOrUpdateApiDestination(client, dest)
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws:events:us-east-1:123456789012:api-destination/deploy-webhook", arn)
+	assert.Equal(t, float64(5), standIn.requests["CreateApiDestination"][0]["InvocationRateLimitPerSecond"])
+	assert.Equal(t, "POST", standIn.requests["CreateApiDestination"][0]["HttpMethod"])
+
+	// A second run updates the destination in place
+	_, err = CreateOrUpdateApiDestination(client, dest)
+	assert.NoError(t, err)
+	assert.Len(t, standIn.requests["UpdateApiDestination"], 1)
+}
+
+func TestAddApiDestinationTarget(t *testing.T) {
+	standIn, client := newEventbridgeStandIn(t)
+	err := AddApiDestinationTarget(client, "Rule-ECRPushEvent", "eventbus", "arn:aws:events:us-east-1:123456789012:api-destination/deploy-webhook", "arn:aws:iam::123456789012:role/eventbridge-invoke-api")
+	assert.NoError(t, err)
+
+	target := standIn.requests["PutTargets"][0]["Targets"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, ApiDestinationTargetID, target["Id"])
+	assert.Equal(t, "arn:aws:iam::123456789012:role/eventbridge-invoke-api", target["RoleArn"])
+
+	// A rejected target fails the call, though PutTargets itself succeeds
+	standIn.rejectTargets = "ValidationException"
+	err = AddApiDestinationTarget(client, "Rule-ECRPushEvent", "eventbus", "arn:aws:events:us-east-1:123456789012:api-destination/deploy-webhook", "arn:aws:iam::123456789012:role/missing")
+	assert.ErrorContains(t, err, "failed to add target "+ApiDestinationTargetID+" to rule Rule-ECRPushEvent: ValidationException: Invalid RoleArn provided")
+}
@@ -0,0 +1,149 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"setup/helpers/progress"
+)
+
+// ConnectionAuth holds the credentials EventBridge uses when calling an API destination.
+// Type selects which of the credential groups is sent.
+type ConnectionAuth struct {
+	Type types.ConnectionAuthorizationType
+
+	// BASIC
+	Username string
+	Password string
+
+	// API_KEY
+	APIKeyName  string
+	APIKeyValue string
+
+	// OAUTH_CLIENT_CREDENTIALS
+	OAuthClientID     string
+	OAuthClientSecret string
+	OAuthEndpoint     string
+	OAuthHTTPMethod   types.ConnectionOAuthHttpMethod
+}
+
+// Validate checks that the credentials required by the auth type are present.
+func (a ConnectionAuth) Validate() error {
+	switch a.Type {
+	case types.ConnectionAuthorizationTypeBasic:
+		if a.Username == "" || a.Password == "" {
+			return fmt.Errorf("basic auth needs a username and password")
+		}
+	case types.ConnectionAuthorizationTypeApiKey:
+		if a.APIKeyName == "" || a.APIKeyValue == "" {
+			return fmt.Errorf("api key auth needs a key name and value")
+		}
+	case types.ConnectionAuthorizationTypeOauthClientCredentials:
+		if a.OAuthClientID == "" || a.OAuthClientSecret == "" || a.OAuthEndpoint == "" {
+			return fmt.Errorf("oauth auth needs a client id, client secret and authorization endpoint")
+		}
+	default:
+		return fmt.Errorf("unsupported connection auth type %q", a.Type)
+	}
+	return nil
+}
+
+// CreateOrUpdateConnection creates the connection, or updates its credentials when it
+// already exists, and returns the connection ARN.
+func CreateOrUpdateConnection(client eventbridgeClient, name string, auth ConnectionAuth) (string, error) {
+	if err := auth.Validate(); err != nil {
+		return "", err
+	}
+
+	result, err := client.CreateConnection(context.Background(), &eventbridge.CreateConnectionInput{
+		Name:              aws.String(name),
+		AuthorizationType: auth.Type,
+		AuthParameters:    auth.createParameters(),
+	})
+	if err == nil {
+		progress.Println("Connection created successfully. Connection ARN:", aws.ToString(result.ConnectionArn))
+		return aws.ToString(result.ConnectionArn), nil
+	}
+	if !strings.Contains(err.Error(), "ResourceAlreadyExistsException") {
+		progress.Println("Error creating connection:", err)
+		return "", err
+	}
+
+	// The connection exists, so push the current credentials instead
+	updated, err := client.UpdateConnection(context.Background(), &eventbridge.UpdateConnectionInput{
+		Name:              aws.String(name),
+		AuthorizationType: auth.Type,
+		AuthParameters:    auth.updateParameters(),
+	})
+	if err != nil {
+		progress.Println("Error updating connection:", err)
+		return "", err
+	}
+
+	progress.Println("Connection updated successfully. Connection ARN:", aws.ToString(updated.ConnectionArn))
+	return aws.ToString(updated.ConnectionArn), nil
+}
+
+func (a ConnectionAuth) createParameters() *types.CreateConnectionAuthRequestParameters {
+	params := &types.CreateConnectionAuthRequestParameters{}
+	switch a.Type {
+	case types.ConnectionAuthorizationTypeBasic:
+		params.BasicAuthParameters = &types.CreateConnectionBasicAuthRequestParameters{
+			Username: aws.String(a.Username),
+			Password: aws.String(a.Password),
+		}
+	case types.ConnectionAuthorizationTypeApiKey:
+		params.ApiKeyAuthParameters = &types.CreateConnectionApiKeyAuthRequestParameters{
+			ApiKeyName:  aws.String(a.APIKeyName),
+			ApiKeyValue: aws.String(a.APIKeyValue),
+		}
+	case types.ConnectionAuthorizationTypeOauthClientCredentials:
+		params.OAuthParameters = &types.CreateConnectionOAuthRequestParameters{
+			AuthorizationEndpoint: aws.String(a.OAuthEndpoint),
+			HttpMethod:            a.oauthMethod(),
+			ClientParameters: &types.CreateConnectionOAuthClientRequestParameters{
+				ClientID:     aws.String(a.OAuthClientID),
+				ClientSecret: aws.String(a.OAuthClientSecret),
+			},
+		}
+	}
+	return params
+}
+
+func (a ConnectionAuth) updateParameters() *types.UpdateConnectionAuthRequestParameters {
+	params := &types.UpdateConnectionAuthRequestParameters{}
+	switch a.Type {
+	case types.ConnectionAuthorizationTypeBasic:
+		params.BasicAuthParameters = &types.UpdateConnectionBasicAuthRequestParameters{
+			Username: aws.String(a.Username),
+			Password: aws.String(a.Password),
+		}
+	case types.ConnectionAuthorizationTypeApiKey:
+		params.ApiKeyAuthParameters = &types.UpdateConnectionApiKeyAuthRequestParameters{
+			ApiKeyName:  aws.String(a.APIKeyName),
+			ApiKeyValue: aws.String(a.APIKeyValue),
+		}
+	case types.ConnectionAuthorizationTypeOauthClientCredentials:
+		params.OAuthParameters = &types.UpdateConnectionOAuthRequestParameters{
+			AuthorizationEndpoint: aws.String(a.OAuthEndpoint),
+			HttpMethod:            a.oauthMethod(),
+			ClientParameters: &types.UpdateConnectionOAuthClientRequestParameters{
+				ClientID:     aws.String(a.OAuthClientID),
+				ClientSecret: aws.String(a.OAuthClientSecret),
+			},
+		}
+	}
+	return params
+}
+
+func (a ConnectionAuth) oauthMethod() types.ConnectionOAuthHttpMethod {
+	if a.OAuthHTTPMethod == "" {
+		return types.ConnectionOAuthHttpMethodPost
+	}
+	return a.OAuthHTTPMethod
+}
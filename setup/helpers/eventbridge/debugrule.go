@@ -0,0 +1,68 @@
+package helpers
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"setup/helpers/progress"
+)
+
+const (
+	// DebugRuleName is the catch-all rule that copies every event on a bus to CloudWatch Logs.
+	DebugRuleName = "Rule-DebugCatchAll"
+	// DebugTargetID is the target ID of the debug log group on the catch-all rule.
+	DebugTargetID = "DebugLogGroup"
+
+	// CatchAllEventPattern matches every event: each event has a source, and every
+	// source starts with the empty prefix.
+	CatchAllEventPattern = `{"source": [{"prefix": ""}]}`
+)
+
+// DebugLogGroupName returns the log group the catch-all rule for a bus writes to.
+// EventBridge only delivers to log groups under /aws/events/.
+func DebugLogGroupName(eventBusName string) string {
+	return "/aws/events/debug-" + eventBusName
+}
+
+// CreateDebugRule creates a rule that matches every event on the bus and returns its name.
+func CreateDebugRule(client eventbridgeClient, eventBusName string) (string, error) {
+	result, err := client.PutRule(context.Background(), &eventbridge.PutRuleInput{
+		Name:         aws.String(DebugRuleName),
+		EventPattern: aws.String(CatchAllEventPattern),
+		EventBusName: aws.String(eventBusName),
+		Description:  aws.String("Copies every event on the bus to CloudWatch Logs for debugging"),
+	})
+	if err != nil {
+		progress.Println("Error creating debug rule:", err)
+		return "", err
+	}
+
+	progress.Println("Debug rule created successfully. Rule ARN:", aws.ToString(result.RuleArn))
+	return DebugRuleName, nil
+}
+
+// AddLogGroupTarget attaches a CloudWatch Logs group to a rule.
+func AddLogGroupTarget(client eventbridgeClient, ruleName, eventBusName, logGroupArn string) error {
+	output, err := client.PutTargets(context.Background(), &eventbridge.PutTargetsInput{
+		Rule: aws.String(ruleName),
+		Targets: []types.Target{{
+			Arn: aws.String(logGroupArn),
+			Id:  aws.String(DebugTargetID),
+		}},
+		EventBusName: aws.String(eventBusName),
+	})
+	// A missing or not yet propagated resource policy rejects the target, not the call
+	if err == nil {
+		err = failedTarget(output, ruleName)
+	}
+	if err != nil {
+		progress.Println("Error adding log group target to rule:", err.Error())
+		return err
+	}
+
+	progress.Println("Log group target added to rule successfully")
+	return nil
+}
@@ -2,21 +2,32 @@ package helpers
 
 import (
 	"context"
-	"fmt"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+
+	"setup/helpers/progress"
 )
 
 type eventbridgeClient interface {
+	DescribeEventBus(ctx context.Context, params *eventbridge.DescribeEventBusInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeEventBusOutput, error)
+	DescribeRule(ctx context.Context, params *eventbridge.DescribeRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeRuleOutput, error)
 	CreateEventBus(ctx context.Context, params *eventbridge.CreateEventBusInput, optFns ...func(*eventbridge.Options)) (*eventbridge.CreateEventBusOutput, error)
 	PutRule(ctx context.Context, params *eventbridge.PutRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutRuleOutput, error)
 	PutTargets(ctx context.Context, params *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error)
+	RemoveTargets(ctx context.Context, params *eventbridge.RemoveTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.RemoveTargetsOutput, error)
+	CreateConnection(ctx context.Context, params *eventbridge.CreateConnectionInput, optFns ...func(*eventbridge.Options)) (*eventbridge.CreateConnectionOutput, error)
+	UpdateConnection(ctx context.Context, params *eventbridge.UpdateConnectionInput, optFns ...func(*eventbridge.Options)) (*eventbridge.UpdateConnectionOutput, error)
+	CreateApiDestination(ctx context.Context, params *eventbridge.CreateApiDestinationInput, optFns ...func(*eventbridge.Options)) (*eventbridge.CreateApiDestinationOutput, error)
+	UpdateApiDestination(ctx context.Context, params *eventbridge.UpdateApiDestinationInput, optFns ...func(*eventbridge.Options)) (*eventbridge.UpdateApiDestinationOutput, error)
 }
 
+// EventBusName is the custom bus setup creates.
+const EventBusName = "eventbus"
+
 func CreateOrUpdateEventBus(client eventbridgeClient) (string, error) {
-	eventBusName := "eventbus"
+	eventBusName := EventBusName
 
 	// Try to create the EventBus
 	createInput := &eventbridge.CreateEventBusInput{
@@ -26,15 +37,27 @@ func CreateOrUpdateEventBus(client eventbridgeClient) (string, error) {
 	if err != nil {
 		// Check if the error is because the EventBus already exists
 		if strings.Contains(err.Error(), "ResourceAlreadyExistsException") {
-			fmt.Println("Event bus already exists. Event bus Name:", eventBusName)
+			progress.Println("Event bus already exists. Event bus Name:", eventBusName)
 			return eventBusName, nil
 		} else {
-			fmt.Println("Error creating event bus:", err)
+			progress.Println("Error creating event bus:", err)
 			return "", err
 		}
 	}
 
 	eventBusName = strings.Split(aws.ToString(result.EventBusArn), "/")[1]
-	fmt.Println("Event bus created successfully. Event bus Name:", eventBusName)
+	progress.Println("Event bus created successfully. Event bus Name:", eventBusName)
 	return eventBusName, nil
 }
+
+// EventBusArn looks up the ARN of an existing event bus.
+func EventBusArn(client eventbridgeClient, eventBusName string) (string, error) {
+	result, err := client.DescribeEventBus(context.Background(), &eventbridge.DescribeEventBusInput{
+		Name: aws.String(eventBusName),
+	})
+	if err != nil {
+		progress.Println("Error describing event bus:", err)
+		return "", err
+	}
+	return aws.ToString(result.Arn), nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -53,9 +54,10 @@ func TestCreateOrUpdateEventBus(t *testing.T) {
 			},
 		}
 		
+		// An existing bus is reused under the fixed name setup creates
 		output, err := CreateOrUpdateEventBus(client)
 		assert.NoError(t, err)
-		assert.Equal(t, output, "eventbus8")
+		assert.Equal(t, EventBusName, output)
 	})
 
 	t.Run("error creating event bus", func(t *testing.T) {
@@ -67,6 +69,18 @@ func TestCreateOrUpdateEventBus(t *testing.T) {
 	})
 }
 
+func TestEventBusArn(t *testing.T) {
+	output, err := EventBusArn(mockEventbridgeClient{}, "myBusname")
+	assert.NoError(t, err)
+	assert.Equal(t, "arn/myBusname", output)
+}
+
+func TestRuleArn(t *testing.T) {
+	output, err := RuleArn(mockEventbridgeClient{}, "myRuleName", "myBusname")
+	assert.NoError(t, err)
+	assert.Equal(t, "arn/myBusname/myRuleName", output)
+}
+
 func TestCreateRule(t *testing.T) {
 	t.Run("client returning rule name", func(t *testing.T) {
 		clientA := mockEventbridgeClient{}
@@ -88,7 +102,7 @@ func TestCreateRule(t *testing.T) {
 func TestAddTarget(t *testing.T) {
 	t.Run("Error adding target to rule:", func(t *testing.T) {
 		clientB := mockEventbridgeClient{}
-		err := AddTarget(clientB, "myRuleName", "myBusname")
+		err := AddTarget(clientB, "myRuleName", "myBusname", "arn:aws:lambda:us-east-1:123456789012:function:MyGoLambdaFunction")
 		assert.Nil(t, err)
 	})
 
@@ -96,17 +110,48 @@ func TestAddTarget(t *testing.T) {
 		clientB := mockEventbridgeClient{
 			PutTargetsErr: fmt.Errorf("Error adding target to rule:"),
 		}
-		err := AddTarget(clientB, "myRuleName", "myBusname")
+		err := AddTarget(clientB, "myRuleName", "myBusname", "arn:aws:lambda:us-east-1:123456789012:function:MyGoLambdaFunction")
 		//	assert.Equal(t,output,"myBusname")
 		// assert.NotNil(t,err)
 		assert.Equal(t, err.Error(), "Error adding target to rule:")
 	})
+
+	t.Run("target rejected", func(t *testing.T) {
+		clientB := mockEventbridgeClient{PutTargetsFailed: "ValidationException"}
+		err := AddFunctionTarget(clientB, "myRuleName", "myBusname", "Lambda-other", "arn:aws:lambda:us-east-1:123456789012:function:other:live")
+		assert.ErrorContains(t, err, "failed to add target Lambda-other to rule myRuleName: ValidationException: target rejected")
+	})
+}
+
+func TestRemoveTarget(t *testing.T) {
+	assert.NoError(t, RemoveTarget(mockEventbridgeClient{}, "Rule-ECRPushEvent", "eventbus", LambdaTargetID))
+
+	gone := mockEventbridgeClient{RemoveTargetsErr: fmt.Errorf("ResourceNotFoundException: Rule Rule-ECRPushEvent does not exist")}
+	assert.NoError(t, RemoveTarget(gone, "Rule-ECRPushEvent", "eventbus", LambdaTargetID))
+
+	denied := mockEventbridgeClient{RemoveTargetsErr: fmt.Errorf("AccessDeniedException")}
+	assert.Error(t, RemoveTarget(denied, "Rule-ECRPushEvent", "eventbus", LambdaTargetID))
 }
 
 type mockEventbridgeClient struct {
 	CreateEventBusErr error
 	PutRuleErr        error
 	PutTargetsErr     error
+	RemoveTargetsErr  error
+	// PutTargetsFailed is the error code every target is rejected with, when set.
+	PutTargetsFailed string
+}
+
+func (client mockEventbridgeClient) DescribeEventBus(ctx context.Context, params *eventbridge.DescribeEventBusInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeEventBusOutput, error) {
+	return &eventbridge.DescribeEventBusOutput{
+		Arn: aws.String("arn/" + aws.ToString(params.Name)),
+	}, nil
+}
+
+func (client mockEventbridgeClient) DescribeRule(ctx context.Context, params *eventbridge.DescribeRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeRuleOutput, error) {
+	return &eventbridge.DescribeRuleOutput{
+		Arn: aws.String("arn/" + aws.ToString(params.EventBusName) + "/" + aws.ToString(params.Name)),
+	}, nil
 }
 
 func (client mockEventbridgeClient) CreateEventBus(ctx context.Context, params *eventbridge.CreateEventBusInput, optFns ...func(*eventbridge.Options)) (*eventbridge.CreateEventBusOutput, error) {
@@ -134,7 +179,73 @@ func (client mockEventbridgeClient) PutTargets(ctx context.Context, params *even
 	if client.PutTargetsErr != nil {
 		return nil, client.PutTargetsErr
 	}
+	if client.PutTargetsFailed != "" {
+		var failed []types.PutTargetsResultEntry
+		for _, target := range params.Targets {
+			failed = append(failed, types.PutTargetsResultEntry{
+				TargetId:     target.Id,
+				ErrorCode:    aws.String(client.PutTargetsFailed),
+				ErrorMessage: aws.String("target rejected"),
+			})
+		}
+		return &eventbridge.PutTargetsOutput{FailedEntryCount: int32(len(failed)), FailedEntries: failed}, nil
+	}
 
 	return &eventbridge.PutTargetsOutput{}, nil
 }
 
+func (client mockEventbridgeClient) RemoveTargets(ctx context.Context, params *eventbridge.RemoveTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.RemoveTargetsOutput, error) {
+	if client.RemoveTargetsErr != nil {
+		return nil, client.RemoveTargetsErr
+	}
+	return &eventbridge.RemoveTargetsOutput{}, nil
+}
+
+
+func (client mockEventbridgeClient) CreateConnection(ctx context.Context, params *eventbridge.CreateConnectionInput, optFns ...func(*eventbridge.Options)) (*eventbridge.CreateConnectionOutput, error) {
+	return &eventbridge.CreateConnectionOutput{
+		ConnectionArn: aws.String("arn/connection/" + aws.ToString(params.Name)),
+	}, nil
+}
+
+func (client mockEventbridgeClient) UpdateConnection(ctx context.Context, params *eventbridge.UpdateConnectionInput, optFns ...func(*eventbridge.Options)) (*eventbridge.UpdateConnectionOutput, error) {
+	return &eventbridge.UpdateConnectionOutput{
+		ConnectionArn: aws.String("arn/connection/" + aws.ToString(params.Name)),
+	}, nil
+}
+
+func (client mockEventbridgeClient) CreateApiDestination(ctx context.Context, params *eventbridge.CreateApiDestinationInput, optFns ...func(*eventbridge.Options)) (*eventbridge.CreateApiDestinationOutput, error) {
+	return &eventbridge.CreateApiDestinationOutput{
+		ApiDestinationArn: aws.String("arn/api-destination/" + aws.ToString(params.Name)),
+	}, nil
+}
+
+func (client mockEventbridgeClient) UpdateApiDestination(ctx context.Context, params *eventbridge.UpdateApiDestinationInput, optFns ...func(*eventbridge.Options)) (*eventbridge.UpdateApiDestinationOutput, error) {
+	return &eventbridge.UpdateApiDestinationOutput{
+		ApiDestinationArn: aws.String("arn/api-destination/" + aws.ToString(params.Name)),
+	}, nil
+}
+
+func TestCreateDebugRule(t *testing.T) {
+	t.Run("catch-all rule created", func(t *testing.T) {
+		output, err := CreateDebugRule(mockEventbridgeClient{}, "default")
+		assert.NoError(t, err)
+		assert.Equal(t, DebugRuleName, output)
+	})
+
+	t.Run("error creating debug rule", func(t *testing.T) {
+		_, err := CreateDebugRule(mockEventbridgeClient{PutRuleErr: fmt.Errorf("Error creating rule:")}, "eventbus")
+		assert.Error(t, err)
+	})
+}
+
+func TestAddLogGroupTarget(t *testing.T) {
+	logGroupArn := "arn:aws:logs:us-east-1:123456789012:log-group:/aws/events/debug-eventbus"
+	err := AddLogGroupTarget(mockEventbridgeClient{}, DebugRuleName, "eventbus", logGroupArn)
+	assert.NoError(t, err)
+
+	// A target rejected for a missing resource policy fails the call
+	rejected := mockEventbridgeClient{PutTargetsFailed: "AccessDeniedException"}
+	err = AddLogGroupTarget(rejected, DebugRuleName, "eventbus", logGroupArn)
+	assert.ErrorContains(t, err, "failed to add target "+DebugTargetID+" to rule "+DebugRuleName+": AccessDeniedException: target rejected")
+}
@@ -2,34 +2,50 @@ package helpers
  
 import (
     "context"
-    "fmt"
     "strings"
  
     "github.com/aws/aws-sdk-go-v2/aws"
     "github.com/aws/aws-sdk-go-v2/service/eventbridge"
+ 
+    "setup/helpers/progress"
 )
  
-func CreateRule(client eventbridgeClient, eventBusName string) (string, error) {
-    eventPattern := `{
+// ECRPushRuleName is the rule that routes ECR image scan events to the targets.
+const ECRPushRuleName = "Rule-ECRPushEvent"
+ 
+// ECRPushEventPattern is the event pattern of the ECR push rule.
+const ECRPushEventPattern = `{
         "source": ["aws.ecr"],
         "detail-type": ["ECR Image Scan"]
     }`
  
+func CreateRule(client eventbridgeClient, eventBusName string) (string, error) {
     input := &eventbridge.PutRuleInput{
-        Name:         aws.String("Rule-ECRPushEvent"),
-        EventPattern: aws.String(eventPattern),
+        Name:         aws.String(ECRPushRuleName),
+        EventPattern: aws.String(ECRPushEventPattern),
         EventBusName: aws.String(eventBusName),
     }
  
     result, err := client.PutRule(context.Background(), input)
     if err != nil {
-        fmt.Println("Error creating rule:", err)
+        progress.Println("Error creating rule:", err)
         return "", err
     }
     ruleName := strings.Split(aws.ToString(result.RuleArn), "/")[2]
  
-    fmt.Println("Rule created successfully. Rule ARN:", *result.RuleArn)
+    progress.Println("Rule created successfully. Rule ARN:", *result.RuleArn)
     return ruleName, nil
 }
-
-
+ 
+// RuleArn looks up the ARN of an existing rule on the bus.
+func RuleArn(client eventbridgeClient, ruleName, eventBusName string) (string, error) {
+    result, err := client.DescribeRule(context.Background(), &eventbridge.DescribeRuleInput{
+        Name:         aws.String(ruleName),
+        EventBusName: aws.String(eventBusName),
+    })
+    if err != nil {
+        progress.Println("Error describing rule:", err)
+        return "", err
+    }
+    return aws.ToString(result.Arn), nil
+}
@@ -4,31 +4,86 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"setup/helpers/progress"
 )
 
-func AddTarget(client eventbridgeClient, ruleName string, eventBusName string) error {
+// LambdaTargetID is the target ID of the deployed function on the ECR push rule.
+const LambdaTargetID = "Lambda"
+
+// FunctionTargetID is the target ID of a function deployed from a manifest besides the
+// primary one, on each rule its triggers name.
+func FunctionTargetID(functionName string) string {
+	return LambdaTargetID + "-" + functionName
+}
+
+// AddTarget attaches the deployed function to the rule. functionArn, usually the live alias ARN, comes from the
+// state file written by the lambda deployer.
+func AddTarget(client eventbridgeClient, ruleName string, eventBusName string, functionArn string) error {
+	return AddFunctionTarget(client, ruleName, eventBusName, LambdaTargetID, functionArn)
+}
+
+// AddFunctionTarget attaches a function to the rule under the given target ID.
+func AddFunctionTarget(client eventbridgeClient, ruleName, eventBusName, targetID, functionArn string) error {
 	target := types.Target{
-		Arn: aws.String("arn:aws:lambda:us-east-1:975050154225:function:MyGoLambdaFunction"),
-		Id:  aws.String("Lambda"),
+		Arn: aws.String(functionArn),
+		Id:  aws.String(targetID),
 	}
 
 	log.Println(ruleName)
 	// Add the target to the existing rule
-	_, err := client.PutTargets(context.Background(), &eventbridge.PutTargetsInput{
+	output, err := client.PutTargets(context.Background(), &eventbridge.PutTargetsInput{
 		Rule:         aws.String(ruleName),
 		Targets:      []types.Target{target},
 		EventBusName: aws.String(eventBusName),
 	})
+	if err == nil {
+		err = failedTarget(output, ruleName)
+	}
 
 	if err != nil {
-		fmt.Println("Error adding target to rule:", err.Error())
+		progress.Println("Error adding target to rule:", err.Error())
 		return err
 	}
 
-	fmt.Println("Target added to rule successfully")
+	progress.Println("Target added to rule successfully")
+	return nil
+}
+
+// failedTarget reports the first target PutTargets rejected. The call itself succeeds
+// when EventBridge rejects a target, e.g. for a role or ARN it cannot use.
+func failedTarget(output *eventbridge.PutTargetsOutput, ruleName string) error {
+	if output.FailedEntryCount == 0 {
+		return nil
+	}
+	if len(output.FailedEntries) == 0 {
+		return fmt.Errorf("failed to add %d targets to rule %s", output.FailedEntryCount, ruleName)
+	}
+	entry := output.FailedEntries[0]
+	return fmt.Errorf("failed to add target %s to rule %s: %s: %s", aws.ToString(entry.TargetId), ruleName, aws.ToString(entry.ErrorCode), aws.ToString(entry.ErrorMessage))
+}
+
+// RemoveTarget detaches a target from the rule, e.g. a destroyed function. A rule or
+// target that no longer exists is not an error.
+func RemoveTarget(client eventbridgeClient, ruleName, eventBusName, targetID string) error {
+	output, err := client.RemoveTargets(context.Background(), &eventbridge.RemoveTargetsInput{
+		Rule:         aws.String(ruleName),
+		EventBusName: aws.String(eventBusName),
+		Ids:          []string{targetID},
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "ResourceNotFoundException") {
+			return nil
+		}
+		return fmt.Errorf("failed to remove target %s from rule %s: %v", targetID, ruleName, err)
+	}
+	if output.FailedEntryCount > 0 {
+		return fmt.Errorf("failed to remove target %s from rule %s: %s", targetID, ruleName, aws.ToString(output.FailedEntries[0].ErrorMessage))
+	}
 	return nil
 }
@@ -0,0 +1,344 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EventBridge limits checked before any API call is made.
+const (
+	maxRuleNameLength     = 64
+	maxEventBusNameLength = 256
+	maxTargetIDLength     = 64
+	maxTargetsPerRule     = 5
+	maxEventPatternLength = 4096
+)
+
+var (
+	ruleNamePattern     = regexp.MustCompile(`^[\.\-_A-Za-z0-9]+$`)
+	eventBusNamePattern = regexp.MustCompile(`^[/\.\-_A-Za-z0-9]+$`)
+	eventBusArnPattern  = regexp.MustCompile(`^arn:aws[a-z\-]*:events:[a-z0-9\-]+:\d{12}:event-bus/([/\.\-_A-Za-z0-9]+)$`)
+	targetIDPattern     = regexp.MustCompile(`^[\.\-_A-Za-z0-9]+$`)
+	arnPattern          = regexp.MustCompile(`^arn:(aws|aws-cn|aws-us-gov):([a-z0-9\-]+):([a-z0-9\-]*):(\d{12})?:(.+)$`)
+)
+
+// orOperator combines alternative patterns, at the top level or within a field.
+const orOperator = "$or"
+
+// Top-level fields of the EventBridge event envelope. A pattern keyed on anything else
+// can never match.
+var envelopeFields = map[string]bool{
+	"version": true, "id": true, "detail-type": true, "source": true, "account": true,
+	"time": true, "region": true, "resources": true, "detail": true,
+}
+
+var contentFilters = map[string]bool{
+	"prefix": true, "suffix": true, "anything-but": true, "numeric": true, "exists": true,
+	"cidr": true, "equals-ignore-case": true, "wildcard": true,
+}
+
+// Services whose targets EventBridge can only reach by assuming a role. Lambda, SNS, SQS
+// and CloudWatch Logs targets use resource policies instead.
+var roleRequiredServices = map[string]bool{
+	"kinesis": true, "firehose": true, "states": true, "ecs": true, "codebuild": true,
+	"codepipeline": true, "ssm": true, "batch": true, "sagemaker": true, "redshift-data": true,
+}
+
+// TargetKind says what a target points at, which decides whether it needs a role.
+type TargetKind string
+
+const (
+	TargetLambda         TargetKind = "lambda"
+	TargetApiDestination TargetKind = "api-destination"
+	TargetLogGroup       TargetKind = "log-group"
+	TargetOther          TargetKind = "other"
+)
+
+// TargetConfig is a target setup is about to attach. Arn may be empty when the target
+// resource is itself created during setup; ARN checks are skipped in that case.
+type TargetConfig struct {
+	Id      string
+	Kind    TargetKind
+	Arn     string
+	RoleArn string
+	// Endpoint is the invocation endpoint of an API destination.
+	Endpoint string
+}
+
+// RuleConfig is a rule setup is about to create, with its targets.
+type RuleConfig struct {
+	Name         string
+	EventBusName string
+	EventPattern string
+	Targets      []TargetConfig
+}
+
+// Issue is a single validation finding. Errors would be rejected by EventBridge or
+// break delivery; warnings are configurations that are legal but almost certainly wrong.
+type Issue struct {
+	Rule     string
+	Severity string
+	Message  string
+}
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Rule, i.Message)
+}
+
+// HasErrors reports whether any issue is an error.
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRules checks every rule and its targets against EventBridge limits and lints
+// the event patterns.
+func ValidateRules(rules []RuleConfig) []Issue {
+	var issues []Issue
+	for _, rule := range rules {
+		issues = append(issues, ValidateRule(rule)...)
+	}
+	return issues
+}
+
+// ValidateRule checks a single rule and its targets.
+func ValidateRule(rule RuleConfig) []Issue {
+	v := &validator{rule: rule.Name}
+
+	if len(rule.Name) == 0 || len(rule.Name) > maxRuleNameLength || !ruleNamePattern.MatchString(rule.Name) {
+		v.errorf("rule name must be 1-%d characters of letters, digits, '.', '-' or '_'", maxRuleNameLength)
+	}
+	// EventBridge takes the bus by name or, for a bus in another account, by ARN
+	validBus := eventBusNamePattern.MatchString(rule.EventBusName) || eventBusArnPattern.MatchString(rule.EventBusName)
+	if len(rule.EventBusName) == 0 || len(rule.EventBusName) > maxEventBusNameLength || !validBus {
+		v.errorf("event bus %q must be a name of 1-%d letters, digits, '/', '.', '-' or '_', or an event bus ARN", rule.EventBusName, maxEventBusNameLength)
+	}
+
+	v.checkPattern(rule.EventPattern, rule.EventBusName)
+	v.checkTargets(rule.Targets)
+	return v.issues
+}
+
+type validator struct {
+	rule   string
+	issues []Issue
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	v.issues = append(v.issues, Issue{Rule: v.rule, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(format string, args ...interface{}) {
+	v.issues = append(v.issues, Issue{Rule: v.rule, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) checkPattern(pattern, eventBusName string) {
+	if len(pattern) > maxEventPatternLength {
+		v.errorf("event pattern is %d characters, the limit is %d", len(pattern), maxEventPatternLength)
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(pattern), &parsed); err != nil {
+		v.errorf("event pattern is not valid JSON: %v", err)
+		return
+	}
+	top, ok := parsed.(map[string]interface{})
+	if !ok || len(top) == 0 {
+		v.errorf("event pattern must be a non-empty JSON object")
+		return
+	}
+
+	v.checkEnvelope(top)
+	v.checkPatternObject(top, "")
+
+	// Events from AWS services are only delivered to the default bus. A rule for them on
+	// a custom bus only fires if another rule forwards the events there.
+	if match := eventBusArnPattern.FindStringSubmatch(eventBusName); match != nil {
+		eventBusName = match[1]
+	}
+	if eventBusName != "default" {
+		if sources, ok := top["source"].([]interface{}); ok && allAWSSources(sources) {
+			v.warnf("event pattern matches AWS service sources on custom bus %q; AWS services only publish to the default bus, so the rule never matches unless events are forwarded", eventBusName)
+		}
+	}
+}
+
+// checkEnvelope warns about top-level fields the event never has, including those of
+// each $or alternative.
+func (v *validator) checkEnvelope(top map[string]interface{}) {
+	for _, key := range sortedKeys(top) {
+		if key == orOperator {
+			alternatives, _ := top[key].([]interface{})
+			for _, alternative := range alternatives {
+				if object, ok := alternative.(map[string]interface{}); ok {
+					v.checkEnvelope(object)
+				}
+			}
+			continue
+		}
+		if !envelopeFields[key] {
+			v.warnf("event pattern matches on %q, which is not an event field, so the rule never matches", key)
+		}
+	}
+}
+
+func (v *validator) checkPatternObject(object map[string]interface{}, path string) {
+	for _, key := range sortedKeys(object) {
+		field := strings.TrimPrefix(path+"."+key, ".")
+		if key == orOperator {
+			v.checkOr(object[key], field)
+			continue
+		}
+		switch value := object[key].(type) {
+		case map[string]interface{}:
+			if len(value) == 0 {
+				v.errorf("event pattern field %q is an empty object", field)
+			}
+			v.checkPatternObject(value, field)
+		case []interface{}:
+			if len(value) == 0 {
+				v.errorf("event pattern field %q has an empty array and never matches", field)
+			}
+			for _, element := range value {
+				if filter, ok := element.(map[string]interface{}); ok {
+					v.checkContentFilter(filter, field)
+				}
+			}
+		default:
+			v.errorf("event pattern field %q must be an array of values, got %v", field, value)
+		}
+	}
+}
+
+// checkOr checks that $or is an array of at least two patterns, and each pattern.
+func (v *validator) checkOr(value interface{}, field string) {
+	alternatives, ok := value.([]interface{})
+	if !ok || len(alternatives) < 2 {
+		v.errorf("event pattern field %q must be an array of at least two patterns", field)
+		return
+	}
+	for _, alternative := range alternatives {
+		object, ok := alternative.(map[string]interface{})
+		if !ok || len(object) == 0 {
+			v.errorf("event pattern field %q must only hold non-empty objects", field)
+			continue
+		}
+		v.checkPatternObject(object, strings.TrimSuffix(field, orOperator))
+	}
+}
+
+func (v *validator) checkContentFilter(filter map[string]interface{}, field string) {
+	if len(filter) != 1 {
+		v.errorf("event pattern field %q: a content filter must have exactly one key", field)
+		return
+	}
+	for key := range filter {
+		if !contentFilters[key] {
+			v.errorf("event pattern field %q: unknown content filter %q", field, key)
+		}
+	}
+}
+
+func (v *validator) checkTargets(targets []TargetConfig) {
+	if len(targets) > maxTargetsPerRule {
+		v.errorf("rule has %d targets, the limit is %d", len(targets), maxTargetsPerRule)
+	}
+
+	seen := map[string]bool{}
+	for _, target := range targets {
+		if len(target.Id) == 0 || len(target.Id) > maxTargetIDLength || !targetIDPattern.MatchString(target.Id) {
+			v.errorf("target ID %q must be 1-%d characters of letters, digits, '.', '-' or '_'", target.Id, maxTargetIDLength)
+		}
+		if seen[target.Id] {
+			v.errorf("target ID %q is used twice", target.Id)
+		}
+		seen[target.Id] = true
+
+		service := ""
+		if target.Arn != "" {
+			match := arnPattern.FindStringSubmatch(target.Arn)
+			if match == nil {
+				v.errorf("target %s: %q is not a valid ARN", target.Id, target.Arn)
+			} else {
+				service = match[2]
+				v.checkTargetArn(target, service, match[5])
+			}
+		}
+
+		if target.Kind == TargetApiDestination && !strings.HasPrefix(target.Endpoint, "https://") {
+			v.errorf("target %s: API destination endpoint %q must use https", target.Id, target.Endpoint)
+		}
+		if targetNeedsRole(target, service) && target.RoleArn == "" {
+			v.errorf("target %s needs a role ARN for EventBridge to assume", target.Id)
+		}
+		if target.RoleArn != "" {
+			match := arnPattern.FindStringSubmatch(target.RoleArn)
+			if match == nil || match[2] != "iam" || !strings.HasPrefix(match[5], "role/") {
+				v.errorf("target %s: %q is not an IAM role ARN", target.Id, target.RoleArn)
+			}
+		}
+	}
+}
+
+func (v *validator) checkTargetArn(target TargetConfig, service, resource string) {
+	switch target.Kind {
+	case TargetLambda:
+		if service != "lambda" || !strings.HasPrefix(resource, "function:") {
+			v.errorf("target %s: %q is not a Lambda function ARN", target.Id, target.Arn)
+		}
+	case TargetApiDestination:
+		if service != "events" || !strings.HasPrefix(resource, "api-destination/") {
+			v.errorf("target %s: %q is not an API destination ARN", target.Id, target.Arn)
+		}
+	case TargetLogGroup:
+		if service != "logs" || !strings.HasPrefix(resource, "log-group:") {
+			v.errorf("target %s: %q is not a log group ARN", target.Id, target.Arn)
+		} else if !strings.HasPrefix(strings.TrimPrefix(resource, "log-group:"), "/aws/events/") {
+			v.errorf("target %s: EventBridge only delivers to log groups under /aws/events/", target.Id)
+		}
+	}
+}
+
+func targetNeedsRole(target TargetConfig, service string) bool {
+	switch target.Kind {
+	case TargetApiDestination:
+		return true
+	case TargetLambda, TargetLogGroup:
+		return false
+	}
+	return roleRequiredServices[service]
+}
+
+func allAWSSources(sources []interface{}) bool {
+	if len(sources) == 0 {
+		return false
+	}
+	for _, source := range sources {
+		s, ok := source.(string)
+		if !ok || !strings.HasPrefix(s, "aws.") {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
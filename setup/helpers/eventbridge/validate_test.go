@@ -0,0 +1,160 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validRule() RuleConfig {
+	return RuleConfig{
+		Name:         ECRPushRuleName,
+		EventBusName: "default",
+		EventPattern: ECRPushEventPattern,
+		Targets: []TargetConfig{{
+			Id:   LambdaTargetID,
+			Kind: TargetLambda,
+			Arn:  "arn:aws:lambda:us-east-1:123456789012:function:MyGoLambdaFunction",
+		}},
+	}
+}
+
+func messages(issues []Issue) string {
+	var lines []string
+	for _, issue := range issues {
+		lines = append(lines, issue.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestValidateRule(t *testing.T) {
+	t.Run("valid rule", func(t *testing.T) {
+		assert.Empty(t, ValidateRule(validRule()))
+	})
+
+	t.Run("catch-all debug rule", func(t *testing.T) {
+		rule := RuleConfig{
+			Name:         DebugRuleName,
+			EventBusName: "eventbus",
+			EventPattern: CatchAllEventPattern,
+			Targets: []TargetConfig{{
+				Id:   DebugTargetID,
+				Kind: TargetLogGroup,
+				Arn:  "arn:aws:logs:us-east-1:123456789012:log-group:" + DebugLogGroupName("eventbus"),
+			}},
+		}
+		assert.Empty(t, ValidateRule(rule))
+	})
+
+	t.Run("event bus by ARN", func(t *testing.T) {
+		rule := validRule()
+		rule.EventBusName = "arn:aws:events:us-east-1:210987654321:event-bus/default"
+		assert.Empty(t, ValidateRule(rule))
+
+		rule.EventBusName = "arn:aws:sqs:us-east-1:210987654321:queue"
+		assert.Contains(t, messages(ValidateRule(rule)), "or an event bus ARN")
+	})
+
+	t.Run("invalid rule name", func(t *testing.T) {
+		rule := validRule()
+		rule.Name = "Rule ECR Push"
+		issues := ValidateRule(rule)
+		assert.True(t, HasErrors(issues))
+		assert.Contains(t, messages(issues), "rule name")
+	})
+
+	t.Run("too many targets", func(t *testing.T) {
+		rule := validRule()
+		for _, id := range []string{"a", "b", "c", "d", "e"} {
+			rule.Targets = append(rule.Targets, TargetConfig{Id: id, Kind: TargetLambda, Arn: "arn:aws:lambda:us-east-1:123456789012:function:" + id})
+		}
+		assert.Contains(t, messages(ValidateRule(rule)), "the limit is 5")
+	})
+
+	t.Run("api destination without role", func(t *testing.T) {
+		rule := validRule()
+		rule.Targets = append(rule.Targets, TargetConfig{Id: ApiDestinationTargetID, Kind: TargetApiDestination, Endpoint: "http://deploy.internal/hooks/ecr"})
+		out := messages(ValidateRule(rule))
+		assert.Contains(t, out, "needs a role ARN")
+		assert.Contains(t, out, "must use https")
+	})
+
+	t.Run("kinesis target without role", func(t *testing.T) {
+		rule := validRule()
+		rule.Targets = []TargetConfig{{Id: "Stream", Kind: TargetOther, Arn: "arn:aws:kinesis:us-east-1:123456789012:stream/pushes"}}
+		assert.Contains(t, messages(ValidateRule(rule)), "needs a role ARN")
+	})
+
+	t.Run("malformed ARNs", func(t *testing.T) {
+		rule := validRule()
+		rule.Targets = []TargetConfig{
+			{Id: LambdaTargetID, Kind: TargetLambda, Arn: "MyGoLambdaFunction"},
+			{Id: ApiDestinationTargetID, Kind: TargetApiDestination, Endpoint: "https://deploy.internal/hooks/ecr", RoleArn: "arn:aws:iam::123456789012:user/deployer"},
+		}
+		out := messages(ValidateRule(rule))
+		assert.Contains(t, out, "is not a valid ARN")
+		assert.Contains(t, out, "is not an IAM role ARN")
+	})
+
+	t.Run("duplicate target IDs", func(t *testing.T) {
+		rule := validRule()
+		rule.Targets = append(rule.Targets, rule.Targets[0])
+		assert.Contains(t, messages(ValidateRule(rule)), "used twice")
+	})
+
+	t.Run("pattern syntax", func(t *testing.T) {
+		for pattern, want := range map[string]string{
+			`{"source": "aws.ecr"}`:               "must be an array",
+			`{"source": []}`:                      "empty array",
+			`{"source": [{"startswith": "aws"}]}`: "unknown content filter",
+			`{"source": ["aws.ecr"]`:              "not valid JSON",
+			`[]`:                                  "non-empty JSON object",
+			`{"$or": [{"source": ["aws.ecr"]}]}`:  "at least two patterns",
+			`{"$or": [{"source": "aws.ecr"}, {"detail-type": ["ECR Image Action"]}]}`: "must be an array",
+			`{"detail": {"$or": [{"result": []}, {"action-type": ["PUSH"]}]}}`:        "empty array",
+			`{"$or": [{"source": ["aws.ecr"]}, "aws.ecr"]}`:                           "only hold non-empty objects",
+		} {
+			rule := validRule()
+			rule.EventPattern = pattern
+			assert.Contains(t, messages(ValidateRule(rule)), want, pattern)
+		}
+	})
+
+	t.Run("pattern too large", func(t *testing.T) {
+		rule := validRule()
+		rule.EventPattern = `{"source": ["` + strings.Repeat("a", maxEventPatternLength) + `"]}`
+		assert.Contains(t, messages(ValidateRule(rule)), "the limit is 4096")
+	})
+}
+
+func TestLintNeverMatchingPatterns(t *testing.T) {
+	t.Run("aws source on custom bus", func(t *testing.T) {
+		rule := validRule()
+		rule.EventBusName = "eventbus"
+		issues := ValidateRule(rule)
+		assert.False(t, HasErrors(issues))
+		assert.Contains(t, messages(issues), "AWS services only publish to the default bus")
+	})
+
+	t.Run("unknown top-level field", func(t *testing.T) {
+		rule := validRule()
+		rule.EventPattern = `{"sources": ["aws.ecr"]}`
+		assert.Contains(t, messages(ValidateRule(rule)), "never matches")
+
+		rule.EventPattern = `{"$or": [{"source": ["aws.ecr"]}, {"sources": ["aws.ecr"]}]}`
+		assert.Contains(t, messages(ValidateRule(rule)), `matches on "sources"`)
+	})
+
+	t.Run("valid $or", func(t *testing.T) {
+		rule := validRule()
+		rule.EventPattern = `{"source": ["aws.ecr"], "$or": [{"detail-type": ["ECR Image Action"]}, {"detail": {"action-type": ["PUSH"]}}]}`
+		assert.Empty(t, ValidateRule(rule))
+	})
+
+	t.Run("aws source on custom bus by ARN", func(t *testing.T) {
+		rule := validRule()
+		rule.EventBusName = "arn:aws:events:us-east-1:123456789012:event-bus/eventbus"
+		assert.Contains(t, messages(ValidateRule(rule)), "AWS services only publish to the default bus")
+	})
+}
@@ -0,0 +1,343 @@
+// Package lock is a lease-based lock held in an SSM parameter, so two people deploying or
+// setting up the same function cannot interleave. The holder keeps the lease alive with
+// heartbeats; a lease whose holder stopped heartbeating expires after its TTL and can be
+// taken over, and break-lock removes one by hand.
+//
+// SSM has no conditional overwrite, so a heartbeat cannot extend the lease atomically. It
+// compares the parameter version it read with the one its write produced instead: any
+// other write in between, a break or a takeover, shows up as a gap and the lease is
+// treated as lost. The holder cancels its work through Context when that happens.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+
+	"setup/helpers/progress"
+)
+
+// ParameterPrefix is where the leases are kept, one parameter per locked name.
+const ParameterPrefix = "/lambda-deploy/locks/"
+
+// DefaultTTL is how long a lease lives without a heartbeat.
+const DefaultTTL = 2 * time.Minute
+
+// retryDelay is how often Acquire checks a held lock while waiting for it.
+var retryDelay = 5 * time.Second
+
+type ssmClient interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+	DeleteParameter(ctx context.Context, params *ssm.DeleteParameterInput, optFns ...func(*ssm.Options)) (*ssm.DeleteParameterOutput, error)
+}
+
+// Lease is the content of the lock parameter.
+type Lease struct {
+	// Owner is who holds the lock, e.g. the caller's ARN; Host and PID tell which run.
+	Owner     string    `json:"owner"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Operation string    `json:"operation"`
+	Acquired  time.Time `json:"acquired"`
+	Expires   time.Time `json:"expires"`
+	// Token tells this lease apart from a later one taken by the same owner.
+	Token string `json:"token"`
+}
+
+// Expired reports whether the holder stopped heartbeating before now.
+func (l Lease) Expired(now time.Time) bool {
+	return !now.Before(l.Expires)
+}
+
+func (l Lease) String() string {
+	return fmt.Sprintf("%s on %s (pid %d) for %s since %s, expires %s", l.Owner, l.Host, l.PID, l.Operation,
+		l.Acquired.Local().Format(time.RFC3339), l.Expires.Local().Format(time.RFC3339))
+}
+
+// HeldError is returned when someone else holds an unexpired lease.
+type HeldError struct {
+	Name  string
+	Lease Lease
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("%s is locked by %s; run break-lock %s if that run is gone", e.Name, e.Lease, e.Name)
+}
+
+// Options describe the lease Acquire takes.
+type Options struct {
+	Owner     string
+	Operation string
+	TTL       time.Duration
+	// Wait is how long to wait for a held lock before giving up; zero fails at once.
+	Wait time.Duration
+}
+
+// Lock is a held lease. A heartbeat extends it every third of the TTL until Release.
+type Lock struct {
+	client ssmClient
+	name   string
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	lease Lease
+	lost  error
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// ParameterName is the SSM parameter holding the lease of name.
+func ParameterName(name string) string {
+	return ParameterPrefix + name
+}
+
+// DefaultOwner names the local user, for callers without an identity of their own.
+func DefaultOwner() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// Acquire takes the lock of name. A lease that expired is taken over; an unexpired one is
+// waited for up to opts.Wait, then reported as a *HeldError.
+func Acquire(client ssmClient, name string, opts Options) (*Lock, error) {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	host, _ := os.Hostname()
+	b := make([]byte, 8)
+	rand.Read(b)
+	lease := Lease{
+		Owner:     opts.Owner,
+		Host:      host,
+		PID:       os.Getpid(),
+		Operation: opts.Operation,
+		Token:     hex.EncodeToString(b),
+	}
+
+	deadline := time.Now().Add(opts.Wait)
+	for {
+		now := time.Now()
+		lease.Acquired, lease.Expires = now, now.Add(opts.TTL)
+		_, created, err := put(client, name, lease, false)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			l := &Lock{client: client, name: name, ttl: opts.TTL, lease: lease, stop: make(chan struct{}), done: make(chan struct{})}
+			l.ctx, l.cancel = context.WithCancelCause(context.Background())
+			go l.heartbeat()
+			return l, nil
+		}
+
+		// Someone holds it: take it over once expired, otherwise wait
+		current, err := Current(client, name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case current == nil:
+			// Released between the two calls
+			continue
+		case current.Expired(now):
+			progress.Printf("Taking over the expired lock of %s from %s\n", name, current)
+			if err := remove(client, name, current.Token); err != nil {
+				return nil, err
+			}
+			continue
+		case time.Now().Add(retryDelay).After(deadline):
+			return nil, &HeldError{Name: name, Lease: *current}
+		}
+		progress.Printf("Waiting for the lock of %s, held by %s\n", name, current)
+		time.Sleep(retryDelay)
+	}
+}
+
+// Current returns the lease of name, or nil when it is not locked.
+func Current(client ssmClient, name string) (*Lease, error) {
+	lease, _, err := read(client, name)
+	return lease, err
+}
+
+// read returns the lease of name and the version of its parameter.
+func read(client ssmClient, name string) (*Lease, int64, error) {
+	out, err := client.GetParameter(context.Background(), &ssm.GetParameterInput{
+		Name: aws.String(ParameterName(name)),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "ParameterNotFound") {
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("failed to read lock %s: %v", name, err)
+	}
+	var lease Lease
+	if err := json.Unmarshal([]byte(aws.ToString(out.Parameter.Value)), &lease); err != nil {
+		return nil, 0, fmt.Errorf("lock %s holds an unreadable lease: %v", name, err)
+	}
+	return &lease, out.Parameter.Version, nil
+}
+
+// Break removes the lease of name whoever holds it, and returns it; nil means it was not
+// locked.
+func Break(client ssmClient, name string) (*Lease, error) {
+	current, err := Current(client, name)
+	if err != nil || current == nil {
+		return nil, err
+	}
+	if err := remove(client, name, current.Token); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// Release stops the heartbeat and removes the lease. It reports whether the lease was
+// lost while held, e.g. broken or taken over after a missed heartbeat.
+func (l *Lock) Release() error {
+	close(l.stop)
+	<-l.done
+	l.cancel(fmt.Errorf("lock %s was released", l.name))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lost != nil {
+		return l.lost
+	}
+	current, err := Current(l.client, l.name)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Token != l.lease.Token {
+		return fmt.Errorf("lock %s was broken while held", l.name)
+	}
+	return remove(l.client, l.name, l.lease.Token)
+}
+
+// Lost reports why the lease was lost, or nil while it is held.
+func (l *Lock) Lost() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+// Context is cancelled once the lease is lost, with the reason as its cause, so the work
+// done under the lock can stop before its next change. Release cancels it too.
+func (l *Lock) Context() context.Context {
+	return l.ctx
+}
+
+// heartbeat extends the lease until Release, and stops when it finds the lease gone.
+func (l *Lock) heartbeat() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		l.mu.Lock()
+		err := l.extend()
+		if err != nil {
+			l.lost = err
+		}
+		l.mu.Unlock()
+		if err != nil {
+			progress.Printf("Lost the lock of %s: %v\n", l.name, err)
+			l.cancel(err)
+			return
+		}
+	}
+}
+
+// extend checks the lease is still ours and moves its expiry a TTL ahead. The write
+// must bump the version read by exactly one; otherwise another run wrote the lock
+// in between, and whichever lease is in it now, neither run may trust it.
+func (l *Lock) extend() error {
+	current, version, err := read(l.client, l.name)
+	if err != nil {
+		// A failed read is retried at the next heartbeat, while the lease is still valid
+		if time.Now().Before(l.lease.Expires) {
+			progress.Printf("Heartbeat of lock %s failed: %v\n", l.name, err)
+			return nil
+		}
+		return err
+	}
+	if current == nil || current.Token != l.lease.Token {
+		holder := "nobody"
+		if current != nil {
+			holder = current.String()
+		}
+		return fmt.Errorf("lock %s was broken and is now held by %s", l.name, holder)
+	}
+	l.lease.Expires = time.Now().Add(l.ttl)
+	written, _, err := put(l.client, l.name, l.lease, true)
+	if err != nil {
+		return err
+	}
+	if written != version+1 {
+		// Our write may have replaced a newer lease; remove it so nobody runs on it
+		if err := remove(l.client, l.name, l.lease.Token); err != nil {
+			progress.Printf("Warning: %v\n", err)
+		}
+		return fmt.Errorf("lock %s was written by another run during the heartbeat (version %d, then %d)", l.name, version, written)
+	}
+	return nil
+}
+
+// put writes the lease and returns the parameter version it produced. It reports false
+// when overwrite is off and the lock is held.
+func put(client ssmClient, name string, lease Lease, overwrite bool) (int64, bool, error) {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to marshal lease: %v", err)
+	}
+	out, err := client.PutParameter(context.Background(), &ssm.PutParameterInput{
+		Name:        aws.String(ParameterName(name)),
+		Value:       aws.String(string(data)),
+		Type:        types.ParameterTypeString,
+		Overwrite:   aws.Bool(overwrite),
+		Description: aws.String("Deploy lock lease, see break-lock"),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "ParameterAlreadyExists") {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to write lock %s: %v", name, err)
+	}
+	return out.Version, true, nil
+}
+
+// remove deletes the lease with the given token. SSM has no conditional delete, so the
+// lease is read again first to narrow the window in which a newer lease could be removed.
+func remove(client ssmClient, name, token string) error {
+	current, err := Current(client, name)
+	if err != nil || current == nil || current.Token != token {
+		return err
+	}
+	_, err = client.DeleteParameter(context.Background(), &ssm.DeleteParameterInput{
+		Name: aws.String(ParameterName(name)),
+	})
+	if err != nil && !strings.Contains(err.Error(), "ParameterNotFound") {
+		return fmt.Errorf("failed to remove lock %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireAndRelease(t *testing.T) {
+	client := newMockSSMClient()
+	l, err := Acquire(client, "myfunction", Options{Owner: "alice", Operation: "deploy"})
+	assert.NoError(t, err)
+
+	lease, err := Current(client, "myfunction")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", lease.Owner)
+	assert.Equal(t, "deploy", lease.Operation)
+	assert.Equal(t, DefaultTTL, lease.Expires.Sub(lease.Acquired))
+
+	assert.NoError(t, l.Release())
+	lease, err = Current(client, "myfunction")
+	assert.NoError(t, err)
+	assert.Nil(t, lease)
+}
+
+func TestAcquireHeld(t *testing.T) {
+	client := newMockSSMClient()
+	l, err := Acquire(client, "myfunction", Options{Owner: "alice", Operation: "deploy"})
+	assert.NoError(t, err)
+	defer l.Release()
+
+	_, err = Acquire(client, "myfunction", Options{Owner: "bob", Operation: "setup"})
+	var held *HeldError
+	assert.True(t, errors.As(err, &held))
+	assert.Equal(t, "alice", held.Lease.Owner)
+	assert.Contains(t, err.Error(), "break-lock myfunction")
+
+	// Other names are not affected
+	other, err := Acquire(client, "otherfunction", Options{Owner: "bob"})
+	assert.NoError(t, err)
+	assert.NoError(t, other.Release())
+}
+
+func TestAcquireWaits(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = 10 * time.Millisecond
+
+	client := newMockSSMClient()
+	l, err := Acquire(client, "myfunction", Options{Owner: "alice"})
+	assert.NoError(t, err)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		l.Release()
+	}()
+
+	next, err := Acquire(client, "myfunction", Options{Owner: "bob", Wait: time.Second})
+	assert.NoError(t, err)
+	assert.NoError(t, next.Release())
+}
+
+func TestAcquireTakesOverExpired(t *testing.T) {
+	client := newMockSSMClient()
+	client.setLease("myfunction", Lease{Owner: "alice", Token: "stale", Expires: time.Now().Add(-time.Minute)})
+
+	l, err := Acquire(client, "myfunction", Options{Owner: "bob"})
+	assert.NoError(t, err)
+	lease, _ := Current(client, "myfunction")
+	assert.Equal(t, "bob", lease.Owner)
+	assert.NoError(t, l.Release())
+}
+
+func TestHeartbeat(t *testing.T) {
+	client := newMockSSMClient()
+	l, err := Acquire(client, "myfunction", Options{Owner: "alice", TTL: 60 * time.Millisecond})
+	assert.NoError(t, err)
+	first, _ := Current(client, "myfunction")
+
+	time.Sleep(100 * time.Millisecond)
+	extended, _ := Current(client, "myfunction")
+	assert.True(t, extended.Expires.After(first.Expires))
+	assert.False(t, extended.Expired(time.Now()))
+	assert.NoError(t, l.Lost())
+
+	// A broken lease is noticed at the next heartbeat and reported by Release
+	broken, err := Break(client, "myfunction")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", broken.Owner)
+	time.Sleep(50 * time.Millisecond)
+	assert.Error(t, l.Lost())
+	assert.ErrorIs(t, context.Cause(l.Context()), l.Lost())
+	assert.Error(t, l.Release())
+}
+
+func TestHeartbeatRace(t *testing.T) {
+	client := newMockSSMClient()
+	l, err := Acquire(client, "myfunction", Options{Owner: "alice", TTL: 60 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.NoError(t, l.Context().Err())
+
+	// Another run writes the lock between the heartbeat's read and its write
+	client.mu.Lock()
+	client.beforePut = func(name string) {
+		client.versions[name]++
+		client.beforePut = nil
+	}
+	client.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.ErrorContains(t, l.Lost(), "written by another run")
+	assert.Error(t, l.Context().Err())
+	assert.ErrorIs(t, context.Cause(l.Context()), l.Lost())
+	assert.Error(t, l.Release())
+}
+
+func TestBreak(t *testing.T) {
+	t.Run("not locked", func(t *testing.T) {
+		lease, err := Break(newMockSSMClient(), "myfunction")
+		assert.NoError(t, err)
+		assert.Nil(t, lease)
+	})
+
+	t.Run("error reading lock", func(t *testing.T) {
+		client := newMockSSMClient()
+		client.GetParameterErr = fmt.Errorf("AccessDeniedException")
+		_, err := Break(client, "myfunction")
+		assert.Error(t, err)
+	})
+}
+
+type mockSSMClient struct {
+	GetParameterErr error
+
+	mu         sync.Mutex
+	parameters map[string]string
+	versions   map[string]int64
+	// beforePut runs inside PutParameter before the write, to interleave another run
+	beforePut func(name string)
+}
+
+func newMockSSMClient() *mockSSMClient {
+	return &mockSSMClient{parameters: map[string]string{}, versions: map[string]int64{}}
+}
+
+func (client *mockSSMClient) setLease(name string, lease Lease) {
+	data, _ := json.Marshal(lease)
+	client.parameters[ParameterName(name)] = string(data)
+	client.versions[ParameterName(name)]++
+}
+
+func (client *mockSSMClient) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.GetParameterErr != nil {
+		return nil, client.GetParameterErr
+	}
+	value, ok := client.parameters[*params.Name]
+	if !ok {
+		return nil, &types.ParameterNotFound{}
+	}
+	return &ssm.GetParameterOutput{Parameter: &types.Parameter{Name: params.Name, Value: aws.String(value), Version: client.versions[*params.Name]}}, nil
+}
+
+func (client *mockSSMClient) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if _, ok := client.parameters[*params.Name]; ok && !aws.ToBool(params.Overwrite) {
+		return nil, &types.ParameterAlreadyExists{}
+	}
+	if client.beforePut != nil {
+		client.beforePut(*params.Name)
+	}
+	client.parameters[*params.Name] = *params.Value
+	client.versions[*params.Name]++
+	return &ssm.PutParameterOutput{Version: client.versions[*params.Name]}, nil
+}
+
+func (client *mockSSMClient) DeleteParameter(ctx context.Context, params *ssm.DeleteParameterInput, optFns ...func(*ssm.Options)) (*ssm.DeleteParameterOutput, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if _, ok := client.parameters[*params.Name]; !ok {
+		return nil, &types.ParameterNotFound{}
+	}
+	delete(client.parameters, *params.Name)
+	delete(client.versions, *params.Name)
+	return &ssm.DeleteParameterOutput{}, nil
+}
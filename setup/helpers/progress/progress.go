@@ -0,0 +1,22 @@
+// Package progress is where the tools report what they are doing. It is stdout unless
+// the caller points Out elsewhere, e.g. at stderr when stdout carries a JSON result.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Out receives the progress messages, and the output of the processes the tools run.
+var Out io.Writer = os.Stdout
+
+// Printf writes a formatted progress message to Out.
+func Printf(format string, args ...interface{}) {
+	fmt.Fprintf(Out, format, args...)
+}
+
+// Println writes a progress message to Out.
+func Println(args ...interface{}) {
+	fmt.Fprintln(Out, args...)
+}
@@ -0,0 +1,395 @@
+// Package provision creates the event bus, the ECR push rule and its targets, the deploy
+// webhook and the debug rule, and records them in the state file. The lambda CLI's
+// setup command runs it.
+package provision
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	logshelpers "setup/helpers/cloudwatchlogs"
+	helpers "setup/helpers/eventbridge"
+	"setup/helpers/lock"
+	"setup/helpers/progress"
+	"setup/helpers/state"
+)
+
+// Options select what setup creates besides the bus and the ECR push rule.
+type Options struct {
+	StatePath string
+	// WebhookURL, when set, posts ECR push events to the deploy webhook; the
+	// credentials of WebhookAuth are read from WEBHOOK_* environment variables.
+	WebhookURL       string
+	WebhookAuth      string
+	WebhookRoleArn   string
+	WebhookRateLimit int32
+	// DebugRule logs every event on DebugBus to CloudWatch Logs.
+	DebugRule          bool
+	DebugBus           string
+	DebugRetentionDays int32
+	// Lock is the lease taken on LockName while setup runs, unless SkipLock is set.
+	Lock     lock.Options
+	SkipLock bool
+}
+
+// LockName is the lock setup takes: the function its rule targets, so a deploy of that
+// function cannot run at the same time, or "setup" before any deploy.
+func LockName(current *state.State) string {
+	if current.Lambda != nil && current.Lambda.FunctionName != "" {
+		return current.Lambda.FunctionName
+	}
+	return "setup"
+}
+
+// Plan describes the rules and targets a run creates, for validation.
+func Plan(current *state.State, opts Options) []helpers.RuleConfig {
+	ecrRule := helpers.RuleConfig{
+		Name:         helpers.ECRPushRuleName,
+		EventBusName: helpers.EventBusName,
+		EventPattern: helpers.ECRPushEventPattern,
+	}
+	if current.Lambda.InvokeArn() != "" {
+		ecrRule.Targets = append(ecrRule.Targets, helpers.TargetConfig{
+			Id:   helpers.LambdaTargetID,
+			Kind: helpers.TargetLambda,
+			Arn:  current.Lambda.InvokeArn(),
+		})
+	}
+	ecrRule.Targets = append(ecrRule.Targets, triggeredTargets(current, ecrRule.Name)...)
+	if opts.WebhookURL != "" {
+		ecrRule.Targets = append(ecrRule.Targets, helpers.TargetConfig{
+			Id:       helpers.ApiDestinationTargetID,
+			Kind:     helpers.TargetApiDestination,
+			RoleArn:  opts.WebhookRoleArn,
+			Endpoint: opts.WebhookURL,
+		})
+	}
+
+	plan := []helpers.RuleConfig{ecrRule}
+	if opts.DebugRule {
+		plan = append(plan, helpers.RuleConfig{
+			Name:         helpers.DebugRuleName,
+			EventBusName: opts.DebugBus,
+			EventPattern: helpers.CatchAllEventPattern,
+			Targets:      append([]helpers.TargetConfig{{Id: helpers.DebugTargetID, Kind: helpers.TargetLogGroup}}, triggeredTargets(current, helpers.DebugRuleName)...),
+		})
+	}
+	return plan
+}
+
+// Triggered returns the recorded functions besides the primary one whose triggers name
+// the rule, by function name.
+func Triggered(current *state.State, ruleName string) []*state.LambdaState {
+	var functions []*state.LambdaState
+	for _, f := range current.Functions {
+		for _, trigger := range f.Triggers {
+			if trigger == ruleName && f.InvokeArn() != "" {
+				functions = append(functions, f)
+				break
+			}
+		}
+	}
+	sort.Slice(functions, func(i, j int) bool { return functions[i].FunctionName < functions[j].FunctionName })
+	return functions
+}
+
+func triggeredTargets(current *state.State, ruleName string) []helpers.TargetConfig {
+	var targets []helpers.TargetConfig
+	for _, f := range Triggered(current, ruleName) {
+		targets = append(targets, helpers.TargetConfig{
+			Id:   helpers.FunctionTargetID(f.FunctionName),
+			Kind: helpers.TargetLambda,
+			Arn:  f.InvokeArn(),
+		})
+	}
+	return targets
+}
+
+// Validate checks the plan against EventBridge limits and prints every issue. It
+// fails when any issue is an error.
+func Validate(current *state.State, opts Options) error {
+	issues := helpers.ValidateRules(Plan(current, opts))
+	for _, issue := range issues {
+		progress.Println(issue)
+	}
+	if helpers.HasErrors(issues) {
+		return fmt.Errorf("EventBridge configuration is invalid")
+	}
+	return nil
+}
+
+// Run takes the lock, validates the plan, creates everything in it and records the bus,
+// rules and targets in the state file. Nothing is changed when validation fails.
+func Run(cfg aws.Config, opts Options) (*state.EventBridgeState, error) {
+	// Read what the lambda deployer recorded, so the rule can target the deployed function
+	current, err := state.Load(opts.StatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %v", err)
+	}
+
+	// Cancelled when the lease is lost, so setup does not record what another run changed
+	ctx := context.Background()
+	if !opts.SkipLock {
+		name := LockName(current)
+		held, err := acquireLock(cfg, name, opts.Lock)
+		if err != nil {
+			return nil, err
+		}
+		ctx = held.Context()
+		defer func() {
+			if err := held.Release(); err != nil {
+				progress.Printf("Warning: %v\n", err)
+			}
+		}()
+
+		// A deploy holding the lock may have changed the state while we waited for it
+		if current, err = state.Load(opts.StatePath); err != nil {
+			return nil, fmt.Errorf("failed to load state: %v", err)
+		}
+		if LockName(current) != name {
+			return nil, fmt.Errorf("%s was deployed while setup waited for the lock of %s; nothing was changed, run setup again", LockName(current), name)
+		}
+	}
+
+	if err := Validate(current, opts); err != nil {
+		return nil, fmt.Errorf("%v, nothing was changed", err)
+	}
+
+	eventBridgeClient := eventbridge.NewFromConfig(cfg)
+
+	eventBusName, err := helpers.CreateOrUpdateEventBus(eventBridgeClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event bus: %v", err)
+	}
+
+	eventBusArn, err := helpers.EventBusArn(eventBridgeClient, eventBusName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe event bus: %v", err)
+	}
+
+	ruleName, err := helpers.CreateRule(eventBridgeClient, eventBusName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rule: %v", err)
+	}
+
+	ruleArn, err := helpers.RuleArn(eventBridgeClient, ruleName, eventBusName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe rule: %v", err)
+	}
+
+	log.Println(ruleName)
+	time.Sleep(5 * time.Second)
+
+	ecrRule := state.RuleState{Name: ruleName, Arn: ruleArn, EventBusName: eventBusName}
+	if current.Lambda.InvokeArn() == "" {
+		progress.Printf("No deployed function recorded in %s; skipping the Lambda target. Run the lambda deployer, then setup again.\n", opts.StatePath)
+	} else {
+		if err := helpers.AddTarget(eventBridgeClient, ruleName, eventBusName, current.Lambda.InvokeArn()); err != nil {
+			return nil, fmt.Errorf("failed to add target: %v", err)
+		}
+		ecrRule.TargetIDs = append(ecrRule.TargetIDs, helpers.LambdaTargetID)
+	}
+	if err := addTriggeredTargets(eventBridgeClient, current, &ecrRule); err != nil {
+		return nil, err
+	}
+
+	if opts.WebhookURL != "" {
+		if err := setupWebhook(eventBridgeClient, ruleName, eventBusName, opts); err != nil {
+			return nil, fmt.Errorf("failed to set up deploy webhook: %v", err)
+		}
+		ecrRule.TargetIDs = append(ecrRule.TargetIDs, helpers.ApiDestinationTargetID)
+	}
+
+	rules := []state.RuleState{ecrRule}
+	if opts.DebugRule {
+		debug, err := setupDebugRule(eventBridgeClient, cloudwatchlogs.NewFromConfig(cfg), opts.DebugBus, opts.DebugRetentionDays)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up debug rule: %v", err)
+		}
+		if err := addTriggeredTargets(eventBridgeClient, current, &debug); err != nil {
+			return nil, err
+		}
+		rules = append(rules, debug)
+	}
+	warnUnmanagedTriggers(current, rules)
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("not recording the rules in the state file: %v", context.Cause(ctx))
+	}
+
+	// Record the bus, rules and targets for the lambda deployer and later runs
+	recorded := &state.EventBridgeState{
+		EventBusName: eventBusName,
+		EventBusArn:  eventBusArn,
+		Rules:        rules,
+	}
+	err = state.Update(opts.StatePath, func(s *state.State) {
+		s.EventBridge = recorded
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write state: %v", err)
+	}
+	return recorded, nil
+}
+
+// addTriggeredTargets points the rule at each function whose triggers name it, and
+// removes the targets of functions that no longer name it.
+func addTriggeredTargets(client *eventbridge.Client, current *state.State, rule *state.RuleState) error {
+	keep := map[string]bool{}
+	for _, f := range Triggered(current, rule.Name) {
+		id := helpers.FunctionTargetID(f.FunctionName)
+		if err := helpers.AddFunctionTarget(client, rule.Name, rule.EventBusName, id, f.InvokeArn()); err != nil {
+			return fmt.Errorf("failed to add target of %s: %v", f.FunctionName, err)
+		}
+		rule.TargetIDs = append(rule.TargetIDs, id)
+		keep[id] = true
+	}
+
+	previous := current.EventBridge.Rule(rule.Name)
+	if previous == nil {
+		return nil
+	}
+	for _, id := range previous.TargetIDs {
+		if strings.HasPrefix(id, helpers.FunctionTargetID("")) && !keep[id] {
+			if err := helpers.RemoveTarget(client, rule.Name, rule.EventBusName, id); err != nil {
+				return err
+			}
+			progress.Printf("Removed target %s from rule %s, no function names it as a trigger anymore\n", id, rule.Name)
+		}
+	}
+	return nil
+}
+
+// warnUnmanagedTriggers lists the triggers naming rules setup does not create; their
+// targets are left to whoever manages those rules.
+func warnUnmanagedTriggers(current *state.State, rules []state.RuleState) {
+	managed := map[string]bool{}
+	for _, rule := range rules {
+		managed[rule.Name] = true
+	}
+	names := make([]string, 0, len(current.Functions))
+	for name := range current.Functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, trigger := range current.Functions[name].Triggers {
+			if !managed[trigger] {
+				progress.Printf("Warning: %s names trigger %s, which setup does not create; its target is not added\n", name, trigger)
+			}
+		}
+	}
+}
+
+// acquireLock takes the setup lock, naming the local user when no owner is given.
+func acquireLock(cfg aws.Config, name string, opts lock.Options) (*lock.Lock, error) {
+	if opts.Owner == "" {
+		opts.Owner = lock.DefaultOwner()
+	}
+	if opts.Operation == "" {
+		opts.Operation = "setup"
+	}
+	held, err := lock.Acquire(ssm.NewFromConfig(cfg), name, opts)
+	if err != nil {
+		return nil, fmt.Errorf("nothing was changed: %v", err)
+	}
+	return held, nil
+}
+
+// setupWebhook creates the connection and API destination for the deploy webhook and
+// attaches the destination to the rule.
+func setupWebhook(client *eventbridge.Client, ruleName, eventBusName string, opts Options) error {
+	auth, err := WebhookAuthFromEnv(opts.WebhookAuth)
+	if err != nil {
+		return err
+	}
+
+	connectionArn, err := helpers.CreateOrUpdateConnection(client, "deploy-webhook", auth)
+	if err != nil {
+		return err
+	}
+
+	destinationArn, err := helpers.CreateOrUpdateApiDestination(client, helpers.ApiDestination{
+		Name:               "deploy-webhook",
+		ConnectionArn:      connectionArn,
+		Endpoint:           opts.WebhookURL,
+		RateLimitPerSecond: opts.WebhookRateLimit,
+	})
+	if err != nil {
+		return err
+	}
+
+	return helpers.AddApiDestinationTarget(client, ruleName, eventBusName, destinationArn, opts.WebhookRoleArn)
+}
+
+// setupDebugRule creates the debug log group and its resource policy, then points a
+// catch-all rule on the bus at it.
+func setupDebugRule(client *eventbridge.Client, logsClient *cloudwatchlogs.Client, eventBusName string, retentionDays int32) (state.RuleState, error) {
+	logGroupArn, err := logshelpers.CreateLogGroup(logsClient, helpers.DebugLogGroupName(eventBusName), retentionDays)
+	if err != nil {
+		return state.RuleState{}, err
+	}
+
+	if err := logshelpers.PutEventsResourcePolicy(logsClient, "EventBridgeDebugLogs-"+eventBusName, logGroupArn); err != nil {
+		return state.RuleState{}, err
+	}
+
+	ruleName, err := helpers.CreateDebugRule(client, eventBusName)
+	if err != nil {
+		return state.RuleState{}, err
+	}
+
+	ruleArn, err := helpers.RuleArn(client, ruleName, eventBusName)
+	if err != nil {
+		return state.RuleState{}, err
+	}
+
+	if err := helpers.AddLogGroupTarget(client, ruleName, eventBusName, logGroupArn); err != nil {
+		return state.RuleState{}, err
+	}
+
+	return state.RuleState{
+		Name:         ruleName,
+		Arn:          ruleArn,
+		EventBusName: eventBusName,
+		TargetIDs:    []string{helpers.DebugTargetID},
+	}, nil
+}
+
+// WebhookAuthFromEnv reads the webhook credentials from the environment so secrets never
+// appear on the command line.
+func WebhookAuthFromEnv(authType string) (helpers.ConnectionAuth, error) {
+	switch authType {
+	case "basic":
+		return helpers.ConnectionAuth{
+			Type:     types.ConnectionAuthorizationTypeBasic,
+			Username: os.Getenv("WEBHOOK_USERNAME"),
+			Password: os.Getenv("WEBHOOK_PASSWORD"),
+		}, nil
+	case "api-key":
+		return helpers.ConnectionAuth{
+			Type:        types.ConnectionAuthorizationTypeApiKey,
+			APIKeyName:  os.Getenv("WEBHOOK_API_KEY_NAME"),
+			APIKeyValue: os.Getenv("WEBHOOK_API_KEY_VALUE"),
+		}, nil
+	case "oauth":
+		return helpers.ConnectionAuth{
+			Type:              types.ConnectionAuthorizationTypeOauthClientCredentials,
+			OAuthClientID:     os.Getenv("WEBHOOK_OAUTH_CLIENT_ID"),
+			OAuthClientSecret: os.Getenv("WEBHOOK_OAUTH_CLIENT_SECRET"),
+			OAuthEndpoint:     os.Getenv("WEBHOOK_OAUTH_ENDPOINT"),
+		}, nil
+	}
+	return helpers.ConnectionAuth{}, fmt.Errorf("unknown webhook auth type %q", authType)
+}
@@ -0,0 +1,56 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/stretchr/testify/assert"
+
+	helpers "setup/helpers/eventbridge"
+	"setup/helpers/state"
+)
+
+func TestPlan(t *testing.T) {
+	current := &state.State{Lambda: &state.LambdaState{
+		FunctionArn: "arn:aws:lambda:us-east-1:123456789012:function:MyGoLambdaFunction",
+		AliasArn:    "arn:aws:lambda:us-east-1:123456789012:function:MyGoLambdaFunction:live",
+	}}
+
+	plan := Plan(current, Options{})
+	assert.Len(t, plan, 1)
+	assert.Equal(t, helpers.ECRPushRuleName, plan[0].Name)
+	assert.Equal(t, current.Lambda.AliasArn, plan[0].Targets[0].Arn)
+
+	// Other functions are targeted from the rules their triggers name
+	current.Functions = map[string]*state.LambdaState{
+		"scanner": {FunctionName: "scanner", AliasArn: "arn:aws:lambda:us-east-1:123456789012:function:scanner:live", Triggers: []string{helpers.ECRPushRuleName}},
+		"auditor": {FunctionName: "auditor", AliasArn: "arn:aws:lambda:us-east-1:123456789012:function:auditor:live", Triggers: []string{"Rule-Other"}},
+	}
+	plan = Plan(current, Options{})
+	assert.Len(t, plan[0].Targets, 2)
+	assert.Equal(t, "Lambda-scanner", plan[0].Targets[1].Id)
+	assert.Equal(t, current.Functions["scanner"].AliasArn, plan[0].Targets[1].Arn)
+
+	plan = Plan(&state.State{}, Options{WebhookURL: "https://deploy.internal/hooks/ecr", DebugRule: true, DebugBus: "default"})
+	assert.Len(t, plan, 2)
+	assert.Equal(t, helpers.ApiDestinationTargetID, plan[0].Targets[0].Id)
+	assert.Equal(t, "default", plan[1].EventBusName)
+}
+
+func TestLockName(t *testing.T) {
+	assert.Equal(t, "setup", LockName(&state.State{}))
+	assert.Equal(t, "MyGoLambdaFunction", LockName(&state.State{Lambda: &state.LambdaState{FunctionName: "MyGoLambdaFunction"}}))
+}
+
+func TestWebhookAuthFromEnv(t *testing.T) {
+	t.Setenv("WEBHOOK_API_KEY_NAME", "X-Deploy-Token")
+	t.Setenv("WEBHOOK_API_KEY_VALUE", "secret")
+
+	auth, err := WebhookAuthFromEnv("api-key")
+	assert.NoError(t, err)
+	assert.Equal(t, types.ConnectionAuthorizationTypeApiKey, auth.Type)
+	assert.Equal(t, "X-Deploy-Token", auth.APIKeyName)
+
+	_, err = WebhookAuthFromEnv("digest")
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+// Package state reads and writes the JSON state file shared by setup and the lambda
+// deployer. Each tool owns one section and reads the other's, so setup can target the
+// deployed function and the deployer can grant the rules permission to invoke it.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultPath is the state file location relative to the setup and lambda directories.
+const DefaultPath = "../state.json"
+
+// State is the content of the state file.
+type State struct {
+	EventBridge *EventBridgeState `json:"eventBridge,omitempty"`
+	Lambda      *LambdaState      `json:"lambda,omitempty"`
+	// Functions holds the functions deployed from a manifest besides Lambda, which is
+	// the first of them and the one setup targets, by function name.
+	Functions map[string]*LambdaState `json:"functions,omitempty"`
+}
+
+// EventBridgeState is written by setup.
+type EventBridgeState struct {
+	EventBusName string      `json:"eventBusName"`
+	EventBusArn  string      `json:"eventBusArn"`
+	Rules        []RuleState `json:"rules"`
+}
+
+// RuleState records a rule and the IDs of the targets attached to it.
+type RuleState struct {
+	Name         string   `json:"name"`
+	Arn          string   `json:"arn"`
+	EventBusName string   `json:"eventBusName"`
+	TargetIDs    []string `json:"targetIds"`
+}
+
+// LambdaState is written by the lambda deployer.
+type LambdaState struct {
+	FunctionName string `json:"functionName"`
+	FunctionArn  string `json:"functionArn"`
+	Version      string `json:"version"`
+	Alias        string `json:"alias,omitempty"`
+	AliasArn     string `json:"aliasArn,omitempty"`
+	// PreviousVersion is where the alias pointed before the last deploy, the rollback target.
+	PreviousVersion string `json:"previousVersion,omitempty"`
+	// Triggers are the rules the manifest lets invoke the function. setup targets a
+	// function other than the primary one from each rule it creates that is named here.
+	Triggers []string `json:"triggers,omitempty"`
+}
+
+// InvokeArn is the ARN rules should target: the alias when there is one, so traffic
+// follows deploys and rollbacks, otherwise the unqualified function.
+func (s *LambdaState) InvokeArn() string {
+	if s == nil {
+		return ""
+	}
+	if s.AliasArn != "" {
+		return s.AliasArn
+	}
+	return s.FunctionArn
+}
+
+// Function returns the recorded function with the given name, or nil.
+func (s *State) Function(name string) *LambdaState {
+	if f, ok := s.Functions[name]; ok {
+		return f
+	}
+	if s.Lambda != nil && s.Lambda.FunctionName == name {
+		return s.Lambda
+	}
+	return nil
+}
+
+// SetFunction records a deployed function: the primary one, which setup targets, as
+// Lambda and the others by name in Functions.
+func (s *State) SetFunction(f *LambdaState, primary bool) {
+	if primary {
+		s.Lambda = f
+		delete(s.Functions, f.FunctionName)
+		return
+	}
+	if s.Functions == nil {
+		s.Functions = map[string]*LambdaState{}
+	}
+	s.Functions[f.FunctionName] = f
+}
+
+// RemoveFunction forgets a destroyed function. It reports whether the function was
+// the primary one, which setup's rule targets.
+func (s *State) RemoveFunction(name string) bool {
+	delete(s.Functions, name)
+	if s.Lambda != nil && s.Lambda.FunctionName == name {
+		s.Lambda = nil
+		return true
+	}
+	return false
+}
+
+// Rule returns the recorded rule with the given name, or nil.
+func (s *EventBridgeState) Rule(name string) *RuleState {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Rules {
+		if s.Rules[i].Name == name {
+			return &s.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Load reads the state file. A missing file is not an error and yields an empty state.
+func Load(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %s: %v", path, err)
+	}
+
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %v", path, err)
+	}
+	return &s, nil
+}
+
+// Save writes the state file atomically so a crashed run never leaves it half written.
+func Save(path string, s *State) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".state-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to write state file %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file %s: %v", path, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Update loads the state file, applies fn and saves the result. Sections fn does not
+// touch are written back unchanged.
+func Update(path string, fn func(s *State)) error {
+	s, err := Load(path)
+	if err != nil {
+		return err
+	}
+	fn(s)
+	return Save(path, s)
+}
@@ -0,0 +1,91 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMissingFile(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	assert.Nil(t, s.EventBridge)
+	assert.Nil(t, s.Lambda)
+}
+
+func TestUpdateKeepsOtherSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	err := Update(path, func(s *State) {
+		s.Lambda = &LambdaState{
+			FunctionName: "MyGoLambdaFunction",
+			FunctionArn:  "arn:aws:lambda:us-east-1:123456789012:function:MyGoLambdaFunction",
+			Version:      "$LATEST",
+		}
+	})
+	assert.NoError(t, err)
+
+	err = Update(path, func(s *State) {
+		s.EventBridge = &EventBridgeState{
+			EventBusName: "eventbus",
+			EventBusArn:  "arn:aws:events:us-east-1:123456789012:event-bus/eventbus",
+			Rules: []RuleState{{
+				Name:      "Rule-ECRPushEvent",
+				Arn:       "arn:aws:events:us-east-1:123456789012:rule/eventbus/Rule-ECRPushEvent",
+				TargetIDs: []string{"Lambda"},
+			}},
+		}
+	})
+	assert.NoError(t, err)
+
+	s, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "MyGoLambdaFunction", s.Lambda.FunctionName)
+	assert.Equal(t, []string{"Lambda"}, s.EventBridge.Rule("Rule-ECRPushEvent").TargetIDs)
+	assert.Nil(t, s.EventBridge.Rule("Rule-Missing"))
+}
+
+func TestLoadMalformedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	assert.NoError(t, os.WriteFile(path, []byte("{not json"), 0o644))
+
+	_, err := Load(path)
+	assert.Error(t, err)
+}
+
+func TestInvokeArn(t *testing.T) {
+	var missing *LambdaState
+	assert.Equal(t, "", missing.InvokeArn())
+
+	s := &LambdaState{FunctionArn: "arn:aws:lambda:us-east-1:123456789012:function:fn"}
+	assert.Equal(t, "arn:aws:lambda:us-east-1:123456789012:function:fn", s.InvokeArn())
+
+	s.AliasArn = "arn:aws:lambda:us-east-1:123456789012:function:fn:live"
+	assert.Equal(t, "arn:aws:lambda:us-east-1:123456789012:function:fn:live", s.InvokeArn())
+}
+
+func TestSetFunction(t *testing.T) {
+	s := &State{}
+	s.SetFunction(&LambdaState{FunctionName: "TagStore", Version: "3"}, true)
+	s.SetFunction(&LambdaState{FunctionName: "Report", Version: "1"}, false)
+
+	assert.Equal(t, "TagStore", s.Lambda.FunctionName)
+	assert.Len(t, s.Functions, 1)
+	assert.Equal(t, "3", s.Function("TagStore").Version)
+	assert.Equal(t, "1", s.Function("Report").Version)
+	assert.Nil(t, s.Function("Rotation"))
+}
+
+func TestRemoveFunction(t *testing.T) {
+	s := &State{}
+	s.SetFunction(&LambdaState{FunctionName: "TagStore"}, true)
+	s.SetFunction(&LambdaState{FunctionName: "Report"}, false)
+
+	assert.False(t, s.RemoveFunction("Report"))
+	assert.Nil(t, s.Function("Report"))
+	assert.True(t, s.RemoveFunction("TagStore"))
+	assert.Nil(t, s.Lambda)
+	assert.False(t, s.RemoveFunction("TagStore"))
+}